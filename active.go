@@ -6,37 +6,40 @@ import (
 	"time"
 
 	humanize "github.com/pyed/go-humanize"
+	"github.com/pyed/rtapi"
 	tgbotapi "gopkg.in/telegram-bot-api.v4"
 )
 
 // active will send torrents that are actively downloading or uploading
-func active() {
-	torrents, err := rtorrent.Torrents()
+func active(s *session, tokens []string) {
+	query, tokens := parseLabelQuery(tokens)
+	torrents, err := s.torrents()
 	if err != nil {
 		logger.Print(err)
-		send("active: "+err.Error(), false)
+		s.send("active: "+err.Error(), false)
 		return
 	}
 
+	ids := torrentIDs(torrents)
+	torrents = filterState(query.filter(torrents), stateActive)
 	buf := new(bytes.Buffer)
+	var actives rtapi.Torrents
 	for i := range torrents {
-		if torrents[i].DownRate > 0 ||
-			torrents[i].UpRate > 0 {
-			torrentName := mdReplacer.Replace(torrents[i].Name) // escape markdown
-			buf.WriteString(fmt.Sprintf("`<%d>` *%s*\n%s *%s* (%s) ↓ *%s*  ↑ *%s* R: *%.2f*\n\n",
-				i, torrentName, torrents[i].State, humanize.IBytes(torrents[i].Completed),
-				torrents[i].Percent, humanize.IBytes(torrents[i].DownRate),
-				humanize.IBytes(torrents[i].UpRate), torrents[i].Ratio))
-		}
+		actives = append(actives, torrents[i])
+		torrentName := mdReplacer.Replace(torrents[i].Name) // escape markdown
+		buf.WriteString(fmt.Sprintf("`<%s>` *%s*\n%s *%s* (%s) ↓ *%s*  ↑ *%s* R: *%.2f*\n\n",
+			ids[torrents[i].Hash], torrentName, torrents[i].State, humanize.IBytes(torrents[i].Completed),
+			torrents[i].Percent, humanize.IBytes(torrents[i].DownRate),
+			humanize.IBytes(torrents[i].UpRate), torrents[i].Ratio))
 	}
 	if buf.Len() == 0 {
-		send("No active torrents", false)
+		s.send("No active torrents", false)
 		return
 	}
 
-	msgID := send(buf.String(), true)
+	msgID := s.sendWithKeyboard(buf.String(), true, torrentsKeyboard(actives, ids))
 
-	if NoLive {
+	if !s.isLive() {
 		return
 	}
 
@@ -47,26 +50,28 @@ func active() {
 		buf.Reset()
 
 		// update torrents
-		torrents, err = rtorrent.Torrents()
+		torrents, err = s.torrents()
 		if err != nil {
 			continue // if there was error getting torrents, skip to the next iteration
 		}
+		ids = torrentIDs(torrents)
+		torrents = filterState(query.filter(torrents), stateActive)
 
 		// do the same loop again
+		actives = actives[:0]
 		for i := range torrents {
-			if torrents[i].DownRate > 0 ||
-				torrents[i].UpRate > 0 {
-				torrentName := mdReplacer.Replace(torrents[i].Name) // replace markdown chars
-				buf.WriteString(fmt.Sprintf("`<%d>` *%s*\n%s *%s* (%s) ↓ *%s*  ↑ *%s* R: *%.2f*\n\n",
-					i, torrentName, torrents[i].State, humanize.IBytes(torrents[i].Completed),
-					torrents[i].Percent, humanize.IBytes(torrents[i].DownRate),
-					humanize.IBytes(torrents[i].UpRate), torrents[i].Ratio))
-			}
+			actives = append(actives, torrents[i])
+			torrentName := mdReplacer.Replace(torrents[i].Name) // replace markdown chars
+			buf.WriteString(fmt.Sprintf("`<%s>` *%s*\n%s *%s* (%s) ↓ *%s*  ↑ *%s* R: *%.2f*\n\n",
+				ids[torrents[i].Hash], torrentName, torrents[i].State, humanize.IBytes(torrents[i].Completed),
+				torrents[i].Percent, humanize.IBytes(torrents[i].DownRate),
+				humanize.IBytes(torrents[i].UpRate), torrents[i].Ratio))
 		}
 
 		// no need to check if it is empty, as if the buffer is empty telegram won't change the message
-		editConf := tgbotapi.NewEditMessageText(chatID, msgID, buf.String())
+		editConf := tgbotapi.NewEditMessageText(s.chatID, msgID, buf.String())
 		editConf.ParseMode = tgbotapi.ModeMarkdown
+		editConf.ReplyMarkup = torrentsKeyboard(actives, ids)
 		Bot.Send(editConf)
 	}
 	// sleep one more time before putting the dashes
@@ -75,18 +80,16 @@ func active() {
 	// replace the speed with dashes to indicate that we are done being live
 	buf.Reset()
 	for i := range torrents {
-		if torrents[i].DownRate > 0 ||
-			torrents[i].UpRate > 0 {
-			// escape markdown
-			torrentName := mdReplacer.Replace(torrents[i].Name)
-			buf.WriteString(fmt.Sprintf("`<%d>` *%s*\n%s *%s* (%s) ↓ *-*  ↑ *-* R: *%.2f*\n\n",
-				i, torrentName, torrents[i].State, humanize.IBytes(torrents[i].Completed),
-				torrents[i].Percent, torrents[i].Ratio))
-		}
+		// escape markdown
+		torrentName := mdReplacer.Replace(torrents[i].Name)
+		buf.WriteString(fmt.Sprintf("`<%s>` *%s*\n%s *%s* (%s) ↓ *-*  ↑ *-* R: *%.2f*\n\n",
+			ids[torrents[i].Hash], torrentName, torrents[i].State, humanize.IBytes(torrents[i].Completed),
+			torrents[i].Percent, torrents[i].Ratio))
 	}
 
-	editConf := tgbotapi.NewEditMessageText(chatID, msgID, buf.String())
+	editConf := tgbotapi.NewEditMessageText(s.chatID, msgID, buf.String())
 	editConf.ParseMode = tgbotapi.ModeMarkdown
+	editConf.ReplyMarkup = torrentsKeyboard(actives, ids)
 	Bot.Send(editConf)
 
 }
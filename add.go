@@ -1,23 +1,30 @@
 package main
 
 import (
+	"encoding/base32"
+	"encoding/hex"
+	stdErrors "errors"
 	"fmt"
+	"net/url"
 	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/pyed/rtapi"
 )
 
 // add takes an URL to a .torrent file to add it to rtorrent
-func add(tokens []string, filename string) {
+func add(s *session, tokens []string, filename string) {
 	if len(tokens) == 0 {
-		send("add: needs at least one URL", false)
+		s.send("add: needs at least one URL", false)
 		return
 	}
 
-	// loop over the URL/s and add them
-	// WARNING: it doesn't report error if the same torrent already added.
+	// loop over the URL/s and add them, torrents that are already there get reported
 	for _, url := range tokens {
-		if err := rtorrent.Download(url); err != nil {
+		if err := addTorrent(url, filename, "", "", true); err != nil {
 			logger.Print("add:", err)
-			send("add: "+err.Error(), false)
+			s.send("add: "+err.Error(), false)
 			continue
 		}
 
@@ -26,6 +33,137 @@ func add(tokens []string, filename string) {
 			displayName = filepath.Base(url)
 		}
 
-		send(fmt.Sprintf("Added: %s", displayName), false)
+		s.send(fmt.Sprintf("Added: %s", displayName), false)
+	}
+}
+
+// addTorrent adds a torrent from a URL or a magnet, to dir and with label if they are set, start is false
+// to add it paused, every way of adding torrents goes through it. dir has to be there already, see 'prepareDir'.
+// .torrent URLs get downloaded here to find duplicates, and passed as they are to rTorrent if that fails.
+func addTorrent(link, name, dir, label string, start bool) error {
+	switch {
+	case strings.HasPrefix(link, "magnet:"):
+		if hash := magnetHash(link); hash != "" {
+			if err := checkDuplicate(hash); err != nil {
+				return err
+			}
+		}
+		if err := guardFreeSpace(name, magnetSize(link), dir); err != nil {
+			return err
+		}
+	case strings.HasPrefix(link, "http://") || strings.HasPrefix(link, "https://"):
+		if data, err := downloadTorrentFile(link); err == nil {
+			if _, err := parseTorrent(data); err == nil {
+				return addTorrentData(data, dir, label, start)
+			}
+		}
+	}
+
+	if !start {
+		// rtapi only adds torrents started
+		_, err := rtCall("load.normal", append([]interface{}{"", link}, loadCommands(dir, label)...)...)
+		return err
+	}
+	if dir == "" && label == "" {
+		return rtorrent.Download(link)
+	}
+	return rtorrent.DownloadWithOptions(&rtapi.DotTorrentWithOptions{Link: link, Name: name, Dir: dir, Label: encodeLabel(label)})
+}
+
+// addTorrentData adds a .torrent from its content, to dir and with label if they are set, so rTorrent
+// doesn't have to reach the place it came from, start is false to add it paused. dir has to be there
+// already, see 'prepareDir'.
+func addTorrentData(data []byte, dir, label string, start bool) error {
+	meta, err := parseTorrent(data)
+	if err != nil {
+		return err
+	}
+	if err := checkDuplicate(meta.infoHash); err != nil {
+		return err
+	}
+	if err := guardFreeSpace(meta.name, uint64(meta.size), dir); err != nil {
+		return err
+	}
+
+	method := "load.raw_start"
+	if !start {
+		method = "load.raw"
+	}
+	_, err = rtCall(method, append([]interface{}{"", data}, loadCommands(dir, label)...)...)
+	return err
+}
+
+// loadCommands returns the commands that set dir and label of a torrent being loaded, for the ones that are set
+func loadCommands(dir, label string) []interface{} {
+	var commands []interface{}
+	if dir != "" {
+		// quoted, or rTorrent splits the command at commas and semicolons of the path
+		commands = append(commands, "d.directory.set="+quoteCommandArg(dir))
+	}
+	if label != "" {
+		commands = append(commands, "d.custom1.set="+encodeLabel(label))
+	}
+	return commands
+}
+
+// quoteCommandArg quotes an argument of an rTorrent command such as "d.directory.set=<arg>",
+// escaping the backslashes and quotes inside it
+func quoteCommandArg(arg string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+}
+
+// errAlreadyPresent is returned when adding a torrent that's already in rTorrent.
+var errAlreadyPresent = stdErrors.New("already present")
+
+// checkDuplicate returns an error describing the torrent with the info hash if it's already in rTorrent
+func checkDuplicate(hash string) error {
+	torrents, err := rtorrent.Torrents()
+	if err != nil {
+		return err
+	}
+
+	for _, torrent := range torrents {
+		if strings.EqualFold(torrent.Hash, hash) {
+			return fmt.Errorf("%w as <%s> %s (%s, %s)", errAlreadyPresent,
+				torrentIDs(torrents)[torrent.Hash], torrent.Name, torrent.State, torrent.Percent)
+		}
+	}
+	return nil
+}
+
+// magnetHash returns the info hash of a magnet link in upper case hex, empty if it has none, the
+// "xt=urn:btih:" parameter may be hex or base32.
+func magnetHash(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+
+	for _, xt := range u.Query()["xt"] {
+		btih, ok := strings.CutPrefix(strings.ToLower(xt), "urn:btih:")
+		if !ok {
+			continue
+		}
+		switch len(btih) {
+		case 40:
+			if _, err := hex.DecodeString(btih); err == nil {
+				return strings.ToUpper(btih)
+			}
+		case 32:
+			if b, err := base32.StdEncoding.DecodeString(strings.ToUpper(btih)); err == nil {
+				return strings.ToUpper(hex.EncodeToString(b))
+			}
+		}
+	}
+	return ""
+}
+
+// magnetSize returns the size of the torrent of a magnet link from its "xl" parameter, 0 if it has none
+func magnetSize(link string) uint64 {
+	u, err := url.Parse(link)
+	if err != nil {
+		return 0
 	}
+	size, _ := strconv.ParseUint(u.Query().Get("xl"), 10, 64)
+	return size
 }
@@ -0,0 +1,59 @@
+package main
+
+import "testing"
+
+func TestMagnetHash(t *testing.T) {
+	const hash = "0123456789ABCDEF0123456789ABCDEF01234567"
+
+	// the same info hash in hex and in base32, in either case
+	for _, link := range []string{
+		"magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567&dn=name",
+		"magnet:?xt=urn:btih:" + hash,
+		"magnet:?xt=urn:btih:AERUKZ4JVPG66AJDIVTYTK6N54ASGRLH",
+		"magnet:?dn=name&xt=urn:btih:aerukz4jvpg66ajdivtytk6n54asgrlh",
+		"magnet:?xt=urn:btmh:1220abcd&xt=urn:btih:" + hash, // other urns are skipped
+	} {
+		if got := magnetHash(link); got != hash {
+			t.Errorf("magnetHash(%q) = %q, want %q", link, got, hash)
+		}
+	}
+
+	// links the duplicate check can't tell anything about
+	for _, link := range []string{
+		"magnet:?xt=urn:btih:0123",
+		"magnet:?xt=urn:btih:zz23456789abcdef0123456789abcdef01234567",
+		"magnet:?dn=name",
+		"https://example.com/file.torrent",
+		"%zz",
+	} {
+		if got := magnetHash(link); got != "" {
+			t.Errorf("magnetHash(%q) = %q, want none", link, got)
+		}
+	}
+}
+
+func TestMagnetSize(t *testing.T) {
+	if size := magnetSize("magnet:?xt=urn:btih:0123&xl=1048576"); size != 1<<20 {
+		t.Errorf("magnetSize with xl=1048576 = %d", size)
+	}
+	// without a valid exact length the size is unknown, and the space check is skipped
+	for _, link := range []string{"magnet:?xt=urn:btih:0123", "magnet:?xl=-5", "magnet:?xl=big", "%zz"} {
+		if size := magnetSize(link); size != 0 {
+			t.Errorf("magnetSize(%q) = %d, want 0", link, size)
+		}
+	}
+}
+
+func TestQuoteCommandArg(t *testing.T) {
+	quoted := map[string]string{
+		"/data/tv":             `"/data/tv"`,
+		"/data/a,b;c":          `"/data/a,b;c"`,
+		`/data/say "hi"`:       `"/data/say \"hi\""`,
+		`C:\downloads\"quoted`: `"C:\\downloads\\\"quoted"`,
+	}
+	for arg, want := range quoted {
+		if got := quoteCommandArg(arg); got != want {
+			t.Errorf("quoteCommandArg(%q) = %s, want %s", arg, got, want)
+		}
+	}
+}
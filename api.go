@@ -0,0 +1,425 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	stdErrors "errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pyed/rtapi"
+)
+
+// apiTokenHeader is the header the API token has to be sent in.
+const apiTokenHeader = "X-API-Token"
+
+// apiTorrent is how the API shows a torrent.
+type apiTorrent struct {
+	ID        string  `json:"id"`
+	Hash      string  `json:"hash"`
+	Name      string  `json:"name"`
+	State     string  `json:"state"`
+	Label     string  `json:"label,omitempty"`
+	Tracker   string  `json:"tracker"`
+	Size      uint64  `json:"size"`
+	Completed uint64  `json:"completed"`
+	Percent   string  `json:"percent"`
+	Uploaded  uint64  `json:"uploaded"`
+	Ratio     float64 `json:"ratio"`
+	DownRate  uint64  `json:"down_rate"`
+	UpRate    uint64  `json:"up_rate"`
+	ETA       uint64  `json:"eta"`
+	Added     int64   `json:"added"` // unix time
+	Path      string  `json:"path,omitempty"`
+	Message   string  `json:"message,omitempty"`
+}
+
+// apiAdd is the JSON body to add a torrent by URL or magnet.
+type apiAdd struct {
+	URL    string `json:"url"`
+	Dir    string `json:"dir"`
+	Label  string `json:"label"`
+	Paused bool   `json:"paused"`
+}
+
+// apiRisk is a torrent that would get a hit and run if deleted now.
+type apiRisk struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Missing string `json:"missing"`
+}
+
+// serveAPI serves the JSON API on addr under /api/, every request needs token in the X-API-Token header
+func serveAPI(addr, token string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{Handler: apiHandler(token), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		logger.Print("api:", server.Serve(ln))
+	}()
+	logger.Printf("[INFO] API: http://%s/api/", ln.Addr())
+	return nil
+}
+
+// apiHandler routes the API's endpoints, behind the token check
+func apiHandler(token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/torrents", apiList)
+	mux.HandleFunc("POST /api/torrents", apiAddTorrent)
+	mux.HandleFunc("GET /api/torrents/{id}", apiInfo)
+	mux.HandleFunc("DELETE /api/torrents/{id}", apiDelete)
+	mux.HandleFunc("POST /api/torrents/{id}/{action}", apiAction)
+	mux.HandleFunc("GET /api/stats", apiStats)
+	mux.HandleFunc("GET /api/speed", apiSpeed)
+	return apiAuth(token, mux)
+}
+
+// apiAuth refuses the requests that don't carry the token
+func apiAuth(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get(apiTokenHeader)), []byte(token)) != 1 {
+			logger.Printf("[INFO] API: refused a request from: %s", r.RemoteAddr)
+			apiError(w, http.StatusUnauthorized, fmt.Errorf("missing or wrong %s header", apiTokenHeader))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// apiList lists the torrents, filtered by the state, label, tracker and search query parameters,
+// and sorted by sort, the same methods 'sort' takes, reversed with reverse=true.
+func apiList(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	torrents, err := rtorrent.Torrents()
+	if err != nil {
+		apiFail(w, err)
+		return
+	}
+	ids := torrentIDs(torrents)
+
+	if label := q.Get("label"); label != "" {
+		torrents = labelQuery{label: label, set: true}.filter(torrents)
+	}
+
+	if state := q.Get("state"); state != "" {
+		torrents = filterState(torrents, state)
+	}
+
+	for _, filter := range []struct {
+		param  string
+		filter func(rtapi.Torrents, string) (rtapi.Torrents, error)
+	}{
+		{"tracker", filterTracker},
+		{"search", filterName},
+	} {
+		query := q.Get(filter.param)
+		if query == "" {
+			continue
+		}
+		if torrents, err = filter.filter(torrents, query); err != nil {
+			apiError(w, http.StatusBadRequest, fmt.Errorf("%s: %w", filter.param, err))
+			return
+		}
+	}
+
+	if by := q.Get("sort"); by != "" {
+		method, ok := sortings[strings.ToLower(by)]
+		if !ok {
+			apiError(w, http.StatusBadRequest, fmt.Errorf("unknown sorting method: %s", by))
+			return
+		}
+		if reverse, _ := strconv.ParseBool(q.Get("reverse")); reverse {
+			method.rev(torrents)
+		} else {
+			method.by(torrents)
+		}
+	}
+
+	list := make([]apiTorrent, 0, len(torrents))
+	for _, torrent := range torrents {
+		list = append(list, toAPITorrent(torrent, ids))
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// apiInfo shows a torrent
+func apiInfo(w http.ResponseWriter, r *http.Request) {
+	torrents, torrent, ok := apiFind(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, toAPITorrent(torrent, torrentIDs(torrents)))
+}
+
+// apiAction starts, stops or checks a torrent, or all of them if the ID is "all"
+func apiAction(w http.ResponseWriter, r *http.Request) {
+	actions := map[string]func(...*rtapi.Torrent) error{
+		"start": rtorrent.Start,
+		"stop":  rtorrent.Stop,
+		"check": rtorrent.Check,
+	}
+	action, ok := actions[r.PathValue("action")]
+	if !ok {
+		apiError(w, http.StatusNotFound, fmt.Errorf("unknown action: %s", r.PathValue("action")))
+		return
+	}
+
+	var targets rtapi.Torrents
+	if r.PathValue("id") == "all" {
+		torrents, err := rtorrent.Torrents()
+		if err != nil {
+			apiFail(w, err)
+			return
+		}
+		targets = torrents
+	} else {
+		_, torrent, ok := apiFind(w, r)
+		if !ok {
+			return
+		}
+		targets = rtapi.Torrents{torrent}
+	}
+
+	if err := action(targets...); err != nil {
+		apiFail(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{r.PathValue("action"): len(targets)})
+}
+
+// apiDelete deletes a torrent, with its data if data=true. Torrents at risk of a hit and run
+// are refused unless force=true, as 'del' and 'deldata' do.
+func apiDelete(w http.ResponseWriter, r *http.Request) {
+	torrents, torrent, ok := apiFind(w, r)
+	if !ok {
+		return
+	}
+	withData, _ := strconv.ParseBool(r.URL.Query().Get("data"))
+	force, _ := strconv.ParseBool(r.URL.Query().Get("force"))
+
+	if !force {
+		risks, err := hnrRisks(rtapi.Torrents{torrent})
+		if err != nil {
+			apiFail(w, err)
+			return
+		}
+		if len(risks) > 0 {
+			ids := torrentIDs(torrents)
+			list := make([]apiRisk, len(risks))
+			for i, risk := range risks {
+				list[i] = apiRisk{ID: ids[risk.torrent.Hash], Name: risk.torrent.Name, Missing: risk.missing}
+			}
+			writeJSON(w, http.StatusConflict, map[string]interface{}{
+				"error": "refused, hit and run risk, add force=true to delete anyway",
+				"risks": list,
+			})
+			return
+		}
+	}
+
+	if err := removeTorrents(withData, rtapi.Torrents{torrent})[0].err; err != nil {
+		apiFail(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"deleted": torrent.Name})
+}
+
+// apiAddTorrent adds a torrent, by URL or magnet as JSON, or a .torrent file uploaded as
+// the "torrent" field of a multipart form, or as the body with the application/x-bittorrent type.
+// Uploads take dir and label as form fields or query parameters, and paused=true to add them stopped.
+func apiAddTorrent(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxTorrentFile)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	if mediaType != "multipart/form-data" && mediaType != "application/x-bittorrent" {
+		var req apiAdd
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apiError(w, http.StatusBadRequest, err)
+			return
+		}
+		if req.URL == "" {
+			apiError(w, http.StatusBadRequest, fmt.Errorf("needs a url"))
+			return
+		}
+		dir, ok := apiPrepareDir(w, req.Dir)
+		if !ok {
+			return
+		}
+		if err := addTorrent(req.URL, "", dir, req.Label, !req.Paused); err != nil {
+			apiError(w, addErrorCode(err), err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, map[string]string{"added": req.URL})
+		return
+	}
+
+	var data []byte
+	if mediaType == "multipart/form-data" {
+		file, _, err := r.FormFile("torrent")
+		if err != nil {
+			apiError(w, http.StatusBadRequest, err)
+			return
+		}
+		defer file.Close()
+		if data, err = io.ReadAll(file); err != nil {
+			apiError(w, http.StatusBadRequest, err)
+			return
+		}
+	} else {
+		var err error
+		if data, err = io.ReadAll(r.Body); err != nil {
+			apiError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	meta, err := parseTorrent(data)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, err)
+		return
+	}
+	dir, ok := apiPrepareDir(w, r.FormValue("dir"))
+	if !ok {
+		return
+	}
+	paused, _ := strconv.ParseBool(r.FormValue("paused"))
+	if err := addTorrentData(data, dir, r.FormValue("label"), !paused); err != nil {
+		apiError(w, addErrorCode(err), err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]string{"added": meta.name, "hash": meta.infoHash})
+}
+
+// addErrorCode returns the status of a failed add, a conflict for torrents that are already there
+func addErrorCode(err error) int {
+	if stdErrors.Is(err, errAlreadyPresent) {
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
+
+// apiStats shows the same numbers 'stats' does, and the counts per state
+func apiStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := rtorrent.Stats()
+	if err != nil {
+		apiFail(w, err)
+		return
+	}
+	torrents, err := rtorrent.Torrents()
+	if err != nil {
+		apiFail(w, err)
+		return
+	}
+
+	totalUp, totalDown, ratio := torrentTotals(torrents)
+
+	counts := make(map[string]int, len(torrentStates))
+	for state, n := range countStates(torrents) {
+		counts[strings.ToLower(state)] = n
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"port":               stats.Port,
+		"directory":          stats.Directory,
+		"throttle_up":        stats.ThrottleUp,
+		"throttle_down":      stats.ThrottleDown,
+		"uploaded":           stats.TotalUp,
+		"downloaded":         stats.TotalDown,
+		"torrents_up":        totalUp,
+		"torrents_down":      totalDown,
+		"ratio":              ratio,
+		"torrents":           len(torrents),
+		"torrents_per_state": counts,
+	})
+}
+
+// apiSpeed shows the current download and upload rates
+func apiSpeed(w http.ResponseWriter, r *http.Request) {
+	down, up := rtorrent.Speeds()
+	writeJSON(w, http.StatusOK, map[string]uint64{"down": down, "up": up})
+}
+
+// apiFind returns the torrents, and the one the ID of the path points to, it writes the error if there's none
+func apiFind(w http.ResponseWriter, r *http.Request) (rtapi.Torrents, *rtapi.Torrent, bool) {
+	torrents, err := rtorrent.Torrents()
+	if err != nil {
+		apiFail(w, err)
+		return nil, nil, false
+	}
+	torrent, err := findTorrent(torrents, r.PathValue("id"))
+	if err != nil {
+		apiError(w, http.StatusNotFound, err)
+		return nil, nil, false
+	}
+	return torrents, torrent, true
+}
+
+// apiPrepareDir prepares the directory to add a torrent to, see 'prepareDir', it writes the error if it fails
+func apiPrepareDir(w http.ResponseWriter, dir string) (string, bool) {
+	if dir == "" {
+		return "", true
+	}
+	dir, _, err := prepareDir(dir)
+	if err != nil {
+		apiFail(w, err)
+		return "", false
+	}
+	return dir, true
+}
+
+// toAPITorrent converts a torrent for the API
+func toAPITorrent(torrent *rtapi.Torrent, ids map[string]string) apiTorrent {
+	return apiTorrent{
+		ID:        ids[torrent.Hash],
+		Hash:      torrent.Hash,
+		Name:      torrent.Name,
+		State:     strings.ToLower(torrent.State),
+		Label:     labelName(torrent),
+		Tracker:   torrent.Tracker.Hostname(),
+		Size:      torrent.Size,
+		Completed: torrent.Completed,
+		Percent:   torrent.Percent,
+		Uploaded:  torrent.UpTotal,
+		Ratio:     torrent.Ratio,
+		DownRate:  torrent.DownRate,
+		UpRate:    torrent.UpRate,
+		ETA:       torrent.ETA,
+		Added:     int64(torrent.Age),
+		Path:      torrent.Path,
+		Message:   torrent.Message,
+	}
+}
+
+// apiFail logs an error of rTorrent or the bot, and writes it
+func apiFail(w http.ResponseWriter, err error) {
+	logger.Print("api:", err)
+	apiError(w, http.StatusInternalServerError, err)
+}
+
+// apiError writes an error as {"error": "..."}, too big bodies get 413
+func apiError(w http.ResponseWriter, code int, err error) {
+	var tooBig *http.MaxBytesError
+	if stdErrors.As(err, &tooBig) {
+		code = http.StatusRequestEntityTooLarge
+	}
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+// writeJSON writes v as the JSON body of the response
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Print("api:", err)
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testAPIToken = "s3cret"
+
+// apiRequest sends a request to the API with the test token, and decodes the JSON response into v if it's not nil.
+func apiRequest(t *testing.T, method, target string, body *bytes.Buffer, contentType string, v interface{}) int {
+	t.Helper()
+	if body == nil {
+		body = new(bytes.Buffer)
+	}
+	r := httptest.NewRequest(method, target, body)
+	r.Header.Set(apiTokenHeader, testAPIToken)
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+
+	w := httptest.NewRecorder()
+	apiHandler(testAPIToken).ServeHTTP(w, r)
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("%s %s: Content-Type = %q", method, target, ct)
+	}
+	if v != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatalf("%s %s: %s in %q", method, target, err, w.Body)
+		}
+	}
+	return w.Code
+}
+
+// waitCall waits for rTorrent to receive a call, rtapi doesn't wait for the answers of its actions.
+func waitCall(t *testing.T, f *fakeRtorrent, call string) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if slices.Contains(f.called(), call) {
+			return
+		}
+	}
+	t.Errorf("rTorrent didn't receive %q, got %q", call, f.called())
+}
+
+func TestAPIAuth(t *testing.T) {
+	startFakeRtorrent(t)
+	handler := apiHandler(testAPIToken)
+
+	for _, token := range []string{"", "wrong", testAPIToken + "x", strings.ToUpper(testAPIToken)} {
+		r := httptest.NewRequest("GET", "/api/torrents", nil)
+		if token != "" {
+			r.Header.Set(apiTokenHeader, token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		var body map[string]string
+		json.Unmarshal(w.Body.Bytes(), &body)
+		if w.Code != http.StatusUnauthorized || !strings.Contains(body["error"], apiTokenHeader) {
+			t.Errorf("token %q: %d %q, want 401 with an error", token, w.Code, w.Body)
+		}
+	}
+
+	// the token goes in the header only
+	r := httptest.NewRequest("GET", "/api/torrents?token="+testAPIToken, nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("token in the query: %d, want 401", w.Code)
+	}
+
+	if code := apiRequest(t, "GET", "/api/torrents", nil, "", nil); code != http.StatusOK {
+		t.Errorf("right token: %d, want 200", code)
+	}
+}
+
+func TestAPIList(t *testing.T) {
+	startFakeRtorrent(t,
+		fakeTorrent{name: "Ubuntu ISO", hash: "AAAA", size: 100, completed: 100, active: true, upRate: 5,
+			label: "linux", tracker: "https://one.example/announce"},
+		fakeTorrent{name: "Debian ISO", hash: "BBBB", size: 200, completed: 20, active: true, downRate: 50,
+			label: "linux", tracker: "https://two.example/announce"},
+		fakeTorrent{name: "Film", hash: "CCCC", size: 300, completed: 0, tracker: "https://one.example/announce"},
+	)
+
+	names := func(list []apiTorrent) []string {
+		var names []string
+		for _, torrent := range list {
+			names = append(names, torrent.Name)
+		}
+		return names
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"Ubuntu ISO", "Debian ISO", "Film"}},
+		{"?state=seeding", []string{"Ubuntu ISO"}},
+		{"?state=active", []string{"Ubuntu ISO", "Debian ISO"}},
+		{"?label=linux&tracker=two", []string{"Debian ISO"}},
+		{"?search=iso&sort=size&reverse=true", []string{"Debian ISO", "Ubuntu ISO"}},
+		{"?sort=SIZE", []string{"Ubuntu ISO", "Debian ISO", "Film"}},
+	}
+	for _, tt := range tests {
+		var list []apiTorrent
+		if code := apiRequest(t, "GET", "/api/torrents"+tt.query, nil, "", &list); code != http.StatusOK {
+			t.Errorf("%q: %d", tt.query, code)
+			continue
+		}
+		if got := names(list); !slices.Equal(got, tt.want) {
+			t.Errorf("%q: %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	var list []apiTorrent
+	apiRequest(t, "GET", "/api/torrents?search=debian", nil, "", &list)
+	if len(list) != 1 || list[0].Hash != "BBBB" || list[0].State != "leeching" || list[0].Tracker != "two.example" ||
+		list[0].Label != "linux" || list[0].Completed != 20 || list[0].DownRate != 50 || list[0].ID == "" {
+		t.Errorf("Debian ISO = %+v", list)
+	}
+
+	for _, query := range []string{"?sort=nope", "?search=(", "?tracker=["} {
+		var body map[string]string
+		if code := apiRequest(t, "GET", "/api/torrents"+query, nil, "", &body); code != http.StatusBadRequest || body["error"] == "" {
+			t.Errorf("%q: %d %v, want 400 with an error", query, code, body)
+		}
+	}
+}
+
+func TestAPIActions(t *testing.T) {
+	f := startFakeRtorrent(t,
+		fakeTorrent{name: "a", hash: "AAAA0000", size: 1, completed: 1},
+		fakeTorrent{name: "b", hash: "BBBB0000", size: 1, completed: 1},
+	)
+
+	var info apiTorrent
+	if code := apiRequest(t, "GET", "/api/torrents/BBBB00", nil, "", &info); code != http.StatusOK || info.Name != "b" {
+		t.Errorf("info: %d %+v", code, info)
+	}
+	var body map[string]interface{}
+	if code := apiRequest(t, "GET", "/api/torrents/ffff00", nil, "", &body); code != http.StatusNotFound {
+		t.Errorf("info of an unknown torrent: %d %v, want 404", code, body)
+	}
+
+	var counts map[string]int
+	if code := apiRequest(t, "POST", "/api/torrents/aaaa00/start", nil, "", &counts); code != http.StatusOK || counts["start"] != 1 {
+		t.Errorf("start: %d %v", code, counts)
+	}
+	waitCall(t, f, "d.start AAAA0000")
+
+	if code := apiRequest(t, "POST", "/api/torrents/all/stop", nil, "", &counts); code != http.StatusOK || counts["stop"] != 2 {
+		t.Errorf("stop all: %d %v", code, counts)
+	}
+	waitCall(t, f, "d.stop BBBB0000")
+
+	if code := apiRequest(t, "POST", "/api/torrents/aaaa00/explode", nil, "", &body); code != http.StatusNotFound {
+		t.Errorf("unknown action: %d %v, want 404", code, body)
+	}
+	r := httptest.NewRequest("GET", "/api/torrents/aaaa00/start", nil)
+	r.Header.Set(apiTokenHeader, testAPIToken)
+	w := httptest.NewRecorder()
+	apiHandler(testAPIToken).ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET of an action: %d, want 405", w.Code)
+	}
+}
+
+func TestAPIDelete(t *testing.T) {
+	f := startFakeRtorrent(t,
+		fakeTorrent{name: "young", hash: "AAAA0000", size: 10, completed: 10, ratio: 0.5, tracker: "https://strict.example/announce"},
+	)
+	saved := hnr
+	t.Cleanup(func() { hnr = saved })
+	hnr = hnrRequirements{Requirements: []hnrRequirement{{Tracker: "strict.example", Ratio: 1}}}
+
+	var refused struct {
+		Error string    `json:"error"`
+		Risks []apiRisk `json:"risks"`
+	}
+	if code := apiRequest(t, "DELETE", "/api/torrents/aaaa00", nil, "", &refused); code != http.StatusConflict ||
+		len(refused.Risks) != 1 || refused.Risks[0].Name != "young" || !strings.Contains(refused.Risks[0].Missing, "ratio") {
+		t.Errorf("delete at risk: %d %+v, want 409 with the risk", code, refused)
+	}
+	if slices.Contains(f.called(), "d.erase AAAA0000") {
+		t.Error("a torrent at risk got deleted")
+	}
+
+	var deleted map[string]string
+	if code := apiRequest(t, "DELETE", "/api/torrents/aaaa00?force=true", nil, "", &deleted); code != http.StatusOK || deleted["deleted"] != "young" {
+		t.Errorf("forced delete: %d %v", code, deleted)
+	}
+	waitCall(t, f, "d.erase AAAA0000")
+}
+
+func TestAPIAddFile(t *testing.T) {
+	f := startFakeRtorrent(t)
+	dir := t.TempDir()
+	f.handle = func(method string, params []interface{}) (interface{}, error) {
+		if method == "directory.default" {
+			return dir, nil // for the free space check
+		}
+		return nil, nil
+	}
+	data := "d4:infod6:lengthi5e4:name8:file.iso12:piece lengthi16384e6:pieces20:01234567890123456789ee"
+
+	// as a multipart upload, paused
+	body := new(bytes.Buffer)
+	form := multipart.NewWriter(body)
+	part, _ := form.CreateFormFile("torrent", "file.torrent")
+	part.Write([]byte(data))
+	form.WriteField("paused", "true")
+	form.WriteField("label", "isos")
+	form.Close()
+
+	var added map[string]string
+	if code := apiRequest(t, "POST", "/api/torrents", body, form.FormDataContentType(), &added); code != http.StatusCreated ||
+		added["added"] != "file.iso" || len(added["hash"]) != 40 {
+		t.Errorf("multipart: %d %v", code, added)
+	}
+	if calls := f.called(); !slices.ContainsFunc(calls, func(c string) bool {
+		return strings.HasPrefix(c, "load.raw ") && strings.HasSuffix(c, " d.custom1.set=isos")
+	}) {
+		t.Errorf("multipart: calls %q, want a paused load.raw with the label", calls)
+	}
+
+	// as the body, started
+	if code := apiRequest(t, "POST", "/api/torrents", bytes.NewBufferString(data), "application/x-bittorrent", &added); code != http.StatusCreated {
+		t.Errorf("raw body: %d %v", code, added)
+	}
+	if calls := f.called(); !strings.HasPrefix(calls[len(calls)-1], "load.raw_start ") {
+		t.Errorf("raw body: calls %q, want a load.raw_start", calls)
+	}
+
+	var failed map[string]string
+	if code := apiRequest(t, "POST", "/api/torrents", bytes.NewBufferString("not bencode"), "application/x-bittorrent", &failed); code != http.StatusBadRequest {
+		t.Errorf("bad torrent: %d %v, want 400", code, failed)
+	}
+	if code := apiRequest(t, "POST", "/api/torrents", bytes.NewBufferString(`{"dir": "/x"}`), "application/json", &failed); code != http.StatusBadRequest || failed["error"] != "needs a url" {
+		t.Errorf("JSON without url: %d %v, want 400", code, failed)
+	}
+
+	big := bytes.NewBuffer(make([]byte, maxTorrentFile+1))
+	if code := apiRequest(t, "POST", "/api/torrents", big, "application/x-bittorrent", &failed); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("too big: %d %v, want 413", code, failed)
+	}
+}
+
+func TestAPIAddURL(t *testing.T) {
+	const hash = "0123456789ABCDEF0123456789ABCDEF01234567"
+	f := startFakeRtorrent(t, fakeTorrent{name: "there", hash: hash})
+	dir := t.TempDir()
+	magnet := "magnet:?xt=urn:btih:fedcba9876543210fedcba9876543210fedcba98"
+
+	var added map[string]string
+	body := bytes.NewBufferString(`{"url": "` + magnet + `", "dir": "` + dir + `", "label": "isos", "paused": true}`)
+	if code := apiRequest(t, "POST", "/api/torrents", body, "application/json", &added); code != http.StatusCreated || added["added"] != magnet {
+		t.Errorf("paused: %d %v", code, added)
+	}
+	want := "load.normal  " + magnet + ` d.directory.set="` + dir + `" d.custom1.set=isos`
+	if calls := f.called(); !slices.Contains(calls, want) {
+		t.Errorf("paused: calls %q, want %q", calls, want)
+	}
+
+	// the torrent is there already
+	var failed map[string]string
+	body = bytes.NewBufferString(`{"url": "magnet:?xt=urn:btih:` + strings.ToLower(hash) + `"}`)
+	if code := apiRequest(t, "POST", "/api/torrents", body, "application/json", &failed); code != http.StatusConflict ||
+		!strings.Contains(failed["error"], "there") {
+		t.Errorf("already there: %d %v, want 409", code, failed)
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// bdecoder decodes bencoded data, strings decode to []byte, integers to int64,
+// lists to []interface{} and dictionaries to map[string]interface{}.
+type bdecoder struct {
+	data []byte
+	pos  int
+
+	// where the "info" dictionary of a .torrent starts and ends, to hash it as it is
+	infoStart, infoEnd int
+}
+
+// bdecode decodes a bencoded value, the whole data has to be a single value.
+func bdecode(data []byte) (interface{}, *bdecoder, error) {
+	d := &bdecoder{data: data}
+	v, err := d.value(0)
+	if err != nil {
+		return nil, nil, err
+	}
+	if d.pos != len(d.data) {
+		return nil, nil, fmt.Errorf("bencode: trailing data at %d", d.pos)
+	}
+	return v, d, nil
+}
+
+// value decodes the value at the current position, depth is how deep in dictionaries and lists it is
+func (d *bdecoder) value(depth int) (interface{}, error) {
+	if d.pos >= len(d.data) {
+		return nil, fmt.Errorf("bencode: unexpected end of data")
+	}
+	if depth > 64 {
+		return nil, fmt.Errorf("bencode: too deeply nested")
+	}
+
+	switch c := d.data[d.pos]; {
+	case c == 'i':
+		end := bytes.IndexByte(d.data[d.pos:], 'e')
+		if end == -1 {
+			return nil, fmt.Errorf("bencode: unterminated integer at %d", d.pos)
+		}
+		n, err := strconv.ParseInt(string(d.data[d.pos+1:d.pos+end]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bencode: invalid integer at %d", d.pos)
+		}
+		d.pos += end + 1
+		return n, nil
+
+	case c == 'l':
+		d.pos++
+		list := []interface{}{}
+		for d.pos < len(d.data) && d.data[d.pos] != 'e' {
+			v, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		if d.pos >= len(d.data) {
+			return nil, fmt.Errorf("bencode: unterminated list")
+		}
+		d.pos++
+		return list, nil
+
+	case c == 'd':
+		d.pos++
+		dict := make(map[string]interface{})
+		for d.pos < len(d.data) && d.data[d.pos] != 'e' {
+			key, err := d.str()
+			if err != nil {
+				return nil, err
+			}
+
+			start := d.pos
+			v, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			if depth == 0 && string(key) == "info" {
+				d.infoStart, d.infoEnd = start, d.pos
+			}
+			dict[string(key)] = v
+		}
+		if d.pos >= len(d.data) {
+			return nil, fmt.Errorf("bencode: unterminated dictionary")
+		}
+		d.pos++
+		return dict, nil
+
+	case c >= '0' && c <= '9':
+		return d.str()
+	}
+	return nil, fmt.Errorf("bencode: unexpected '%c' at %d", d.data[d.pos], d.pos)
+}
+
+// str decodes a string at the current position, e.g. "4:spam"
+func (d *bdecoder) str() ([]byte, error) {
+	colon := bytes.IndexByte(d.data[d.pos:], ':')
+	if colon == -1 {
+		return nil, fmt.Errorf("bencode: invalid string at %d", d.pos)
+	}
+	n, err := strconv.Atoi(string(d.data[d.pos : d.pos+colon]))
+	if err != nil || n < 0 || d.pos+colon+1+n > len(d.data) {
+		return nil, fmt.Errorf("bencode: invalid string length at %d", d.pos)
+	}
+	start := d.pos + colon + 1
+	d.pos = start + n
+	return d.data[start:d.pos], nil
+}
+
+// metaFile is a file inside a .torrent.
+type metaFile struct {
+	path string
+	size int64
+}
+
+// metaInfo is what rtelegram reads from a .torrent before adding it.
+type metaInfo struct {
+	name     string
+	infoHash string // hex, upper case like rTorrent's hashes
+	size     int64
+	files    []metaFile
+	private  bool
+	trackers []string
+}
+
+// parseTorrent validates and parses a .torrent file
+func parseTorrent(data []byte) (*metaInfo, error) {
+	v, d, err := bdecode(data)
+	if err != nil {
+		return nil, err
+	}
+	root, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("not a torrent file: expected a dictionary")
+	}
+	info, ok := root["info"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("not a torrent file: no info dictionary")
+	}
+
+	sum := sha1.Sum(data[d.infoStart:d.infoEnd])
+	meta := &metaInfo{infoHash: strings.ToUpper(hex.EncodeToString(sum[:]))}
+
+	name, ok := info["name"].([]byte)
+	if !ok {
+		return nil, fmt.Errorf("not a torrent file: no name")
+	}
+	meta.name = string(name)
+	if private, ok := info["private"].(int64); ok && private == 1 {
+		meta.private = true
+	}
+
+	if length, ok := info["length"]; ok {
+		// single file torrent
+		size, ok := length.(int64)
+		if !ok || size < 0 {
+			return nil, fmt.Errorf("not a torrent file: invalid length")
+		}
+		meta.files = []metaFile{{path: meta.name, size: size}}
+	} else {
+		files, ok := info["files"].([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("not a torrent file: neither a length nor files")
+		}
+		for _, f := range files {
+			file, ok := f.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("not a torrent file: invalid file entry")
+			}
+			length, ok := file["length"].(int64)
+			if !ok || length < 0 {
+				return nil, fmt.Errorf("not a torrent file: missing or invalid file length")
+			}
+			var parts []string
+			if path, ok := file["path"].([]interface{}); ok {
+				for _, p := range path {
+					if part, ok := p.([]byte); ok {
+						parts = append(parts, string(part))
+					}
+				}
+			}
+			meta.files = append(meta.files, metaFile{path: strings.Join(parts, "/"), size: length})
+		}
+	}
+	for _, f := range meta.files {
+		meta.size += f.size
+	}
+
+	// "announce-list" is a list of tiers, "announce" is the only tracker of older torrents
+	seen := make(map[string]bool)
+	addTracker := func(v interface{}) {
+		if url, ok := v.([]byte); ok && !seen[string(url)] {
+			seen[string(url)] = true
+			meta.trackers = append(meta.trackers, string(url))
+		}
+	}
+	if tiers, ok := root["announce-list"].([]interface{}); ok {
+		for _, tier := range tiers {
+			if urls, ok := tier.([]interface{}); ok {
+				for _, url := range urls {
+					addTracker(url)
+				}
+			}
+		}
+	}
+	addTracker(root["announce"])
+	return meta, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBdecode(t *testing.T) {
+	values := map[string]interface{}{
+		"i42e":        int64(42),
+		"i-7e":        int64(-7),
+		"4:spam":      []byte("spam"),
+		"0:":          []byte{},
+		"le":          []interface{}{},
+		"l4:spami1ee": []interface{}{[]byte("spam"), int64(1)},
+		"d3:cow3:moo4:spaml1:a1:bee": map[string]interface{}{
+			"cow":  []byte("moo"),
+			"spam": []interface{}{[]byte("a"), []byte("b")},
+		},
+	}
+	for in, want := range values {
+		got, _, err := bdecode([]byte(in))
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("bdecode(%q) = %#v, %v, want %#v", in, got, err, want)
+		}
+	}
+
+	// truncated, malformed, trailing data and too deeply nested
+	for _, in := range []string{"", "i42", "iabce", "5:spam", "l4:spam", "d3:cow", "i1ei2e", "x",
+		strings.Repeat("l", 100) + strings.Repeat("e", 100)} {
+		if _, _, err := bdecode([]byte(in)); err == nil {
+			t.Errorf("bdecode(%q): no error", in)
+		}
+	}
+}
+
+func TestParseTorrent(t *testing.T) {
+	// the hash has to be of the info dictionary exactly as it is in the file
+	infoHash := func(info string) string {
+		sum := sha1.Sum([]byte(info))
+		return strings.ToUpper(hex.EncodeToString(sum[:]))
+	}
+
+	single := "d6:lengthi1024e4:name8:file.iso12:piece lengthi16384e6:pieces0:7:privatei1ee"
+	multi := "d5:filesld6:lengthi100e4:pathl3:dir5:a.txteed6:lengthi200e4:pathl5:b.txteee4:name4:pack12:piece lengthi16384e6:pieces0:e"
+
+	tests := []struct {
+		name    string
+		data    string
+		want    *metaInfo
+		wantErr bool
+	}{
+		{
+			name: "single file",
+			data: "d8:announce23:http://tracker/announce4:info" + single + "e",
+			want: &metaInfo{
+				name:     "file.iso",
+				infoHash: infoHash(single),
+				size:     1024,
+				files:    []metaFile{{path: "file.iso", size: 1024}},
+				private:  true,
+				trackers: []string{"http://tracker/announce"},
+			},
+		},
+		{
+			name: "multiple files and tiers",
+			data: "d8:announce5:http:13:announce-listll5:http:4:udp:el5:http:ee4:info" + multi + "e",
+			want: &metaInfo{
+				name:     "pack",
+				infoHash: infoHash(multi),
+				size:     300,
+				files:    []metaFile{{path: "dir/a.txt", size: 100}, {path: "b.txt", size: 200}},
+				trackers: []string{"http:", "udp:"},
+			},
+		},
+		{name: "not a dictionary", data: "l4:infoe", wantErr: true},
+		{name: "no info", data: "d8:announce5:http:e", wantErr: true},
+		{name: "no name", data: "d4:infod6:lengthi1eee", wantErr: true},
+		{name: "no length nor files", data: "d4:infod4:name1:aee", wantErr: true},
+		{name: "not bencoded", data: "<html>", wantErr: true},
+		// a negative length would wrap around once converted to uint64
+		{name: "negative length", data: "d4:infod6:lengthi-1e4:name1:aee", wantErr: true},
+		{name: "length of the wrong type", data: "d4:infod6:length2:104:name1:aee", wantErr: true},
+		{name: "file without a length", data: "d4:infod5:filesld4:pathl1:aeee4:name1:bee", wantErr: true},
+		{name: "file with a negative length", data: "d4:infod5:filesld6:lengthi-5e4:pathl1:aeee4:name1:bee", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTorrent([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pyed/rtapi"
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// maxTorrentButtons caps the per-torrent buttons attached to a list, telegram
+// limits the size of inline keyboards and a wall of buttons isn't useful anyway.
+const maxTorrentButtons = 20
+
+// callback actions, the callback data is formatted as "action:hash"
+const (
+	cbInfo    = "info"
+	cbStart   = "start"
+	cbStop    = "stop"
+	cbCheck   = "check"
+	cbDel     = "del"
+	cbDelData = "deldata"
+	cbRefresh = "refresh"
+	cbConfirm = "confirm" // for confirmations the data is "confirm:code" or "cancel:code"
+	cbCancel  = "cancel"
+	cbFiles   = "files"  // the data is "files:hash:page"
+	cbUpload  = "upload" // the buttons of a received .torrent, see 'handleUpload'
+)
+
+// torrentKeyboard returns the actions keyboard attached to a torrent's info.
+func torrentKeyboard(hash string) *tgbotapi.InlineKeyboardMarkup {
+	button := func(text, action string) tgbotapi.InlineKeyboardButton {
+		return tgbotapi.NewInlineKeyboardButtonData(text, action+":"+hash)
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			button("▶ Start", cbStart),
+			button("⏸ Stop", cbStop),
+			button("✔ Check", cbCheck),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			button("✖ Delete", cbDel),
+			button("✖ Delete+data", cbDelData),
+			button("⟳ Refresh", cbRefresh),
+		),
+	)
+	return &keyboard
+}
+
+// torrentsKeyboard returns a keyboard with a button per torrent to show its info,
+// returns nil if there are no torrents or too many of them.
+func torrentsKeyboard(torrents rtapi.Torrents, ids map[string]string) *tgbotapi.InlineKeyboardMarkup {
+	if len(torrents) == 0 || len(torrents) > maxTorrentButtons {
+		return nil
+	}
+
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0, len(torrents))
+	for _, torrent := range torrents {
+		name := torrent.Name
+		if utf8.RuneCountInString(name) > 30 {
+			name = string([]rune(name)[:29]) + "…"
+		}
+		text := fmt.Sprintf("<%s> %s", ids[torrent.Hash], name)
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData(text, cbInfo+":"+torrent.Hash)))
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return &keyboard
+}
+
+// handleCallback handles presses on inline keyboard buttons.
+func handleCallback(s *session, cb *tgbotapi.CallbackQuery, perm permission) {
+	action, hash, ok := strings.Cut(cb.Data, ":")
+	if !ok {
+		answerCallback(cb, "unknown action")
+		return
+	}
+
+	// everything but showing info needs control over rTorrent
+	if action != cbInfo && action != cbRefresh && action != cbFiles && perm < permControl {
+		answerCallback(cb, fmt.Sprintf("%s: only allowed for %s", action, permControl))
+		return
+	}
+
+	if action == cbConfirm || action == cbCancel {
+		handleConfirmation(s, cb, action, hash)
+		return
+	}
+
+	if action == cbUpload {
+		handleUpload(s, cb, hash)
+		return
+	}
+
+	if action == cbFiles {
+		handleFilesPage(s, cb, hash)
+		return
+	}
+
+	torrents, err := s.torrents()
+	if err != nil {
+		logger.Print("callback:", err)
+		answerCallback(cb, "callback: "+err.Error())
+		return
+	}
+
+	var torrent *rtapi.Torrent
+	for i := range torrents {
+		if torrents[i].Hash == hash {
+			torrent = torrents[i]
+			break
+		}
+	}
+	if torrent == nil {
+		answerCallback(cb, "torrent not found, maybe it got deleted")
+		return
+	}
+
+	switch action {
+	case cbInfo:
+		answerCallback(cb, "")
+		info(s, []string{torrent.Hash})
+		return
+
+	case cbRefresh:
+		if cb.Message == nil {
+			answerCallback(cb, "")
+			return
+		}
+		editConf := tgbotapi.NewEditMessageText(cb.Message.Chat.ID, cb.Message.MessageID,
+			formatInfo(torrent, torrentIDs(torrents)[torrent.Hash]))
+		editConf.ParseMode = tgbotapi.ModeMarkdown
+		editConf.ReplyMarkup = torrentKeyboard(torrent.Hash)
+		Bot.Send(editConf)
+		answerCallback(cb, "Refreshed")
+		return
+
+	case cbStart:
+		err = rtorrent.Start(torrent)
+	case cbStop:
+		err = rtorrent.Stop(torrent)
+	case cbCheck:
+		err = rtorrent.Check(torrent)
+	case cbDel, cbDelData:
+		// deleting needs a confirmation, just like the commands
+		answerCallback(cb, "")
+		withData := action == cbDelData
+		title := "Delete"
+		if withData {
+			title = "Delete with data"
+		}
+		ids := torrentIDs(torrents)
+		// buttons can't force, that's left to the commands
+		if _, ok := hnrGuard(s, action, rtapi.Torrents{torrent}, ids, false); !ok {
+			return
+		}
+		askConfirmation(s, torrentsSummary(title, rtapi.Torrents{torrent}, ids), func() {
+			deleteTorrents(s, withData, rtapi.Torrents{torrent})
+		})
+		return
+	default:
+		answerCallback(cb, "unknown action")
+		return
+	}
+
+	if err != nil {
+		logger.Printf("%s: %s", action, err)
+		answerCallback(cb, action+": "+err.Error())
+		return
+	}
+
+	done := map[string]string{
+		cbStart: "Started",
+		cbStop:  "Stopped",
+		cbCheck: "Checking",
+	}[action]
+	answerCallback(cb, done)
+	s.send(fmt.Sprintf("%s: %s", done, torrent.Name), false)
+}
+
+// handleConfirmation runs or cancels the pending action of a confirmation, and removes its buttons.
+func handleConfirmation(s *session, cb *tgbotapi.CallbackQuery, action, code string) {
+	if cb.Message != nil {
+		editConf := tgbotapi.NewEditMessageReplyMarkup(cb.Message.Chat.ID, cb.Message.MessageID,
+			tgbotapi.InlineKeyboardMarkup{InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{}})
+		Bot.Send(editConf)
+	}
+
+	pending := takeConfirmation(s, code)
+	if pending == nil {
+		answerCallback(cb, "No pending action, it may have expired")
+		return
+	}
+
+	if action == cbCancel {
+		answerCallback(cb, "Cancelled")
+		return
+	}
+
+	answerCallback(cb, "Confirmed")
+	pending.action()
+}
+
+// handleFilesPage moves a 'files' message to another page, data is "hash:page".
+func handleFilesPage(s *session, cb *tgbotapi.CallbackQuery, data string) {
+	hash, pageStr, _ := strings.Cut(data, ":")
+	page, _ := strconv.Atoi(pageStr)
+
+	torrents, err := s.torrents()
+	if err != nil {
+		logger.Print("files:", err)
+		answerCallback(cb, "files: "+err.Error())
+		return
+	}
+
+	torrent, err := findTorrent(torrents, hash)
+	if err != nil || cb.Message == nil {
+		answerCallback(cb, "torrent not found, maybe it got deleted")
+		return
+	}
+
+	text, keyboard, err := filesPage(torrent.Hash, torrentIDs(torrents)[torrent.Hash], torrent.Name, page)
+	if err != nil {
+		logger.Print("files:", err)
+		answerCallback(cb, "files: "+err.Error())
+		return
+	}
+
+	editConf := tgbotapi.NewEditMessageText(s.chatID, cb.Message.MessageID, text)
+	editConf.ParseMode = tgbotapi.ModeMarkdown
+	editConf.ReplyMarkup = keyboard
+	Bot.Send(editConf)
+	answerCallback(cb, "")
+}
+
+// answerCallback stops the loading indicator on the pressed button, showing text if any.
+func answerCallback(cb *tgbotapi.CallbackQuery, text string) {
+	if _, err := Bot.AnswerCallbackQuery(tgbotapi.NewCallback(cb.ID, text)); err != nil {
+		logger.Printf("[ERROR] Callback: %s", err)
+	}
+}
@@ -2,53 +2,48 @@ package main
 
 import (
 	"fmt"
-	"strconv"
 )
 
 // check takes id[s] of torrent[s] or 'all' to verify them
-func check(tokens []string) {
+func check(s *session, tokens []string) {
 	// make sure that we got at least one argument
 	if len(tokens) == 0 {
-		send("check: needs an argument", false)
+		s.send("check: needs an argument", false)
 		return
 	}
 
-	torrents, err := rtorrent.Torrents()
+	torrents, err := s.torrents()
 	if err != nil {
 		logger.Print("check:", err)
-		send("check: "+err.Error(), false)
+		s.send("check: "+err.Error(), false)
 		return
 	}
 
 	// if the first argument is 'all' then start all torrents
 	if tokens[0] == "all" {
-		if err := rtorrent.Check(torrents...); err != nil {
-			logger.Print("check:", err)
-			send("check: error occurred while verifying some torrents", false)
-			return
-		}
-		send("hash checking all torrents", false)
+		askConfirmation(s, torrentsSummary("Check all", torrents, torrentIDs(torrents)), func() {
+			if err := rtorrent.Check(torrents...); err != nil {
+				logger.Print("check:", err)
+				s.send("check: error occurred while verifying some torrents", false)
+				return
+			}
+			s.send("hash checking all torrents", false)
+		})
 		return
-
 	}
 
 	for _, i := range tokens {
-		id, err := strconv.Atoi(i)
+		torrent, err := findTorrent(torrents, i)
 		if err != nil {
-			send(fmt.Sprintf("check: %s is not a number", i), false)
-			continue
-		}
-
-		if id >= len(torrents) || id < 0 {
-			send(fmt.Sprintf("Check: No torrent with an ID of '%d'", id), false)
+			s.send("Check: "+err.Error(), false)
 			continue
 		}
 
-		if err := rtorrent.Check(torrents[id]); err != nil {
+		if err := rtorrent.Check(torrent); err != nil {
 			logger.Print("Check:", err)
-			send("Check: "+err.Error(), false)
+			s.send("Check: "+err.Error(), false)
 			continue
 		}
-		send(fmt.Sprintf("Checking: %s", torrents[id].Name), false)
+		s.send(fmt.Sprintf("Checking: %s", torrent.Name), false)
 	}
 }
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// permission is what a user needs to be allowed to run a command.
+type permission int
+
+const (
+	permView    permission = iota // read-only commands, allowed for viewers and masters
+	permControl                   // commands that change rTorrent's state, allowed for masters only
+)
+
+func (p permission) String() string {
+	if p == permControl {
+		return "masters"
+	}
+	return "viewers and masters"
+}
+
+// command describes a bot command, the dispatcher and the help are generated from it.
+type command struct {
+	name    string
+	aliases []string
+	args    string // arguments spec, e.g. "<id> [id...]"
+	help    string
+	perm    permission
+	run     func(s *session, tokens []string)
+
+	// permFor, if set, returns the permission needed for the given arguments,
+	// for commands that can both show and change things
+	permFor func(tokens []string) permission
+	// controls names the arguments permFor asks permControl for, as shown by the help
+	controls string
+}
+
+// required returns the permission needed to run the command with the given arguments.
+func (c *command) required(tokens []string) permission {
+	if c.permFor != nil {
+		return c.permFor(tokens)
+	}
+	return c.perm
+}
+
+// usage returns the command name followed by its arguments spec.
+func (c *command) usage() string {
+	if c.args == "" {
+		return c.name
+	}
+	return c.name + " " + c.args
+}
+
+var (
+	// commands holds all the commands, in the order they are listed in the help.
+	commands []*command
+
+	// commandsIndex maps every command name and alias to its command.
+	commandsIndex = make(map[string]*command)
+)
+
+func init() {
+	register(
+		&command{
+			name: "list", aliases: []string{"li"}, args: "[tracker] [l:label]", perm: permView, run: list,
+			help: "Lists all the torrents, takes an optional argument which is a query to list only torrents that has a tracker matches the query, or some of it.",
+		},
+		&command{
+			name: "head", aliases: []string{"he"}, args: "[n] [l:label]", perm: permView, run: head,
+			help: "Lists the first n number of torrents, n defaults to 5 if no argument is provided.",
+		},
+		&command{
+			name: "tail", aliases: []string{"ta"}, args: "[n] [l:label]", perm: permView, run: tail,
+			help: "Lists the last n number of torrents, n defaults to 5 if no argument is provided.",
+		},
+		&command{
+			name: "down", aliases: []string{"dl"}, args: "[l:label]", perm: permView, run: downs,
+			help: "Lists torrents with the status of Downloading or in the queue to download.",
+		},
+		&command{
+			name: "seeding", aliases: []string{"sd"}, args: "[l:label]", perm: permView, run: seeding,
+			help: "Lists torrents with the status of Seeding or in the queue to seed.",
+		},
+		&command{
+			name: "paused", aliases: []string{"pa"}, args: "[l:label]", perm: permView, run: paused,
+			help: "Lists Paused torrents.",
+		},
+		&command{
+			name: "hashing", aliases: []string{"ha"}, args: "[l:label]", perm: permView, run: hashing,
+			help: "Lists torrents with the status of Hashing or in the queue to hash.",
+		},
+		&command{
+			name: "active", aliases: []string{"ac"}, args: "[l:label]", perm: permView, run: active,
+			help: "Lists torrents that are actively uploading or downloading.",
+		},
+		&command{
+			name: "errors", aliases: []string{"er"}, args: "[l:label]", perm: permView, run: errors,
+			help: "Lists torrents with with errors along with the error message.",
+		},
+		&command{
+			name: "sort", aliases: []string{"so"}, args: "[rev] <method>", perm: permView, run: sort,
+			help: "Manipulate the sorting of the aforementioned commands in this chat, Call it without arguments for more.",
+		},
+		&command{
+			name: "trackers", aliases: []string{"tr"}, perm: permView, run: trackers,
+			help: "Lists all the trackers along with the number of torrents.",
+		},
+		&command{
+			name: "add", aliases: []string{"ad"}, args: "<url|magnet> [url|magnet...]", perm: permControl,
+			run:  func(s *session, tokens []string) { add(s, tokens, "") },
+			help: "Takes one or many URLs or magnets to add them, You can send a .torrent file via Telegram to add it.",
+		},
+		&command{
+			name: "rss", args: "[add <name> <url> [include=RE] [exclude=RE] [min=SIZE] [max=SIZE] [d=DIR] [l=LABEL] [dedupe] | del <n> | check]", perm: permView, run: rssCmd, permFor: rssPerm, controls: "*add*, *del* and *check*",
+			help: "Shows and edits the RSS/Atom feeds that get polled for torrents to add, new items that match the include and exclude regular expressions and the size bounds get added to the directory and with the label of their feed. *dedupe* adds every episode only once. Editing is for masters only.",
+		},
+		&command{
+			name: "search", aliases: []string{"se"}, args: "<query> [l:label]", perm: permView, run: search,
+			help: "Takes a query and lists torrents with matching names.",
+		},
+		&command{
+			name: "latest", aliases: []string{"la"}, args: "[n] [l:label]", perm: permView, run: latest,
+			help: "Lists the newest n torrents, n defaults to 5 if no argument is provided.",
+		},
+		&command{
+			name: "info", aliases: []string{"in"}, args: "<id> [id...]", perm: permView, run: info,
+			help: "Takes one or more torrent's IDs to list more info about them, with buttons to start, stop, check or delete them.",
+		},
+		&command{
+			name: "files", aliases: []string{"fi"}, args: "<id> [page]", perm: permView, run: files,
+			help: "Lists the files of a torrent with their size, completion and priority.",
+		},
+		&command{
+			name: "fprio", aliases: []string{"fp"}, args: "<id> <indexes|all> <off|normal|high>", perm: permControl, run: fprio,
+			help: "Sets the priority of files inside a torrent, indexes are shown by *files*, e.g. _fprio <id> 0,3-5 off_ to skip some files.",
+		},
+		&command{
+			name: "peers", aliases: []string{"pe"}, args: "<id>", perm: permView, run: peers,
+			help: "Lists the peers of a torrent with their client, progress, rates and flags (E: encrypted, I: incoming, S: snubbed).",
+		},
+		&command{
+			name: "tracker", aliases: []string{"tk"}, args: "<id> [add <url> | disable <n> | enable <n>]", perm: permView, run: trackerCmd, permFor: trackerPerm, controls: "*add*, *disable* and *enable*",
+			help: "Lists every tracker of a torrent with its status, seeders, leechers, last announce and last error, or adds, disables or enables one (masters only).",
+		},
+		&command{
+			name: "reannounce", aliases: []string{"ra"}, args: "<id|all> [id...]", perm: permControl, run: reannounce,
+			help: "Takes one or more torrent's IDs, or _all_, to announce them to their trackers now.",
+		},
+		&command{
+			name: "retrack", args: "<pattern> <new url>", perm: permControl, run: retrack,
+			help: "Replaces the tracker URLs that match a regular expression in all the torrents, e.g. after a passkey change, the new URL may refer to the groups of the pattern like $1. Shows the changes and asks for a confirmation, then disables the old trackers, adds the new ones and reannounces.",
+		},
+		&command{
+			name: "label", aliases: []string{"lb"}, args: "<id> [id...] <label>", perm: permControl, run: label,
+			help: "Sets the label of torrents, labels are shared with ruTorrent.",
+		},
+		&command{
+			name: "unlabel", aliases: []string{"ul"}, args: "<id> [id...]", perm: permControl, run: unlabel,
+			help: "Removes the label of torrents.",
+		},
+		&command{
+			name: "labels", aliases: []string{"lbs"}, perm: permView, run: labels,
+			help: "Lists all the labels with how many torrents, their size and ratio.",
+		},
+		&command{
+			name: "move", aliases: []string{"mv"}, args: "<id> [id...] <dir>", perm: permControl, run: move,
+			help: "Moves the data of torrents to another directory, '~' gets expanded and the directory gets created if it isn't there. Torrents get stopped while moving, and started again if they were running.",
+		},
+		&command{
+			name: "stop", aliases: []string{"sp"}, args: "<id|all> [id...]", perm: permControl, run: stop,
+			help: "Takes one or more torrent's IDs to stop them, or _all_ to stop all torrents after a confirmation.",
+		},
+		&command{
+			name: "start", aliases: []string{"st"}, args: "<id|all> [id...]", perm: permControl, run: start,
+			help: "Takes one or more torrent's IDs to start them, or _all_ to start all torrents.",
+		},
+		&command{
+			name: "check", aliases: []string{"ck"}, args: "<id|all> [id...]", perm: permControl, run: check,
+			help: "Takes one or more torrent's IDs to verify them, or _all_ to verify all torrents after a confirmation.",
+		},
+		&command{
+			name: "del", args: "<id> [id...] [force]", perm: permControl, run: del,
+			help: "Takes one or more torrent's IDs to delete them, after a confirmation. Torrents that haven't met the hit and run requirements of their trackers are refused unless *force* is given.",
+		},
+		&command{
+			name: "deldata", args: "<id> [id...] [force]", perm: permControl, run: deldata,
+			help: "Takes one or more torrent's IDs to delete them and their data, after a confirmation. Torrents that haven't met the hit and run requirements of their trackers are refused unless *force* is given.",
+		},
+		&command{
+			name: "confirm", args: "<code>", perm: permControl, run: confirm,
+			help: "Takes the code sent by *del*, *deldata*, *stop all* or *check all* to confirm them.",
+		},
+		&command{
+			name: "stats", aliases: []string{"sa"}, perm: permView, run: stats,
+			help: "Shows some stats.",
+		},
+		&command{
+			name: "speed", aliases: []string{"ss"}, perm: permView, run: speed,
+			help: "Shows the upload and download speeds.",
+		},
+		&command{
+			name: "throttle", aliases: []string{"th"}, args: "[up|down] <limit> | <up limit> <down limit>", perm: permControl, run: throttle,
+			help: "Sets the global upload/download limits, e.g. _throttle down 2M_, _throttle up off_ or _throttle 500K 1M_ for both, shows the limits without arguments.",
+		},
+		&command{
+			name: "turtle", aliases: []string{"tu"}, perm: permControl, run: turtle,
+			help: "Flips the global limits between the normal and the turtle presets.",
+		},
+		&command{
+			name: "schedule", aliases: []string{"sc"}, args: "[on|off | add <name> <days> <HH:MM-HH:MM> <up> <down> | del <n>]", perm: permControl, run: scheduleCmd,
+			help: "Shows or edits the bandwidth schedule, which applies throttle profiles by time of the day and weekday, e.g. _schedule add night mon-fri 22:00-07:00 100K 1M_.",
+		},
+		&command{
+			name: "rules", aliases: []string{"ru"}, args: "[add <global|tracker:host|label:name> [ratio=R] [time=T] <stop|del|deldata> | del <n>]", perm: permView, run: rulesCmd, permFor: rulesPerm, controls: "*add* and *del*",
+			help: "Shows and edits the seeding rules, complete torrents that reach the ratio or the seeding time of a rule get stopped or deleted, e.g. *rules add global ratio=2 time=14d stop*. Label rules override tracker rules, which override global rules. Editing is for masters only.",
+		},
+		&command{
+			name: "hnr", args: "[reqs | add <tracker> [ratio=R] [time=T] | del <n>]", perm: permView, run: hnrCmd, permFor: hnrPerm, controls: "*add* and *del*",
+			help: "Lists the torrents that would get a hit and run if deleted now, *reqs* shows the minimum ratio or seeding time of each tracker, e.g. *hnr add tracker.example.org ratio=1 time=3d*. Editing is for masters only.",
+		},
+		&command{
+			name: "disk", aliases: []string{"du"}, perm: permView, run: disk,
+			help: "Shows the space of the filesystems that hold torrent data, what the torrents take per label and per tracker, and what is left to download.",
+		},
+		&command{
+			name: "count", aliases: []string{"co"}, perm: permView, run: count,
+			help: "Shows the torrents counts per status.",
+		},
+		&command{
+			name: "live", args: "[on|off]", perm: permView, run: live,
+			help: "Toggles the live updates of the messages in this chat, shows the current state without arguments.",
+		},
+		&command{
+			name: "notify", args: "[event] <on|off>", perm: permView, run: notify,
+			help: "Toggles the notifications in this chat, all of them or one event of: completed, added, removed, errored, stalled, schedule. Shows the current state without arguments.",
+		},
+		&command{
+			name: "help", args: "[command]", perm: permView, run: help,
+			help: "Shows this help message, or the details of a command.",
+		},
+		&command{
+			name: "version", perm: permView, run: getVersion,
+			help: "Shows version numbers.",
+		},
+	)
+}
+
+// register adds commands to the registry, panics on duplicate names or aliases.
+func register(cmds ...*command) {
+	for _, cmd := range cmds {
+		for _, name := range append([]string{cmd.name}, cmd.aliases...) {
+			if _, ok := commandsIndex[name]; ok {
+				panic("register: duplicate command name: " + name)
+			}
+			commandsIndex[name] = cmd
+		}
+		commands = append(commands, cmd)
+	}
+}
+
+// lookupCommand takes the first token of a message, e.g. "/list@mybot" and returns its command.
+func lookupCommand(token string) (*command, bool) {
+	token = strings.ToLower(token)
+	token = strings.TrimPrefix(token, "/")
+	// in groups, commands may get suffixed with '@botname'
+	if i := strings.IndexByte(token, '@'); i != -1 {
+		token = token[:i]
+	}
+
+	cmd, ok := commandsIndex[token]
+	return cmd, ok
+}
+
+// help sends the list of commands, or the details of one if it gets a command name.
+func help(s *session, tokens []string) {
+	if len(tokens) > 0 {
+		cmd, ok := lookupCommand(tokens[0])
+		if !ok {
+			s.send(fmt.Sprintf("help: no such command: %s", tokens[0]), false)
+			return
+		}
+
+		buf := new(bytes.Buffer)
+		buf.WriteString(fmt.Sprintf("`%s`\n\n", cmd.usage()))
+		buf.WriteString(cmd.help + "\n\n")
+		if len(cmd.aliases) > 0 {
+			buf.WriteString(fmt.Sprintf("Aliases: *%s*\n", strings.Join(cmd.aliases, "*, *")))
+		}
+		buf.WriteString(fmt.Sprintf("Allowed for: %s", cmd.perm))
+		if cmd.permFor != nil {
+			buf.WriteString(fmt.Sprintf(", %s for %s only", cmd.controls, permControl))
+		}
+		s.send(buf.String(), true)
+		return
+	}
+
+	buf := new(bytes.Buffer)
+	for _, cmd := range commands {
+		buf.WriteString("*" + cmd.name + "*")
+		for _, alias := range cmd.aliases {
+			buf.WriteString(" or *" + alias + "*")
+		}
+		buf.WriteString("\n" + cmd.help + "\n\n")
+	}
+
+	buf.WriteString("- Torrent IDs are the short hashes shown between <> by the listing commands, indexes still work as a fallback.\n")
+	buf.WriteString("- Listing commands take an optional *l:<label>* argument to list only the torrents of a label, *l:* alone lists the unlabeled ones.\n")
+	buf.WriteString("- Use *help <command>* to see the arguments of a command.\n")
+	buf.WriteString("- Prefix commands with '/' if you want to talk to your bot in a group.\n")
+	buf.WriteString("- report any issues [here](https://github.com/pyed/rtelegram)")
+	s.send(buf.String(), true)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestLookupCommand(t *testing.T) {
+	tests := map[string]string{
+		"list":         "list",
+		"/li":          "list",
+		"LI":           "list",
+		"/list@mybot":  "list",
+		"/HA@MyBot":    "hashing",
+		"hashing":      "hashing",
+		"dl":           "down",
+		"/deldata":     "deldata",
+		"help@somebot": "help",
+	}
+	for token, want := range tests {
+		cmd, ok := lookupCommand(token)
+		if !ok {
+			t.Errorf("lookupCommand(%q): not found, want %s", token, want)
+			continue
+		}
+		if cmd.name != want {
+			t.Errorf("lookupCommand(%q) = %s, want %s", token, cmd.name, want)
+		}
+	}
+
+	for _, token := range []string{"", "/", "checking", "ch", "@mybot"} {
+		if cmd, ok := lookupCommand(token); ok {
+			t.Errorf("lookupCommand(%q) = %s, want none", token, cmd.name)
+		}
+	}
+}
+
+// the aliases of the old switch have to keep working
+func TestCommandAliases(t *testing.T) {
+	aliases := []string{
+		"li", "he", "ta", "dl", "sd", "pa", "ha", "ac", "er", "so", "tr", "ad",
+		"se", "la", "in", "sp", "st", "ck", "sa", "ss", "co",
+	}
+	for _, alias := range aliases {
+		if _, ok := commandsIndex[alias]; !ok {
+			t.Errorf("alias %q isn't registered", alias)
+		}
+	}
+
+	for _, cmd := range commands {
+		if cmd.help == "" {
+			t.Errorf("%s has no help", cmd.name)
+		}
+		if cmd.run == nil {
+			t.Errorf("%s has nothing to run", cmd.name)
+		}
+	}
+}
+
+func TestCommandPermissions(t *testing.T) {
+	tests := []struct {
+		command string
+		args    []string
+		want    permission
+	}{
+		{"list", nil, permView},
+		{"del", []string{"abcdef"}, permControl},
+		{"rss", nil, permView},
+		{"rss", []string{"del", "1"}, permControl},
+		{"tracker", []string{"abcdef"}, permView},
+		{"tracker", []string{"abcdef", "disable", "1"}, permControl},
+		{"hnr", []string{"reqs"}, permView},
+		{"hnr", []string{"add", "tracker.example"}, permControl},
+	}
+	for _, tt := range tests {
+		cmd, _ := lookupCommand(tt.command)
+		if got := cmd.required(tt.args); got != tt.want {
+			t.Errorf("%s %v: requires %s, want %s", tt.command, tt.args, got, tt.want)
+		}
+	}
+
+	// the help of the commands that depend on their arguments tells which need control
+	tg := startFakeTelegram(t)
+	for _, cmd := range commands {
+		if cmd.permFor == nil {
+			continue
+		}
+		if cmd.controls == "" {
+			t.Errorf("%s depends on its arguments but its help doesn't tell which", cmd.name)
+		}
+		help(&session{chatID: 1}, []string{cmd.name})
+		want := fmt.Sprintf("Allowed for: viewers and masters, %s for masters only", cmd.controls)
+		if sent := tg.sent("sendMessage"); len(sent) != 1 || !strings.HasSuffix(sent[0].Get("text"), want) {
+			t.Errorf("help %s: %v, want it to end with %q", cmd.name, sent, want)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	humanize "github.com/pyed/go-humanize"
+	"github.com/pyed/rtapi"
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+const (
+	// confirmTimeout is how long a destructive action waits for a confirmation.
+	confirmTimeout = 2 * time.Minute
+
+	// summaryMax is how long the list of torrents in a summary gets, leaving room under Telegram's
+	// 4096 characters for warnings and how to confirm.
+	summaryMax = 3000
+)
+
+// confirmation is a destructive action waiting to be confirmed.
+type confirmation struct {
+	session *session // the session that asked for it
+	action  func()
+	expires time.Time
+}
+
+var (
+	confirmations   = make(map[string]*confirmation)
+	confirmationsMu sync.Mutex
+)
+
+// askConfirmation sends the summary of a destructive action with Confirm/Cancel buttons,
+// action runs only if confirmed via a button or "confirm <code>" before 'confirmTimeout'.
+func askConfirmation(s *session, summary string, action func()) {
+	code, err := addConfirmation(s, action)
+	if err != nil {
+		logger.Print("confirm:", err)
+		s.send("confirm: "+err.Error(), false)
+		return
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("✔ Confirm", cbConfirm+":"+code),
+			tgbotapi.NewInlineKeyboardButtonData("✖ Cancel", cbCancel+":"+code),
+		),
+	)
+
+	text := fmt.Sprintf("%s\nSend *confirm %s* or use the buttons within %s.", summary, code, confirmTimeout)
+	s.sendWithKeyboard(text, true, &keyboard)
+}
+
+// addConfirmation makes action wait for a confirmation of the session, and returns its code.
+func addConfirmation(s *session, action func()) (string, error) {
+	confirmationsMu.Lock()
+	defer confirmationsMu.Unlock()
+
+	// drop the expired ones while we are at it
+	for c, pending := range confirmations {
+		if time.Now().After(pending.expires) {
+			delete(confirmations, c)
+		}
+	}
+
+	b := make([]byte, 3)
+	for {
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+		if code := hex.EncodeToString(b); confirmations[code] == nil {
+			confirmations[code] = &confirmation{session: s, action: action, expires: time.Now().Add(confirmTimeout)}
+			return code, nil
+		}
+	}
+}
+
+// takeConfirmation removes and returns the pending confirmation with the given code,
+// returns nil if there's none, if it has expired, or if it belongs to another chat.
+func takeConfirmation(s *session, code string) *confirmation {
+	confirmationsMu.Lock()
+	defer confirmationsMu.Unlock()
+
+	pending, ok := confirmations[code]
+	if !ok || pending.session != s {
+		return nil
+	}
+	delete(confirmations, code)
+
+	if time.Now().After(pending.expires) {
+		return nil
+	}
+	return pending
+}
+
+// confirm takes a confirmation code to run the pending action
+func confirm(s *session, tokens []string) {
+	if len(tokens) == 0 {
+		s.send("confirm: needs a confirmation code", false)
+		return
+	}
+
+	pending := takeConfirmation(s, strings.ToLower(tokens[0]))
+	if pending == nil {
+		s.send(fmt.Sprintf("confirm: no pending action with the code '%s', it may have expired", tokens[0]), false)
+		return
+	}
+	pending.action()
+}
+
+// torrentsSummary lists the name, size and hash of torrents as markdown, used when asking for confirmations,
+// the torrents past 'summaryMax' are only counted.
+func torrentsSummary(title string, torrents rtapi.Torrents, ids map[string]string) string {
+	buf := new(bytes.Buffer)
+	buf.WriteString(fmt.Sprintf("*%s* (%d):\n", title, len(torrents)))
+
+	var total uint64
+	var more int
+	for _, torrent := range torrents {
+		total += torrent.Size
+		torrentName := mdReplacer.Replace(torrent.Name) // escape markdown
+		line := fmt.Sprintf("`<%s>` %s\n*%s* `%s`\n", ids[torrent.Hash], torrentName,
+			humanize.IBytes(torrent.Size), torrent.Hash)
+		if more > 0 || buf.Len()+len(line) > summaryMax {
+			more++
+			continue
+		}
+		buf.WriteString(line)
+	}
+	if more > 0 {
+		buf.WriteString(fmt.Sprintf("+%d more\n", more))
+	}
+	buf.WriteString(fmt.Sprintf("Total: *%s*\n", humanize.IBytes(total)))
+	return buf.String()
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pyed/rtapi"
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// withConfirmations runs the test with no pending confirmations.
+func withConfirmations(t *testing.T) {
+	saved := confirmations
+	t.Cleanup(func() { confirmations = saved })
+	confirmations = make(map[string]*confirmation)
+}
+
+func TestConfirmationCodes(t *testing.T) {
+	withConfirmations(t)
+	s, other := &session{chatID: 1}, &session{chatID: 2}
+
+	hexCode := regexp.MustCompile(`^[0-9a-f]{6}$`)
+	codes := make(map[string]bool)
+	for i := 0; i < 200; i++ {
+		code, err := addConfirmation(s, func() {})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !hexCode.MatchString(code) || codes[code] {
+			t.Fatalf("code %q: not 6 hex digits, or given twice", code)
+		}
+		codes[code] = true
+	}
+
+	ran := false
+	code, _ := addConfirmation(s, func() { ran = true })
+	if takeConfirmation(other, code) != nil {
+		t.Error("another chat took the confirmation")
+	}
+	confirm(s, []string{strings.ToUpper(code)})
+	if !ran {
+		t.Error("confirm didn't run the action")
+	}
+	if takeConfirmation(s, code) != nil {
+		t.Error("the confirmation can be taken twice")
+	}
+}
+
+func TestConfirmationExpiry(t *testing.T) {
+	withConfirmations(t)
+	s := &session{chatID: 1}
+
+	expired, _ := addConfirmation(s, func() { t.Error("an expired action ran") })
+	confirmations[expired].expires = time.Now().Add(-time.Second)
+	if takeConfirmation(s, expired) != nil {
+		t.Error("took an expired confirmation")
+	}
+
+	// the expired ones are dropped when a new one is added
+	expired, _ = addConfirmation(s, func() {})
+	confirmations[expired].expires = time.Now().Add(-time.Second)
+	addConfirmation(s, func() {})
+	if _, ok := confirmations[expired]; ok || len(confirmations) != 1 {
+		t.Errorf("%d pending confirmations, want only the new one", len(confirmations))
+	}
+}
+
+func TestCancelConfirmation(t *testing.T) {
+	withConfirmations(t)
+	tg := startFakeTelegram(t)
+	s := &session{chatID: 1}
+
+	code, _ := addConfirmation(s, func() { t.Error("a cancelled action ran") })
+	cb := &tgbotapi.CallbackQuery{ID: "1", Message: &tgbotapi.Message{MessageID: 7, Chat: &tgbotapi.Chat{ID: 1}}}
+	handleConfirmation(s, cb, cbCancel, code)
+
+	if answers := tg.sent("answerCallbackQuery"); len(answers) != 1 || answers[0].Get("text") != "Cancelled" {
+		t.Errorf("answers %v, want Cancelled", answers)
+	}
+	if len(confirmations) != 0 {
+		t.Error("the cancelled confirmation is still pending")
+	}
+
+	// the buttons of the cancelled message are gone, confirming it does nothing
+	handleConfirmation(s, cb, cbConfirm, code)
+	if answers := tg.sent("answerCallbackQuery"); len(answers) != 1 || !strings.HasPrefix(answers[0].Get("text"), "No pending action") {
+		t.Errorf("answers %v, want no pending action", answers)
+	}
+}
+
+func TestTorrentsSummary(t *testing.T) {
+	var torrents rtapi.Torrents
+	ids := make(map[string]string)
+	for i := 0; i < 300; i++ {
+		hash := fmt.Sprintf("%040X", i)
+		torrents = append(torrents, &rtapi.Torrent{Name: strings.Repeat("name ", 10), Hash: hash, Size: 1 << 20})
+		ids[hash] = fmt.Sprint(i)
+	}
+
+	summary := torrentsSummary("Stop all", torrents, ids)
+	if len(summary) > summaryMax+100 {
+		t.Errorf("summary of %d bytes", len(summary))
+	}
+	shown := strings.Count(summary, "`<")
+	if shown == 0 || !strings.Contains(summary, fmt.Sprintf("\n+%d more\n", 300-shown)) {
+		t.Errorf("%d torrents shown, and no count of the others in %q", shown, summary[len(summary)-100:])
+	}
+	if !strings.HasPrefix(summary, "*Stop all* (300):") || !strings.HasSuffix(summary, "Total: *300 MiB*\n") {
+		t.Errorf("summary %q..%q, want all the torrents counted", summary[:30], summary[len(summary)-30:])
+	}
+
+	// short lists are shown whole
+	if summary := torrentsSummary("Delete", torrents[:2], ids); strings.Contains(summary, "more") || strings.Count(summary, "`<") != 2 {
+		t.Errorf("summary of two torrents %q", summary)
+	}
+}
+
+func TestDelSameTorrentTwice(t *testing.T) {
+	withConfirmations(t)
+	startFakeRtorrent(t, fakeTorrent{name: "a", hash: "AAAA0000", size: 1, completed: 1})
+	tg := startFakeTelegram(t)
+
+	del(&session{chatID: 1}, []string{"aaaa00", "0"})
+	messages := tg.sent("sendMessage")
+	if len(messages) != 1 || !strings.HasPrefix(messages[0].Get("text"), "*Delete* (1):") {
+		t.Errorf("sent %v, want one torrent to confirm", messages)
+	}
+}
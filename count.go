@@ -6,37 +6,33 @@ import (
 	"github.com/pyed/rtapi"
 )
 
+// torrentStates are the states torrents get counted by, in the order 'count' shows them
+var torrentStates = []string{rtapi.Leeching, rtapi.Seeding, rtapi.Complete, rtapi.Stopped, rtapi.Hashing, rtapi.Error}
+
+// countStates returns how many torrents are in each state
+func countStates(torrents rtapi.Torrents) map[string]int {
+	counts := make(map[string]int, len(torrentStates))
+	for i := range torrents {
+		counts[torrents[i].State]++
+	}
+	return counts
+}
+
 // count returns current torrents count per status
-func count() {
-	torrents, err := rtorrent.Torrents()
+func count(s *session, tokens []string) {
+	torrents, err := s.torrents()
 	if err != nil {
 		logger.Print("count:", err)
-		send("count: "+err.Error(), false)
+		s.send("count: "+err.Error(), false)
 		return
 	}
 
-	var Leeching, Seeding, Complete, Stopped, Hashing, Error int
-
-	for i := range torrents {
-		switch torrents[i].State {
-		case rtapi.Leeching:
-			Leeching++
-		case rtapi.Seeding:
-			Seeding++
-		case rtapi.Complete:
-			Complete++
-		case rtapi.Stopped:
-			Stopped++
-		case rtapi.Hashing:
-			Hashing++
-		case rtapi.Error:
-			Error++
-		}
-	}
+	counts := countStates(torrents)
 
 	msg := fmt.Sprintf("Leeching: *%d*\nSeeding: *%d*\nComplete: *%d*\nStopped: *%d*\nHashing: *%d*\nError: *%d*\n\nTotal: *%d*",
-		Leeching, Seeding, Complete, Stopped, Hashing, Error, len(torrents))
+		counts[rtapi.Leeching], counts[rtapi.Seeding], counts[rtapi.Complete], counts[rtapi.Stopped],
+		counts[rtapi.Hashing], counts[rtapi.Error], len(torrents))
 
-	send(msg, true)
+	s.send(msg, true)
 
 }
@@ -2,44 +2,87 @@ package main
 
 import (
 	"fmt"
-	"strconv"
+	"slices"
+
+	"github.com/pyed/rtapi"
 )
 
-// del takes an id or more, and delete the corresponding torrent/s
-func del(tokens []string) {
+// del takes an id or more, and delete the corresponding torrent/s after a confirmation
+func del(s *session, tokens []string) {
+	tokens, force := withoutForce(tokens)
+
 	// make sure that we got an argument
 	if len(tokens) == 0 {
-		send("del: needs an ID", false)
+		s.send("del: needs an ID", false)
 		return
 	}
 
-	torrents, err := rtorrent.Torrents()
+	torrents, err := s.torrents()
 	if err != nil {
 		logger.Print("del:", err)
-		send("del: "+err.Error(), false)
+		s.send("del: "+err.Error(), false)
 		return
 	}
 
 	// loop over tokens to read each potential id
+	var toDelete rtapi.Torrents
 	for _, i := range tokens {
-		id, err := strconv.Atoi(i)
+		torrent, err := findTorrent(torrents, i)
 		if err != nil {
-			send(fmt.Sprintf("del: %s is not an ID", i), false)
+			s.send("del: "+err.Error(), false)
 			continue
 		}
-
-		if id < 0 || id >= len(torrents) {
-			send(fmt.Sprintf("del: No torrent with an ID of '%d'", id), false)
-			continue
+		// the same torrent may be given twice, e.g. by its hash and its index
+		if !slices.Contains(toDelete, torrent) {
+			toDelete = append(toDelete, torrent)
 		}
+	}
 
-		if err := rtorrent.Delete(false, torrents[id]); err != nil {
-			logger.Print("del:", err)
-			send("del: "+err.Error(), false)
+	if len(toDelete) == 0 {
+		return
+	}
+
+	ids := torrentIDs(torrents)
+	warning, ok := hnrGuard(s, "del", toDelete, ids, force)
+	if !ok {
+		return
+	}
+
+	askConfirmation(s, torrentsSummary("Delete", toDelete, ids)+warning, func() {
+		deleteTorrents(s, false, toDelete)
+	})
+}
+
+// deleteTorrents deletes torrents, with their data if withData is true, and reports each one
+func deleteTorrents(s *session, withData bool, torrents rtapi.Torrents) {
+	cmd, done := "del", "Deleted"
+	if withData {
+		cmd, done = "deldata", "Deleted with data"
+	}
+
+	for _, result := range removeTorrents(withData, torrents) {
+		if result.err != nil {
+			logger.Print(cmd+":", result.err)
+			s.send(cmd+": "+result.err.Error(), false)
 			continue
 		}
 
-		send(fmt.Sprintf("Deleted: %s", torrents[id].Name), false)
+		s.send(fmt.Sprintf("%s: %s", done, result.torrent.Name), false)
+	}
+}
+
+// removeResult is the outcome of removing a torrent.
+type removeResult struct {
+	torrent *rtapi.Torrent
+	err     error
+}
 
+// removeTorrents deletes torrents one by one, with their data if withData is true, so one failing
+// doesn't stop the others, the commands, the buttons and the API all delete through it
+func removeTorrents(withData bool, torrents rtapi.Torrents) []removeResult {
+	results := make([]removeResult, len(torrents))
+	for i, torrent := range torrents {
+		results[i] = removeResult{torrent: torrent, err: rtorrent.Delete(withData, torrent)}
 	}
+	return results
 }
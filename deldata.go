@@ -1,44 +1,53 @@
 package main
 
 import (
-	"fmt"
-	"strconv"
+	"slices"
+
+	"github.com/pyed/rtapi"
 )
 
-// deldata takes an id or more, and delete the corresponding torrent/s with their data
-func deldata(tokens []string) {
+// deldata takes an id or more, and delete the corresponding torrent/s with their data after a confirmation
+func deldata(s *session, tokens []string) {
+	tokens, force := withoutForce(tokens)
+
 	// make sure that we got an argument
 	if len(tokens) == 0 {
-		send("deldata: needs an ID", false)
+		s.send("deldata: needs an ID", false)
 		return
 	}
 
-	torrents, err := rtorrent.Torrents()
+	torrents, err := s.torrents()
 	if err != nil {
 		logger.Print("deldata:", err)
-		send("deldata: "+err.Error(), false)
+		s.send("deldata: "+err.Error(), false)
 		return
 	}
 
 	// loop over tokens to read each potential id
+	var toDelete rtapi.Torrents
 	for _, i := range tokens {
-		id, err := strconv.Atoi(i)
+		torrent, err := findTorrent(torrents, i)
 		if err != nil {
-			send(fmt.Sprintf("deldata: %s is not an ID", i), false)
+			s.send("deldata: "+err.Error(), false)
 			continue
 		}
-
-		if id < 0 || id >= len(torrents) {
-			send(fmt.Sprintf("deldata: No torrent with an ID of '%d'", id), false)
-			continue
+		// the same torrent may be given twice, e.g. by its hash and its index
+		if !slices.Contains(toDelete, torrent) {
+			toDelete = append(toDelete, torrent)
 		}
+	}
 
-		if err := rtorrent.Delete(true, torrents[id]); err != nil {
-			logger.Print("deldata:", err)
-			send("deldata: "+err.Error(), false)
-			continue
-		}
+	if len(toDelete) == 0 {
+		return
+	}
 
-		send(fmt.Sprintf("Deleted with data: %s", torrents[id].Name), false)
+	ids := torrentIDs(torrents)
+	warning, ok := hnrGuard(s, "deldata", toDelete, ids, force)
+	if !ok {
+		return
 	}
+
+	askConfirmation(s, torrentsSummary("Delete with data", toDelete, ids)+warning, func() {
+		deleteTorrents(s, true, toDelete)
+	})
 }
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"path/filepath"
+	"slices"
+
+	humanize "github.com/pyed/go-humanize"
+	"github.com/pyed/rtapi"
+)
+
+// diskGroup is a filesystem that holds torrent data, and what the torrents take on it.
+type diskGroup struct {
+	dir       string // the first download directory found on it
+	total     uint64
+	used      uint64
+	free      uint64
+	known     bool // whether the filesystem could be checked from here
+	torrents  int
+	taken     uint64
+	pending   uint64 // left to download for the incomplete torrents
+	byLabel   map[string]uint64
+	byTracker map[string]uint64
+}
+
+// torrentDirs returns the directory every torrent downloads to, by hash, it works for
+// closed torrents too unlike d.base_path.
+func torrentDirs() (map[string]string, error) {
+	result, err := rtCall("d.multicall2", "", "main", "d.hash=", "d.directory=", "d.is_multi_file=")
+	if err != nil {
+		return nil, err
+	}
+
+	dirs := make(map[string]string)
+	for _, row := range rtList(result) {
+		fields := rtList(row)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("d.multicall2: expected 3 fields, got %d", len(fields))
+		}
+		dir := rtString(fields[1])
+		// d.directory of multi-file torrents is their own directory
+		if rtInt(fields[2]) == 1 {
+			dir = filepath.Dir(dir)
+		}
+		dirs[rtString(fields[0])] = dir
+	}
+	return dirs, nil
+}
+
+// disk shows total, used and free space of every filesystem that holds torrent data, with how much of
+// it the torrents take per label and per tracker, and how much is still pending download
+func disk(s *session, tokens []string) {
+	torrents, err := s.torrents()
+	if err != nil {
+		logger.Print("disk:", err)
+		s.send("disk: "+err.Error(), false)
+		return
+	}
+
+	dirs, err := torrentDirs()
+	if err != nil {
+		logger.Print("disk:", err)
+		s.send("disk: "+err.Error(), false)
+		return
+	}
+
+	groups := groupByDisk(torrents, dirs)
+	if len(groups) == 0 {
+		s.send("disk: No torrents", false)
+		return
+	}
+
+	buf := new(bytes.Buffer)
+	for _, g := range groups {
+		buf.WriteString(fmt.Sprintf("`%s`\n", g.dir))
+		if g.known {
+			buf.WriteString(fmt.Sprintf("Total: *%s* Used: *%s* Free: *%s*\n",
+				humanize.IBytes(g.total), humanize.IBytes(g.used), humanize.IBytes(g.free)))
+		} else {
+			buf.WriteString("Not on this machine, no capacity to show\n")
+		}
+		buf.WriteString(fmt.Sprintf("*%d* torrent(s) take *%s*, pending download: *%s*\n",
+			g.torrents, humanize.IBytes(g.taken), humanize.IBytes(g.pending)))
+		if g.known && g.pending > g.free {
+			buf.WriteString("⚠ not enough free space for the pending downloads\n")
+		}
+
+		buf.WriteString("\nBy label:\n")
+		writeSizes(buf, g.byLabel)
+		buf.WriteString("\nBy tracker:\n")
+		writeSizes(buf, g.byTracker)
+		buf.WriteString("\n")
+	}
+	s.send(buf.String(), true)
+}
+
+// groupByDisk groups the torrents by the filesystem their directory is on, dirs maps their hashes
+// to their directories, torrents without one are left out
+func groupByDisk(torrents rtapi.Torrents, dirs map[string]string) []*diskGroup {
+	var groups []*diskGroup
+	byFS := make(map[string]*diskGroup)
+	for _, torrent := range torrents {
+		dir := dirs[torrent.Hash]
+		if dir == "" {
+			continue
+		}
+
+		// directories that aren't on this machine are grouped by themselves
+		fs, err := filesystemID(dir)
+		if err != nil {
+			fs = "dir:" + dir
+		}
+
+		g, ok := byFS[fs]
+		if !ok {
+			g = &diskGroup{dir: dir, byLabel: make(map[string]uint64), byTracker: make(map[string]uint64)}
+			if total, used, free, err := diskUsage(dir); err == nil {
+				g.total, g.used, g.free, g.known = total, used, free, true
+			}
+			byFS[fs] = g
+			groups = append(groups, g)
+		}
+
+		g.torrents++
+		g.taken += torrent.Completed
+		if torrent.Completed < torrent.Size {
+			g.pending += torrent.Size - torrent.Completed
+		}
+
+		label := labelName(torrent)
+		if label == "" {
+			label = noLabel
+		}
+		g.byLabel[label] += torrent.Completed
+		g.byTracker[torrent.Tracker.Hostname()] += torrent.Completed
+	}
+
+	return groups
+}
+
+// writeSizes writes the sizes, the biggest first
+func writeSizes(buf *bytes.Buffer, sizes map[string]uint64) {
+	names := make([]string, 0, len(sizes))
+	for name := range sizes {
+		names = append(names, name)
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		return cmp.Or(cmp.Compare(sizes[b], sizes[a]), cmp.Compare(a, b))
+	})
+
+	for _, name := range names {
+		buf.WriteString(fmt.Sprintf("%s *%s*\n", mdReplacer.Replace(name), humanize.IBytes(sizes[name])))
+	}
+}
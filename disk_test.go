@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/pyed/rtapi"
+)
+
+func TestTorrentDirs(t *testing.T) {
+	startFakeRtorrent(t,
+		fakeTorrent{hash: "AAAA", path: "/data/tv/pack", multiFile: true},
+		fakeTorrent{hash: "BBBB", path: "/data/movies/film.mkv"},
+	)
+
+	dirs, err := torrentDirs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"AAAA": "/data/tv", "BBBB": "/data/movies"}
+	if !reflect.DeepEqual(dirs, want) {
+		t.Errorf("torrentDirs() = %v, want %v", dirs, want)
+	}
+}
+
+func TestGroupByDisk(t *testing.T) {
+	local, other := t.TempDir(), t.TempDir()
+	missing := filepath.Join(local, "not", "here")
+	tracker := func(host string) *url.URL { return &url.URL{Scheme: "https", Host: host, Path: "/announce"} }
+
+	torrents := rtapi.Torrents{
+		{Hash: "A", Size: 100, Completed: 100, Label: "tv", Tracker: tracker("one.example")},
+		{Hash: "B", Size: 100, Completed: 40, Label: "Live%20TV", Tracker: tracker("two.example")},
+		{Hash: "C", Size: 50, Completed: 50, Tracker: tracker("one.example")},
+		{Hash: "D", Size: 10, Completed: 0, Tracker: tracker("one.example")},
+		{Hash: "E", Size: 30, Completed: 30, Tracker: tracker("one.example")},
+		{Hash: "F", Size: 1, Completed: 1, Tracker: tracker("one.example")}, // closed, no directory
+	}
+	dirs := map[string]string{"A": local, "B": other, "C": local, "D": missing, "E": missing}
+
+	groups := groupByDisk(torrents, dirs)
+	if len(groups) != 2 {
+		t.Fatalf("got %d groups, want the local filesystem and the missing directory", len(groups))
+	}
+
+	// both temporary directories are on the same filesystem
+	g := groups[0]
+	if g.dir != local || !g.known || g.total == 0 || g.free > g.total {
+		t.Errorf("local group: dir %q, known %t, total %d, free %d", g.dir, g.known, g.total, g.free)
+	}
+	if g.torrents != 3 || g.taken != 190 || g.pending != 60 {
+		t.Errorf("local group: %d torrents take %d, %d pending, want 3 taking 190 with 60 pending",
+			g.torrents, g.taken, g.pending)
+	}
+	if want := map[string]uint64{"tv": 100, "Live TV": 40, noLabel: 50}; !reflect.DeepEqual(g.byLabel, want) {
+		t.Errorf("local group: by label %v, want %v", g.byLabel, want)
+	}
+	if want := map[string]uint64{"one.example": 150, "two.example": 40}; !reflect.DeepEqual(g.byTracker, want) {
+		t.Errorf("local group: by tracker %v, want %v", g.byTracker, want)
+	}
+
+	// a directory that can't be checked is a group by itself, without a capacity
+	g = groups[1]
+	if g.dir != missing || g.known || g.torrents != 2 || g.taken != 30 || g.pending != 10 {
+		t.Errorf("missing group: dir %q, known %t, %d torrents take %d, %d pending", g.dir, g.known, g.torrents, g.taken, g.pending)
+	}
+}
+
+func TestWriteSizes(t *testing.T) {
+	buf := new(bytes.Buffer)
+	writeSizes(buf, map[string]uint64{"b": 1024, "a": 1024, "c*d": 2048, "e": 0})
+	want := "c•d *2.0 KiB*\na *1.0 KiB*\nb *1.0 KiB*\ne *0 B*\n"
+	if buf.String() != want {
+		t.Errorf("writeSizes() = %q, want %q", buf.String(), want)
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// diskUsage returns the size, the used bytes and the bytes available to us of the filesystem that
+// holds path, like df: the blocks reserved for root are neither used nor available
+func diskUsage(path string) (total, used, free uint64, err error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, 0, 0, err
+	}
+	bsize := uint64(st.F_bsize)
+	return st.F_blocks * bsize, (st.F_blocks - st.F_bfree) * bsize, uint64(max(st.F_bavail, 0)) * bsize, nil
+}
+
+// filesystemID returns an ID that is the same for all the paths on one filesystem
+func filesystemID(path string) (string, error) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return "", err
+	}
+	return fmt.Sprint(st.Dev), nil
+}
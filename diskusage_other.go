@@ -0,0 +1,17 @@
+//go:build !linux && !darwin && !freebsd && !dragonfly && !openbsd && !windows
+
+package main
+
+import stdErrors "errors"
+
+var errNoDiskUsage = stdErrors.New("disk usage isn't supported on this system")
+
+// diskUsage can't tell the usage of filesystems here, every path is treated as not on this machine
+func diskUsage(path string) (total, used, free uint64, err error) {
+	return 0, 0, 0, errNoDiskUsage
+}
+
+// filesystemID can't tell filesystems apart here, see 'diskUsage'
+func filesystemID(path string) (string, error) {
+	return "", errNoDiskUsage
+}
@@ -0,0 +1,29 @@
+//go:build linux || darwin || freebsd || dragonfly
+
+package main
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// diskUsage returns the size, the used bytes and the bytes available to us of the filesystem that
+// holds path, like df: the blocks reserved for root are neither used nor available
+func diskUsage(path string) (total, used, free uint64, err error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, 0, 0, err
+	}
+	// Bavail goes below 0 on the BSDs once root's reserved blocks are in use
+	bsize := uint64(st.Bsize)
+	return uint64(st.Blocks) * bsize, (uint64(st.Blocks) - uint64(st.Bfree)) * bsize, uint64(max(st.Bavail, 0)) * bsize, nil
+}
+
+// filesystemID returns an ID that is the same for all the paths on one filesystem
+func filesystemID(path string) (string, error) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return "", err
+	}
+	return fmt.Sprint(st.Dev), nil
+}
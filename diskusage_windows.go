@@ -0,0 +1,38 @@
+//go:build windows
+
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+var getDiskFreeSpaceEx = syscall.NewLazyDLL("kernel32.dll").NewProc("GetDiskFreeSpaceExW")
+
+// diskUsage returns the size, the used bytes and the bytes available to us of the filesystem that
+// holds path, quotas make the available bytes less than the free ones
+func diskUsage(path string) (total, used, free uint64, err error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	var available, size, totalFree uint64
+	ok, _, err := getDiskFreeSpaceEx.Call(uintptr(unsafe.Pointer(p)),
+		uintptr(unsafe.Pointer(&available)), uintptr(unsafe.Pointer(&size)), uintptr(unsafe.Pointer(&totalFree)))
+	if ok == 0 {
+		return 0, 0, 0, err
+	}
+	return size, size - totalFree, available, nil
+}
+
+// filesystemID returns an ID that is the same for all the paths on one filesystem, the volume
+func filesystemID(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.ToUpper(filepath.VolumeName(abs)), nil
+}
@@ -8,24 +8,25 @@ import (
 )
 
 // downs will send the names of torrents with status 'Leeching'.
-func downs() {
-	torrents, err := rtorrent.Torrents()
+func downs(s *session, tokens []string) {
+	query, tokens := parseLabelQuery(tokens)
+	torrents, err := s.torrents()
 	if err != nil {
 		logger.Print(err)
-		send("downs: "+err.Error(), false)
+		s.send("downs: "+err.Error(), false)
 		return
 	}
 
+	ids := torrentIDs(torrents)
+	torrents = filterState(query.filter(torrents), rtapi.Leeching)
 	buf := new(bytes.Buffer)
 	for i := range torrents {
-		if torrents[i].State == rtapi.Leeching {
-			buf.WriteString(fmt.Sprintf("<%d> %s\n", i, torrents[i].Name))
-		}
+		buf.WriteString(fmt.Sprintf("<%s> %s\n", ids[torrents[i].Hash], torrents[i].Name))
 	}
 
 	if buf.Len() == 0 {
-		send("No downloads", false)
+		s.send("No downloads", false)
 		return
 	}
-	send(buf.String(), false)
+	s.send(buf.String(), false)
 }
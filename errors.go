@@ -8,24 +8,25 @@ import (
 )
 
 // errors will list torrents with errors
-func errors() {
-	torrents, err := rtorrent.Torrents()
+func errors(s *session, tokens []string) {
+	query, tokens := parseLabelQuery(tokens)
+	torrents, err := s.torrents()
 	if err != nil {
 		logger.Print(err)
-		send("errors: "+err.Error(), false)
+		s.send("errors: "+err.Error(), false)
 		return
 	}
 
+	ids := torrentIDs(torrents)
+	torrents = filterState(query.filter(torrents), rtapi.Error)
 	buf := new(bytes.Buffer)
 	for i := range torrents {
-		if torrents[i].State == rtapi.Error {
-			buf.WriteString(fmt.Sprintf("<%d> %s\n%s\n\n",
-				i, torrents[i].Name, torrents[i].Message))
-		}
+		buf.WriteString(fmt.Sprintf("<%s> %s\n%s\n\n",
+			ids[torrents[i].Hash], torrents[i].Name, torrents[i].Message))
 	}
 	if buf.Len() == 0 {
-		send("No errors", false)
+		s.send("No errors", false)
 		return
 	}
-	send(buf.String(), false)
+	s.send(buf.String(), false)
 }
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pyed/rtapi"
+)
+
+// eventKind is the kind of a torrent event, chats subscribe to the kinds they want.
+type eventKind string
+
+const (
+	evCompleted eventKind = "completed"
+	evAdded     eventKind = "added"
+	evRemoved   eventKind = "removed"
+	evErrored   eventKind = "errored"
+	evStalled   eventKind = "stalled"
+	evSchedule  eventKind = "schedule" // the bandwidth schedule switched profiles
+	evSeeding   eventKind = "seeding"  // a seeding rule stopped or deleted a torrent
+	evRSS       eventKind = "rss"      // the feed watcher added a torrent
+	evWatchDir  eventKind = "watchdir" // a file from a watch directory got loaded
+	evDiskSpace eventKind = "disk"     // free space is low, or a torrent got added without enough of it
+)
+
+// eventKinds lists all the kinds of events, in the order they are shown.
+var eventKinds = []eventKind{evCompleted, evAdded, evRemoved, evErrored, evStalled, evSchedule, evSeeding, evRSS, evWatchDir, evDiskSpace}
+
+// defaultSubscriptions are the events a new chat gets notified about.
+var defaultSubscriptions = []eventKind{evCompleted, evErrored, evStalled, evSchedule, evSeeding, evRSS, evWatchDir, evDiskSpace}
+
+// event is something that happened to a torrent or to rTorrent, published on the events bus.
+type event struct {
+	kind    eventKind
+	id      string // may be empty if the source doesn't know the torrent, e.g. the log file
+	name    string
+	message string // extra details, e.g. the error message
+}
+
+// String formats the event as a notification.
+func (e event) String() string {
+	title := map[eventKind]string{
+		evCompleted: "Completed",
+		evAdded:     "Added",
+		evRemoved:   "Removed",
+		evErrored:   "Errored",
+		evStalled:   "Stalled",
+		evSchedule:  "Schedule",
+		evSeeding:   "Seeding goal",
+		evRSS:       "RSS",
+		evWatchDir:  "Watch dir",
+		evDiskSpace: "Disk space",
+	}[e.kind]
+
+	text := fmt.Sprintf("%s: %s", title, e.name)
+	if e.id != "" {
+		text = fmt.Sprintf("%s: <%s> %s", title, e.id, e.name)
+	}
+	if e.message != "" {
+		text += "\n" + e.message
+	}
+	return text
+}
+
+// events is the events bus, sources publish to it and 'dispatchEvents' delivers to the chats.
+var events = make(chan event, 100)
+
+// publish puts an event on the events bus, it drops the event if the bus is full rather than
+// blocking the watcher, the rules or the disk space guard behind a slow Telegram.
+func publish(e event) {
+	select {
+	case events <- e:
+	default:
+		logger.Printf("[ERROR] events: bus full, dropped: %s", e)
+	}
+}
+
+// dispatchEvents sends every published event to the chats subscribed to its kind.
+func dispatchEvents() {
+	for e := range events {
+		for _, s := range allSessions() {
+			if s.subscribed(e.kind) {
+				s.send(e.String(), false)
+			}
+		}
+	}
+}
+
+// torrentSnapshot is what the watcher remembers about a torrent between polls.
+type torrentSnapshot struct {
+	name         string
+	complete     bool
+	state        string
+	stalledSince time.Time // zero if the torrent is not stalled
+	stalled      bool      // whether the stall got reported
+}
+
+// watchTorrents polls rTorrent every 'every', diffs the torrents against the previous poll
+// by hash and publishes the changes, skipCompleted is set when the log file reports completions.
+func watchTorrents(every, stallAfter time.Duration, skipCompleted bool) {
+	var previous map[string]*torrentSnapshot
+
+	for ; ; time.Sleep(every) {
+		torrents, err := rtorrent.Torrents()
+		if err != nil {
+			logger.Print("watcher:", err)
+			continue
+		}
+
+		var changes []event
+		previous, changes = diffTorrents(previous, torrents, stallAfter, skipCompleted, time.Now())
+		for _, e := range changes {
+			publish(e)
+		}
+	}
+}
+
+// diffTorrents compares the torrents of a poll with the snapshot of the previous poll, previous is
+// nil on the first poll which only fills the snapshot. It returns the new snapshot and the events.
+func diffTorrents(previous map[string]*torrentSnapshot, torrents rtapi.Torrents, stallAfter time.Duration,
+	skipCompleted bool, now time.Time) (map[string]*torrentSnapshot, []event) {
+	var changes []event
+
+	ids := torrentIDs(torrents)
+	current := make(map[string]*torrentSnapshot, len(torrents))
+	for _, torrent := range torrents {
+		snap := &torrentSnapshot{
+			name:     torrent.Name,
+			complete: torrent.Completed >= torrent.Size,
+			state:    torrent.State,
+		}
+		current[torrent.Hash] = snap
+
+		// the first poll only fills the snapshot
+		if previous == nil {
+			continue
+		}
+
+		old, ok := previous[torrent.Hash]
+		if !ok {
+			changes = append(changes, event{kind: evAdded, id: ids[torrent.Hash], name: torrent.Name})
+			continue
+		}
+
+		if !old.complete && snap.complete && !skipCompleted {
+			changes = append(changes, event{kind: evCompleted, id: ids[torrent.Hash], name: torrent.Name})
+		}
+
+		if old.state != rtapi.Error && snap.state == rtapi.Error {
+			changes = append(changes, event{kind: evErrored, id: ids[torrent.Hash], name: torrent.Name, message: torrent.Message})
+		}
+
+		if e, ok := checkStalled(torrent, ids[torrent.Hash], old, snap, stallAfter, now); ok {
+			changes = append(changes, e)
+		}
+	}
+
+	for hash, old := range previous {
+		if _, ok := current[hash]; !ok {
+			changes = append(changes, event{kind: evRemoved, name: old.name})
+		}
+	}
+	return current, changes
+}
+
+// checkStalled carries the stall state of a leeching torrent over, and reports it once
+// it hasn't downloaded anything for 'stallAfter'.
+func checkStalled(torrent *rtapi.Torrent, id string, old, snap *torrentSnapshot, stallAfter time.Duration, now time.Time) (event, bool) {
+	if stallAfter <= 0 || torrent.State != rtapi.Leeching || torrent.DownRate > 0 {
+		return event{}, false
+	}
+
+	snap.stalledSince, snap.stalled = old.stalledSince, old.stalled
+	if snap.stalledSince.IsZero() {
+		snap.stalledSince = now
+	}
+
+	if !snap.stalled && now.Sub(snap.stalledSince) >= stallAfter {
+		snap.stalled = true
+		return event{kind: evStalled, id: id, name: torrent.Name,
+			message: fmt.Sprintf("Nothing downloaded for %s at %s", stallAfter, torrent.Percent)}, true
+	}
+	return event{}, false
+}
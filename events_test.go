@@ -0,0 +1,125 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pyed/rtapi"
+)
+
+// eventsOf returns the kinds and names of events, e.g. "added a".
+func eventsOf(events []event) map[string]bool {
+	kinds := make(map[string]bool, len(events))
+	for _, e := range events {
+		kinds[string(e.kind)+" "+e.name] = true
+	}
+	return kinds
+}
+
+func TestDiffTorrents(t *testing.T) {
+	torrent := func(hash, state string, completed, size uint64) *rtapi.Torrent {
+		return &rtapi.Torrent{Name: hash, Hash: hash, State: state, Completed: completed, Size: size, Percent: "50%"}
+	}
+	start := time.Date(2024, time.January, 5, 12, 0, 0, 0, time.UTC)
+
+	// the first poll only fills the snapshot
+	snap, changes := diffTorrents(nil, rtapi.Torrents{
+		torrent("a", rtapi.Leeching, 50, 100),
+		torrent("b", rtapi.Seeding, 100, 100),
+		torrent("c", rtapi.Leeching, 10, 100),
+	}, time.Hour, false, start)
+	if len(changes) != 0 {
+		t.Fatalf("first poll: got %v, want no events", changes)
+	}
+	if len(snap) != 3 {
+		t.Fatalf("first poll: snapshot has %d torrents, want 3", len(snap))
+	}
+
+	// a completes, b is removed, c errors out and d is added
+	snap, changes = diffTorrents(snap, rtapi.Torrents{
+		torrent("a", rtapi.Seeding, 100, 100),
+		torrent("c", rtapi.Error, 10, 100),
+		torrent("d", rtapi.Leeching, 0, 100),
+	}, time.Hour, false, start.Add(time.Minute))
+	got := eventsOf(changes)
+	for _, want := range []string{"completed a", "removed b", "errored c", "added d"} {
+		if !got[want] {
+			t.Errorf("second poll: missing %q in %v", want, got)
+		}
+	}
+	if len(changes) != 4 {
+		t.Errorf("second poll: got %d events, want 4: %v", len(changes), got)
+	}
+
+	// nothing changed, an error is only reported when it appears
+	_, changes = diffTorrents(snap, rtapi.Torrents{
+		torrent("a", rtapi.Seeding, 100, 100),
+		torrent("c", rtapi.Error, 10, 100),
+		torrent("d", rtapi.Leeching, 0, 100),
+	}, 0, false, start.Add(2*time.Minute))
+	if len(changes) != 0 {
+		t.Errorf("third poll: got %v, want no events", eventsOf(changes))
+	}
+}
+
+func TestDiffTorrentsSkipsCompleted(t *testing.T) {
+	before := rtapi.Torrents{{Name: "a", Hash: "a", State: rtapi.Leeching, Completed: 1, Size: 2}}
+	after := rtapi.Torrents{{Name: "a", Hash: "a", State: rtapi.Seeding, Completed: 2, Size: 2}}
+
+	snap, _ := diffTorrents(nil, before, 0, true, time.Now())
+	if _, changes := diffTorrents(snap, after, 0, true, time.Now()); len(changes) != 0 {
+		t.Errorf("got %v, want no events when the log file reports completions", eventsOf(changes))
+	}
+}
+
+func TestDiffTorrentsStalled(t *testing.T) {
+	start := time.Date(2024, time.January, 5, 12, 0, 0, 0, time.UTC)
+	stalled := rtapi.Torrents{{Name: "a", Hash: "a", State: rtapi.Leeching, Size: 100, Percent: "10%"}}
+	moving := rtapi.Torrents{{Name: "a", Hash: "a", State: rtapi.Leeching, Size: 100, DownRate: 1024}}
+
+	polls := []struct {
+		after   time.Duration
+		poll    rtapi.Torrents
+		stalled bool
+	}{
+		{0, stalled, false},
+		{time.Minute, stalled, false}, // starts counting
+		{20 * time.Minute, stalled, false},
+		{61 * time.Minute, stalled, true},
+		{90 * time.Minute, stalled, false}, // reported once
+		{91 * time.Minute, moving, false},  // resets
+		{92 * time.Minute, stalled, false},
+		{153 * time.Minute, stalled, true},
+	}
+
+	var snap map[string]*torrentSnapshot
+	for _, p := range polls {
+		var changes []event
+		snap, changes = diffTorrents(snap, p.poll, time.Hour, false, start.Add(p.after))
+		if got := eventsOf(changes)["stalled a"]; got != p.stalled {
+			t.Errorf("after %s: stalled = %t, want %t", p.after, got, p.stalled)
+		}
+	}
+
+	// stalls aren't watched without 'stallAfter'
+	snap, _ = diffTorrents(nil, stalled, 0, false, start)
+	if _, changes := diffTorrents(snap, stalled, 0, false, start.Add(24*time.Hour)); len(changes) != 0 {
+		t.Errorf("got %v without stallAfter, want no events", eventsOf(changes))
+	}
+}
+
+func TestEventString(t *testing.T) {
+	tests := []struct {
+		e    event
+		want string
+	}{
+		{event{kind: evCompleted, id: "abcdef", name: "a"}, "Completed: <abcdef> a"},
+		{event{kind: evCompleted, name: "from the log"}, "Completed: from the log"},
+		{event{kind: evErrored, id: "abcdef", name: "a", message: "tracker down"}, "Errored: <abcdef> a\ntracker down"},
+	}
+	for _, tt := range tests {
+		if got := tt.e.String(); got != tt.want {
+			t.Errorf("String() = %q, want %q", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	humanize "github.com/pyed/go-humanize"
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// filesPerPage is how many files 'files' shows per message.
+const filesPerPage = 20
+
+// priorities of files as rTorrent's f.priority
+var filePriorities = []string{"off", "normal", "high"}
+
+// torrentFile is a file inside a torrent.
+type torrentFile struct {
+	path            string
+	size            uint64
+	completedChunks int64
+	sizeChunks      int64
+	priority        int64
+}
+
+// percent returns how much of the file is downloaded
+func (f torrentFile) percent() float64 {
+	if f.sizeChunks == 0 {
+		return 100
+	}
+	return float64(f.completedChunks) / float64(f.sizeChunks) * 100
+}
+
+// getFiles returns the files of a torrent, in rTorrent's order which is what 'fprio' indexes refer to
+func getFiles(hash string) ([]torrentFile, error) {
+	result, err := rtCall("f.multicall", hash, "",
+		"f.path=", "f.size_bytes=", "f.completed_chunks=", "f.size_chunks=", "f.priority=")
+	if err != nil {
+		return nil, err
+	}
+
+	rows := rtList(result)
+	files := make([]torrentFile, 0, len(rows))
+	for _, row := range rows {
+		fields := rtList(row)
+		if len(fields) < 5 {
+			return nil, fmt.Errorf("f.multicall: expected 5 fields, got %d", len(fields))
+		}
+		files = append(files, torrentFile{
+			path:            rtString(fields[0]),
+			size:            uint64(rtInt(fields[1])),
+			completedChunks: rtInt(fields[2]),
+			sizeChunks:      rtInt(fields[3]),
+			priority:        rtInt(fields[4]),
+		})
+	}
+	return files, nil
+}
+
+// files lists the files of a torrent with their size, completion and priority, takes an optional page number
+func files(s *session, tokens []string) {
+	if len(tokens) == 0 {
+		s.send("files: needs a torrent ID", false)
+		return
+	}
+
+	page := 1
+	if len(tokens) > 1 {
+		var err error
+		if page, err = strconv.Atoi(tokens[1]); err != nil {
+			s.send("files: page must be a number", false)
+			return
+		}
+	}
+
+	torrents, err := s.torrents()
+	if err != nil {
+		logger.Print("files:", err)
+		s.send("files: "+err.Error(), false)
+		return
+	}
+
+	torrent, err := findTorrent(torrents, tokens[0])
+	if err != nil {
+		s.send("files: "+err.Error(), false)
+		return
+	}
+
+	text, keyboard, err := filesPage(torrent.Hash, torrentIDs(torrents)[torrent.Hash], torrent.Name, page)
+	if err != nil {
+		logger.Print("files:", err)
+		s.send("files: "+err.Error(), false)
+		return
+	}
+	s.sendWithKeyboard(text, true, keyboard)
+}
+
+// filesPage formats a page of the files of a torrent, with buttons to move between pages if there are more than one
+func filesPage(hash, id, name string, page int) (string, *tgbotapi.InlineKeyboardMarkup, error) {
+	files, err := getFiles(hash)
+	if err != nil {
+		return "", nil, err
+	}
+
+	pages := max(1, (len(files)+filesPerPage-1)/filesPerPage)
+	if page < 1 {
+		page = 1
+	}
+	if page > pages {
+		page = pages
+	}
+
+	buf := new(bytes.Buffer)
+	buf.WriteString(fmt.Sprintf("`<%s>` *%s*\n%d files, page %d/%d\n\n", id, mdReplacer.Replace(name), len(files), page, pages))
+
+	start := (page - 1) * filesPerPage
+	end := min(start+filesPerPage, len(files))
+	for i := start; i < end; i++ {
+		f := files[i]
+		priority := strconv.FormatInt(f.priority, 10)
+		if f.priority >= 0 && int(f.priority) < len(filePriorities) {
+			priority = filePriorities[f.priority]
+		}
+		buf.WriteString(fmt.Sprintf("`<%d>` %s\n*%s* (%.1f%%) priority: *%s*\n",
+			i, mdReplacer.Replace(f.path), humanize.IBytes(f.size), f.percent(), priority))
+	}
+
+	if pages <= 1 {
+		return buf.String(), nil, nil
+	}
+
+	var row []tgbotapi.InlineKeyboardButton
+	if page > 1 {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData("« Prev", fmt.Sprintf("%s:%s:%d", cbFiles, hash, page-1)))
+	}
+	if page < pages {
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData("Next »", fmt.Sprintf("%s:%s:%d", cbFiles, hash, page+1)))
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(row)
+	return buf.String(), &keyboard, nil
+}
+
+// fprio sets the priority of files inside a torrent, e.g. "fprio <id> 0,3-5 off", "fprio <id> all high"
+func fprio(s *session, tokens []string) {
+	if len(tokens) < 3 {
+		s.send("fprio: needs a torrent ID, file indexes and a priority: off, normal or high", false)
+		return
+	}
+
+	priority := -1
+	for i := range filePriorities {
+		if filePriorities[i] == strings.ToLower(tokens[2]) {
+			priority = i
+		}
+	}
+	if priority == -1 {
+		s.send(fmt.Sprintf("fprio: unknown priority '%s', expected off, normal or high", tokens[2]), false)
+		return
+	}
+
+	torrents, err := s.torrents()
+	if err != nil {
+		logger.Print("fprio:", err)
+		s.send("fprio: "+err.Error(), false)
+		return
+	}
+
+	torrent, err := findTorrent(torrents, tokens[0])
+	if err != nil {
+		s.send("fprio: "+err.Error(), false)
+		return
+	}
+
+	files, err := getFiles(torrent.Hash)
+	if err != nil {
+		logger.Print("fprio:", err)
+		s.send("fprio: "+err.Error(), false)
+		return
+	}
+
+	indexes, err := parseIndexes(tokens[1], len(files))
+	if err != nil {
+		s.send("fprio: "+err.Error(), false)
+		return
+	}
+
+	for _, i := range indexes {
+		target := fmt.Sprintf("%s:f%d", torrent.Hash, i)
+		if _, err := rtCall("f.priority.set", target, priority); err != nil {
+			logger.Print("fprio:", err)
+			s.send("fprio: "+err.Error(), false)
+			return
+		}
+	}
+
+	// let rTorrent pick up the new priorities
+	if _, err := rtCall("d.update_priorities", torrent.Hash); err != nil {
+		logger.Print("fprio:", err)
+		s.send("fprio: "+err.Error(), false)
+		return
+	}
+
+	s.send(fmt.Sprintf("Priority of %d file(s) set to %s: %s", len(indexes), filePriorities[priority], torrent.Name), false)
+}
+
+// parseIndexes parses a comma separated list of indexes and ranges, e.g. "0,3-5", or "all", n is the count of items
+func parseIndexes(spec string, n int) ([]int, error) {
+	if strings.ToLower(spec) == "all" {
+		indexes := make([]int, n)
+		for i := range indexes {
+			indexes[i] = i
+		}
+		return indexes, nil
+	}
+
+	var indexes []int
+	for _, part := range strings.Split(spec, ",") {
+		first, last, isRange := strings.Cut(part, "-")
+		from, err := strconv.Atoi(first)
+		if err != nil {
+			return nil, fmt.Errorf("%s is not a number", first)
+		}
+		to := from
+		if isRange {
+			if to, err = strconv.Atoi(last); err != nil {
+				return nil, fmt.Errorf("%s is not a number", last)
+			}
+			if from > to {
+				return nil, fmt.Errorf("%s is a reversed range, did you mean %d-%d?", part, to, from)
+			}
+		}
+
+		for i := from; i <= to; i++ {
+			if i < 0 || i >= n {
+				return nil, fmt.Errorf("no file with an index of '%d'", i)
+			}
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes, nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseIndexes(t *testing.T) {
+	tests := []struct {
+		spec    string
+		n       int
+		want    []int
+		wantErr bool
+	}{
+		{spec: "0", n: 3, want: []int{0}},
+		{spec: "0,2", n: 3, want: []int{0, 2}},
+		{spec: "1-3", n: 5, want: []int{1, 2, 3}},
+		{spec: "0,3-4", n: 5, want: []int{0, 3, 4}},
+		{spec: "2-2", n: 3, want: []int{2}},
+		{spec: "all", n: 3, want: []int{0, 1, 2}},
+		{spec: "ALL", n: 0, want: []int{}},
+		{spec: "5-3", n: 10, wantErr: true},
+		{spec: "3", n: 3, wantErr: true},
+		{spec: "1-5", n: 3, wantErr: true},
+		{spec: "-1", n: 3, wantErr: true},
+		{spec: "a", n: 3, wantErr: true},
+		{spec: "1-b", n: 3, wantErr: true},
+		{spec: "", n: 3, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseIndexes(tt.spec, tt.n)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseIndexes(%q, %d) error = %v, wantErr %v", tt.spec, tt.n, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseIndexes(%q, %d) = %v, want %v", tt.spec, tt.n, got, tt.want)
+		}
+	}
+}
@@ -8,28 +8,29 @@ import (
 )
 
 // hashing will send the names of torrents with the status 'Hashing'
-func hashing() {
-	torrents, err := rtorrent.Torrents()
+func hashing(s *session, tokens []string) {
+	query, tokens := parseLabelQuery(tokens)
+	torrents, err := s.torrents()
 	if err != nil {
 		logger.Print(err)
-		send("hashing: "+err.Error(), false)
+		s.send("hashing: "+err.Error(), false)
 		return
 	}
 
+	ids := torrentIDs(torrents)
+	torrents = filterState(query.filter(torrents), rtapi.Hashing)
 	buf := new(bytes.Buffer)
 	for i := range torrents {
-		if torrents[i].State == rtapi.Hashing {
-			buf.WriteString(fmt.Sprintf("<%d> %s\n%s (%s)\n\n",
-				i, torrents[i].Name, torrents[i].State,
-				torrents[i].Percent))
+		buf.WriteString(fmt.Sprintf("<%s> %s\n%s (%s)\n\n",
+			ids[torrents[i].Hash], torrents[i].Name, torrents[i].State,
+			torrents[i].Percent))
 
-		}
 	}
 
 	if buf.Len() == 0 {
-		send("No torrents hashing", false)
+		s.send("No torrents hashing", false)
 		return
 	}
 
-	send(buf.String(), false)
+	s.send(buf.String(), false)
 }
@@ -11,7 +11,8 @@ import (
 )
 
 // head will list the first 5 or n torrents
-func head(tokens []string) {
+func head(s *session, tokens []string) {
+	query, tokens := parseLabelQuery(tokens)
 	var (
 		n   = 5 // default to 5
 		err error
@@ -20,17 +21,19 @@ func head(tokens []string) {
 	if len(tokens) > 0 {
 		n, err = strconv.Atoi(tokens[0])
 		if err != nil {
-			send("head: argument must be a number", false)
+			s.send("head: argument must be a number", false)
 			return
 		}
 	}
 
-	torrents, err := rtorrent.Torrents()
+	torrents, err := s.torrents()
 	if err != nil {
 		logger.Print(err)
-		send("head: "+err.Error(), false)
+		s.send("head: "+err.Error(), false)
 		return
 	}
+	ids := torrentIDs(torrents)
+	torrents = query.filter(torrents)
 
 	// make sure that we stay in the boundaries
 	if n <= 0 || n > len(torrents) {
@@ -38,22 +41,23 @@ func head(tokens []string) {
 	}
 
 	buf := new(bytes.Buffer)
-	for i, torrent := range torrents[:n] {
+	for _, torrent := range torrents[:n] {
 		torrentName := mdReplacer.Replace(torrent.Name) // escape markdown
-		buf.WriteString(fmt.Sprintf("`<%d>` *%s*\n%s *%s* (%s) ↓ *%s*  ↑ *%s* R: *%.2f*\n\n",
-			i, torrentName, torrent.State, humanize.IBytes(torrent.Completed),
+		buf.WriteString(fmt.Sprintf("`<%s>` *%s*\n%s *%s* (%s) ↓ *%s*  ↑ *%s* R: *%.2f*\n\n",
+			ids[torrent.Hash], torrentName, torrent.State, humanize.IBytes(torrent.Completed),
 			torrent.Percent, humanize.IBytes(torrent.DownRate),
 			humanize.IBytes(torrent.UpRate), torrent.Ratio))
 	}
 
 	if buf.Len() == 0 {
-		send("head: No torrents", false)
+		s.send("head: No torrents", false)
 		return
 	}
 
-	msgID := send(buf.String(), true)
+	keyboard := torrentsKeyboard(torrents[:n], ids)
+	msgID := s.sendWithKeyboard(buf.String(), true, keyboard)
 
-	if NoLive {
+	if !s.isLive() {
 		return
 	}
 
@@ -62,12 +66,14 @@ func head(tokens []string) {
 		time.Sleep(time.Second * interval)
 		buf.Reset()
 
-		torrents, err = rtorrent.Torrents()
+		torrents, err = s.torrents()
 		if err != nil {
 			logger.Print("head:", err)
 			continue // try again if some error heppened
 		}
 
+		ids = torrentIDs(torrents)
+		torrents = query.filter(torrents)
 		if len(torrents) < 1 {
 			continue
 		}
@@ -77,17 +83,18 @@ func head(tokens []string) {
 			n = len(torrents)
 		}
 
-		for i, torrent := range torrents[:n] {
+		for _, torrent := range torrents[:n] {
 			torrentName := mdReplacer.Replace(torrent.Name) // escape markdown
-			buf.WriteString(fmt.Sprintf("`<%d>` *%s*\n%s *%s* (%s) ↓ *%s*  ↑ *%s* R: *%.2f*\n\n",
-				i, torrentName, torrent.State, humanize.IBytes(torrent.Completed),
+			buf.WriteString(fmt.Sprintf("`<%s>` *%s*\n%s *%s* (%s) ↓ *%s*  ↑ *%s* R: *%.2f*\n\n",
+				ids[torrent.Hash], torrentName, torrent.State, humanize.IBytes(torrent.Completed),
 				torrent.Percent, humanize.IBytes(torrent.DownRate),
 				humanize.IBytes(torrent.UpRate), torrent.Ratio))
 		}
 
 		// no need to check if it is empty, as if the buffer is empty telegram won't change the message
-		editConf := tgbotapi.NewEditMessageText(chatID, msgID, buf.String())
+		editConf := tgbotapi.NewEditMessageText(s.chatID, msgID, buf.String())
 		editConf.ParseMode = tgbotapi.ModeMarkdown
+		editConf.ReplyMarkup = torrentsKeyboard(torrents[:n], ids)
 		Bot.Send(editConf)
 	}
 
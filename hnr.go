@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pyed/rtapi"
+)
+
+// hnrFile holds the hit and run requirements of the trackers, inside the data directory.
+const hnrFile = "hnr.json"
+
+// hnrRequirement is what a tracker requires before a torrent can be removed without a hit and run,
+// a torrent has to reach the ratio or to seed for the seed time, whichever comes first.
+type hnrRequirement struct {
+	Tracker  string  `json:"tracker"`   // host of the tracker, subdomains match too
+	Ratio    float64 `json:"ratio"`     // 0 for no ratio requirement
+	SeedTime int64   `json:"seed_time"` // seconds, 0 for no time requirement
+}
+
+// hnrRequirements is what gets saved to 'hnrFile'.
+type hnrRequirements struct {
+	Requirements []hnrRequirement `json:"requirements"`
+}
+
+var (
+	hnr   hnrRequirements
+	hnrMu sync.Mutex
+)
+
+// String formats the requirement as shown by the 'hnr' command.
+func (r hnrRequirement) String() string {
+	var goals []string
+	if r.Ratio > 0 {
+		goals = append(goals, fmt.Sprintf("ratio *%.2f*", r.Ratio))
+	}
+	if r.SeedTime > 0 {
+		goals = append(goals, fmt.Sprintf("seeding *%s*", formatSeedTime(r.SeedTime)))
+	}
+	return fmt.Sprintf("%s: %s", mdReplacer.Replace(r.Tracker), strings.Join(goals, " or "))
+}
+
+// loadHnR reads the hit and run requirements from the data directory.
+func loadHnR() error {
+	hnrMu.Lock()
+	defer hnrMu.Unlock()
+	return loadJSON(hnrFile, &hnr)
+}
+
+// editHnR applies edit to the hit and run requirements and saves them.
+func editHnR(edit func(*hnrRequirements) error) error {
+	hnrMu.Lock()
+	defer hnrMu.Unlock()
+
+	edited := hnrRequirements{Requirements: append([]hnrRequirement(nil), hnr.Requirements...)}
+	if err := edit(&edited); err != nil {
+		return err
+	}
+	if err := saveJSON(hnrFile, edited); err != nil {
+		return err
+	}
+	hnr = edited
+	return nil
+}
+
+// hnrMissing returns what a torrent still lacks to meet the requirement of its tracker, e.g.
+// "ratio 0.40/1.00, seeded 2h/3d", empty if it has none or meets it. Torrents that didn't
+// download anything yet are safe to remove.
+func hnrMissing(torrent *rtapi.Torrent, finished map[string]int64) string {
+	if torrent.Completed == 0 {
+		return ""
+	}
+
+	hnrMu.Lock()
+	defer hnrMu.Unlock()
+
+	for _, req := range hnr.Requirements {
+		if !matchesTracker(torrent, req.Tracker) {
+			continue
+		}
+
+		var seeding time.Duration
+		if torrent.Completed >= torrent.Size {
+			seeding = seedTime(torrent, finished)
+		}
+		if (req.Ratio > 0 && torrent.Ratio >= req.Ratio) ||
+			(req.SeedTime > 0 && seeding >= time.Duration(req.SeedTime)*time.Second) {
+			return ""
+		}
+
+		var missing []string
+		if req.Ratio > 0 {
+			missing = append(missing, fmt.Sprintf("ratio %.2f/%.2f", torrent.Ratio, req.Ratio))
+		}
+		if req.SeedTime > 0 {
+			missing = append(missing, fmt.Sprintf("seeded %s/%s",
+				formatSeedTime(int64(seeding.Seconds())), formatSeedTime(req.SeedTime)))
+		}
+		return strings.Join(missing, ", ")
+	}
+	return ""
+}
+
+// hnrCheck lists the torrents that would get a hit and run if removed now as markdown, empty if none would
+func hnrCheck(torrents rtapi.Torrents, ids map[string]string) (string, error) {
+	risks, err := hnrRisks(torrents)
+	if err != nil {
+		return "", err
+	}
+
+	buf := new(bytes.Buffer)
+	for _, risk := range risks {
+		buf.WriteString(fmt.Sprintf("`<%s>` %s\n%s\n", ids[risk.torrent.Hash], mdReplacer.Replace(risk.torrent.Name), risk.missing))
+	}
+	return buf.String(), nil
+}
+
+// hnrRisk is a torrent that would get a hit and run if removed now, with what it still lacks.
+type hnrRisk struct {
+	torrent *rtapi.Torrent
+	missing string
+}
+
+// hnrRisks returns the torrents that would get a hit and run if removed now
+func hnrRisks(torrents rtapi.Torrents) ([]hnrRisk, error) {
+	hnrMu.Lock()
+	empty := len(hnr.Requirements) == 0
+	hnrMu.Unlock()
+	if empty {
+		return nil, nil
+	}
+
+	finished, err := finishedTimes()
+	if err != nil {
+		return nil, err
+	}
+
+	var risks []hnrRisk
+	for _, torrent := range torrents {
+		if missing := hnrMissing(torrent, finished); missing != "" {
+			risks = append(risks, hnrRisk{torrent: torrent, missing: missing})
+		}
+	}
+	return risks, nil
+}
+
+// hnrGuard checks the torrents about to be deleted by cmd, and refuses when some haven't met the
+// requirements of their trackers unless forced, returns the warning to show with the confirmation.
+func hnrGuard(s *session, cmd string, toDelete rtapi.Torrents, ids map[string]string, force bool) (string, bool) {
+	risks, err := hnrCheck(toDelete, ids)
+	if err != nil {
+		logger.Print(cmd+":", err)
+		s.send(cmd+": "+err.Error(), false)
+		return "", false
+	}
+	if risks == "" {
+		return "", true
+	}
+
+	if !force {
+		s.send(fmt.Sprintf("%s: *Refused, hit and run risk*:\n%sAdd *force* to delete anyway.", cmd, risks), true)
+		return "", false
+	}
+	return "*Hit and run risk*:\n" + risks, true
+}
+
+// withoutForce removes the "force" token from the arguments, and reports whether it was there
+func withoutForce(tokens []string) ([]string, bool) {
+	var (
+		rest  []string
+		force bool
+	)
+	for _, token := range tokens {
+		if strings.ToLower(token) == "force" {
+			force = true
+			continue
+		}
+		rest = append(rest, token)
+	}
+	return rest, force
+}
+
+// hnrCmd lists the torrents that are at risk of a hit and run, and shows and edits the requirements:
+// "hnr", "hnr reqs", "hnr add <tracker> [ratio=R] [time=T]", "hnr del <n>"
+func hnrCmd(s *session, tokens []string) {
+	if len(tokens) == 0 {
+		torrents, err := s.torrents()
+		if err != nil {
+			logger.Print("hnr:", err)
+			s.send("hnr: "+err.Error(), false)
+			return
+		}
+
+		risks, err := hnrCheck(torrents, torrentIDs(torrents))
+		if err != nil {
+			logger.Print("hnr:", err)
+			s.send("hnr: "+err.Error(), false)
+			return
+		}
+		if risks == "" {
+			s.send("No torrents at risk of a hit and run", false)
+			return
+		}
+		s.send(risks, true)
+		return
+	}
+
+	var err error
+	switch strings.ToLower(tokens[0]) {
+	case "reqs":
+		hnrMu.Lock()
+		buf := new(bytes.Buffer)
+		for i, req := range hnr.Requirements {
+			buf.WriteString(fmt.Sprintf("`<%d>` %s\n", i, req))
+		}
+		hnrMu.Unlock()
+
+		if buf.Len() == 0 {
+			buf.WriteString("No requirements, add one with: *hnr add tracker.example.org ratio=1 time=3d*\n")
+		}
+		s.send(buf.String(), true)
+		return
+
+	case "add":
+		var req hnrRequirement
+		if req, err = parseHnRRequirement(tokens[1:]); err == nil {
+			err = editHnR(func(h *hnrRequirements) error {
+				h.Requirements = append(h.Requirements, req)
+				return nil
+			})
+		}
+
+	case "del":
+		if len(tokens) < 2 {
+			err = fmt.Errorf("needs the number of a requirement")
+			break
+		}
+		err = editHnR(func(h *hnrRequirements) error {
+			n, err := strconv.Atoi(tokens[1])
+			if err != nil || n < 0 || n >= len(h.Requirements) {
+				return fmt.Errorf("no requirement with the number '%s'", tokens[1])
+			}
+			h.Requirements = append(h.Requirements[:n], h.Requirements[n+1:]...)
+			return nil
+		})
+
+	default:
+		err = fmt.Errorf("unknown argument: %s", tokens[0])
+	}
+
+	if err != nil {
+		s.send("hnr: "+err.Error(), false)
+		return
+	}
+	hnrCmd(s, []string{"reqs"})
+}
+
+// hnrPerm listing is for viewers, editing the requirements is for masters
+func hnrPerm(tokens []string) permission {
+	if len(tokens) > 0 && strings.ToLower(tokens[0]) != "reqs" {
+		return permControl
+	}
+	return permView
+}
+
+// parseHnRRequirement parses "<tracker> [ratio=R] [time=T]", e.g. "tracker.example.org ratio=1 time=3d"
+func parseHnRRequirement(tokens []string) (hnrRequirement, error) {
+	var req hnrRequirement
+	if len(tokens) < 2 {
+		return req, fmt.Errorf("usage: hnr add <tracker> [ratio=R] [time=T]")
+	}
+	req.Tracker = strings.ToLower(tokens[0])
+
+	for _, token := range tokens[1:] {
+		key, value, _ := strings.Cut(strings.ToLower(token), "=")
+		var err error
+		switch key {
+		case "ratio":
+			if req.Ratio, err = strconv.ParseFloat(value, 64); err != nil || req.Ratio <= 0 {
+				return req, fmt.Errorf("invalid ratio '%s'", value)
+			}
+		case "time":
+			if req.SeedTime, err = parseSeedTime(value); err != nil {
+				return req, err
+			}
+		default:
+			return req, fmt.Errorf("unknown requirement '%s', expected ratio=R or time=T", token)
+		}
+	}
+	return req, nil
+}
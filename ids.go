@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pyed/rtapi"
+)
+
+// idLength is the minimum number of infohash characters used as a torrent ID.
+const idLength = 6
+
+// torrentIDs maps each torrent's hash to a short ID made of the first 'idLength'
+// characters of its infohash, extended as needed to keep it unique among torrents.
+// unlike indexes, IDs don't depend on the sorting or on the position of the torrent.
+func torrentIDs(torrents rtapi.Torrents) map[string]string {
+	sorted := make(rtapi.Torrents, len(torrents))
+	copy(sorted, torrents)
+	slices.SortFunc(sorted, func(a, b *rtapi.Torrent) int {
+		return strings.Compare(strings.ToLower(a.Hash), strings.ToLower(b.Hash))
+	})
+
+	hashes := make([]string, len(sorted))
+	for i := range sorted {
+		hashes[i] = strings.ToLower(sorted[i].Hash)
+	}
+
+	// the shortest unique prefix only depends on the neighbours in sorted order
+	commonPrefix := func(a, b string) int {
+		n := 0
+		for n < len(a) && n < len(b) && a[n] == b[n] {
+			n++
+		}
+		return n
+	}
+
+	ids := make(map[string]string, len(torrents))
+	for i, hash := range hashes {
+		length := idLength
+		if i > 0 {
+			if n := commonPrefix(hash, hashes[i-1]) + 1; n > length {
+				length = n
+			}
+		}
+		if i < len(hashes)-1 {
+			if n := commonPrefix(hash, hashes[i+1]) + 1; n > length {
+				length = n
+			}
+		}
+		if length > len(hash) {
+			length = len(hash)
+		}
+		ids[sorted[i].Hash] = hash[:length]
+	}
+	return ids
+}
+
+// findTorrent resolves a token to a torrent, the token is either an ID (any unique prefix
+// of the infohash with at least 'idLength' characters), or an index into torrents as a fallback.
+func findTorrent(torrents rtapi.Torrents, token string) (*rtapi.Torrent, error) {
+	token = strings.Trim(strings.ToLower(token), "<>")
+
+	if len(token) >= idLength {
+		var found *rtapi.Torrent
+		for i := range torrents {
+			if strings.HasPrefix(strings.ToLower(torrents[i].Hash), token) {
+				if found != nil {
+					return nil, fmt.Errorf("ID '%s' matches more than one torrent", token)
+				}
+				found = torrents[i]
+			}
+		}
+		if found != nil {
+			return found, nil
+		}
+	}
+
+	// fallback to the index
+	index, err := strconv.Atoi(token)
+	if err != nil {
+		return nil, fmt.Errorf("No torrent with an ID of '%s'", token)
+	}
+
+	if index < 0 || index >= len(torrents) {
+		return nil, fmt.Errorf("No torrent with an ID of '%d'", index)
+	}
+	return torrents[index], nil
+}
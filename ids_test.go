@@ -0,0 +1,103 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pyed/rtapi"
+)
+
+// torrentsWithHashes makes torrents named after their position, with the given hashes.
+func torrentsWithHashes(hashes ...string) rtapi.Torrents {
+	torrents := make(rtapi.Torrents, len(hashes))
+	for i, hash := range hashes {
+		torrents[i] = &rtapi.Torrent{Name: "torrent " + string(rune('a'+i)), Hash: hash}
+	}
+	return torrents
+}
+
+func TestTorrentIDs(t *testing.T) {
+	torrents := torrentsWithHashes(
+		"ABCDEF0123456789ABCDEF0123456789ABCDEF01",
+		"ABCDEF9876543210ABCDEF0123456789ABCDEF01", // shares 6 characters with the first
+		"ABCDEF0129999999ABCDEF0123456789ABCDEF01", // shares 9 characters with the first
+		"1234560000000000000000000000000000000000",
+	)
+
+	ids := torrentIDs(torrents)
+	want := map[string]string{
+		torrents[0].Hash: "abcdef0123",
+		torrents[1].Hash: "abcdef9",
+		torrents[2].Hash: "abcdef0129",
+		torrents[3].Hash: "123456",
+	}
+	for hash, id := range want {
+		if ids[hash] != id {
+			t.Errorf("ID of %s = %q, want %q", hash, ids[hash], id)
+		}
+	}
+
+	// IDs don't depend on the order of the torrents
+	reversed := rtapi.Torrents{torrents[3], torrents[2], torrents[1], torrents[0]}
+	for hash, id := range torrentIDs(reversed) {
+		if ids[hash] != id {
+			t.Errorf("ID of %s changed with the order: %q, was %q", hash, id, ids[hash])
+		}
+	}
+
+	// every ID resolves back to its torrent
+	for _, torrent := range torrents {
+		found, err := findTorrent(torrents, "<"+ids[torrent.Hash]+">")
+		if err != nil {
+			t.Errorf("findTorrent(%s): %s", ids[torrent.Hash], err)
+			continue
+		}
+		if found != torrent {
+			t.Errorf("findTorrent(%s) = %s, want %s", ids[torrent.Hash], found.Name, torrent.Name)
+		}
+	}
+}
+
+func TestFindTorrent(t *testing.T) {
+	torrents := torrentsWithHashes(
+		"ABCDEF0123456789ABCDEF0123456789ABCDEF01",
+		"ABCDEF9876543210ABCDEF0123456789ABCDEF01",
+		"1234560000000000000000000000000000000000",
+	)
+
+	tests := []struct {
+		name  string
+		token string
+		want  int    // index of the torrent found
+		err   string // part of the error, if one is expected
+	}{
+		{name: "unique prefix", token: "abcdef0", want: 0},
+		{name: "upper case", token: "ABCDEF98", want: 1},
+		{name: "between angle brackets", token: "<123456>", want: 2},
+		{name: "full hash", token: "1234560000000000000000000000000000000000", want: 2},
+		{name: "ambiguous prefix", token: "abcdef", err: "more than one torrent"},
+		{name: "unknown hash", token: "fedcba", err: "No torrent with an ID of 'fedcba'"},
+		{name: "index fallback", token: "1", want: 1},
+		{name: "short prefix is an index", token: "abc", err: "No torrent with an ID of 'abc'"},
+		{name: "index out of range", token: "3", err: "No torrent with an ID of '3'"},
+		{name: "negative index", token: "-1", err: "No torrent with an ID of '-1'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found, err := findTorrent(torrents, tt.token)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("findTorrent(%q) error = %v, want %q", tt.token, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("findTorrent(%q): %s", tt.token, err)
+			}
+			if found != torrents[tt.want] {
+				t.Errorf("findTorrent(%q) = %s, want %s", tt.token, found.Name, torrents[tt.want].Name)
+			}
+		})
+	}
+}
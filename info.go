@@ -2,7 +2,6 @@ package main
 
 import (
 	"fmt"
-	"strconv"
 	"time"
 
 	humanize "github.com/pyed/go-humanize"
@@ -11,48 +10,37 @@ import (
 )
 
 // info takes an id of a torrent and returns some info about it
-func info(tokens []string) {
+func info(s *session, tokens []string) {
 	if len(tokens) == 0 {
-		send("info: needs a torrent ID number", false)
+		s.send("info: needs a torrent ID number", false)
 		return
 	}
 
-	torrents, err := rtorrent.Torrents()
+	torrents, err := s.torrents()
 	if err != nil {
 		logger.Print("info:", err)
-		send("info: "+err.Error(), false)
+		s.send("info: "+err.Error(), false)
 		return
 	}
 
+	ids := torrentIDs(torrents)
 	for _, i := range tokens {
-		id, err := strconv.Atoi(i)
+		torrent, err := findTorrent(torrents, i)
 		if err != nil {
-			send(fmt.Sprintf("info: %s is not a number", i), false)
+			s.send("info: "+err.Error(), false)
 			continue
 		}
 
-		if id >= len(torrents) || id < 0 {
-			send(fmt.Sprintf("info: No torrent with an ID of '%d'", id), false)
-			continue
-		}
-
-		// format the info
-		torrentName := mdReplacer.Replace(torrents[id].Name) // escape markdown
-		info := fmt.Sprintf("*%s*\n%s *%s* (*%s*) ↓ *%s*  ↑ *%s* R: *%.2f* UP: *%s*\nAdded: *%s*, ETA: *%d*\nTracker: `%s`",
-			torrentName, torrents[id].State, humanize.IBytes(torrents[id].Completed), torrents[id].Percent,
-			humanize.IBytes(torrents[id].DownRate), humanize.IBytes(torrents[id].UpRate), torrents[id].Ratio,
-			humanize.IBytes(torrents[id].UpTotal), time.Unix(int64(torrents[id].Age), 0).Format(time.Stamp),
-			torrents[id].ETA, torrents[id].Tracker.Hostname())
+		// send it along with the actions keyboard
+		keyboard := torrentKeyboard(torrent.Hash)
+		msgID := s.sendWithKeyboard(formatInfo(torrent, ids[torrent.Hash]), true, keyboard)
 
-		// send it
-		msgID := send(info, true)
-
-		if NoLive {
+		if !s.isLive() {
 			return
 		}
 
 		// this go-routine will make the info live for 'duration * interval'
-		go func(hash string, msgID int) {
+		go func(hash, id string, msgID int) {
 			var torrent *rtapi.Torrent
 			for i := 0; i < duration; i++ {
 				time.Sleep(time.Second * interval)
@@ -62,16 +50,10 @@ func info(tokens []string) {
 					return // if there's an error finding the torrent, maybe got deleted, return
 				}
 
-				torrentName := mdReplacer.Replace(torrent.Name) // escape markdown
-				info := fmt.Sprintf("*%s*\n%s *%s* (*%s*) ↓ *%s*  ↑ *%s* R: *%.2f* UP: *%s*\nAdded: *%s*, ETA: *%d*\nTracker: `%s`",
-					torrentName, torrent.State, humanize.IBytes(torrent.Completed), torrent.Percent,
-					humanize.IBytes(torrent.DownRate), humanize.IBytes(torrent.UpRate), torrent.Ratio,
-					humanize.IBytes(torrent.UpTotal), time.Unix(int64(torrent.Age), 0).Format(time.Stamp),
-					torrent.ETA, torrent.Tracker.Hostname())
-
 				// update the message
-				editConf := tgbotapi.NewEditMessageText(chatID, msgID, info)
+				editConf := tgbotapi.NewEditMessageText(s.chatID, msgID, formatInfo(torrent, id))
 				editConf.ParseMode = tgbotapi.ModeMarkdown
+				editConf.ReplyMarkup = keyboard
 				Bot.Send(editConf)
 
 			}
@@ -79,12 +61,33 @@ func info(tokens []string) {
 			time.Sleep(time.Second * interval)
 			// at the end write dashes to indicate that we are done being live.
 			torrentName := mdReplacer.Replace(torrent.Name) // escape markdown
-			info := fmt.Sprintf("*%s*\n *-* (*-%%*) ↓ *-*  ↑ *-* R: *-* UP: *-*\nAdded: *%s*, ETA: *-*\nTracker: `%s`",
-				torrentName, time.Unix(int64(torrent.Age), 0).Format(time.Stamp), torrent.Tracker.Hostname())
+			info := fmt.Sprintf("`<%s>` *%s*\n *-* (*-%%*) ↓ *-*  ↑ *-* R: *-* UP: *-*\nAdded: *%s*, ETA: *-*\nTracker: `%s`",
+				id, torrentName, time.Unix(int64(torrent.Age), 0).Format(time.Stamp), torrent.Tracker.Hostname())
+			info += formatLabel(torrent)
 
-			editConf := tgbotapi.NewEditMessageText(chatID, msgID, info)
+			editConf := tgbotapi.NewEditMessageText(s.chatID, msgID, info)
 			editConf.ParseMode = tgbotapi.ModeMarkdown
+			editConf.ReplyMarkup = keyboard
 			Bot.Send(editConf)
-		}(torrents[id].Hash, msgID)
+		}(torrent.Hash, ids[torrent.Hash], msgID)
+	}
+}
+
+// formatInfo formats the info of a torrent as markdown
+func formatInfo(torrent *rtapi.Torrent, id string) string {
+	torrentName := mdReplacer.Replace(torrent.Name) // escape markdown
+	info := fmt.Sprintf("`<%s>` *%s*\n%s *%s* (*%s*) ↓ *%s*  ↑ *%s* R: *%.2f* UP: *%s*\nAdded: *%s*, ETA: *%d*\nTracker: `%s`",
+		id, torrentName, torrent.State, humanize.IBytes(torrent.Completed), torrent.Percent,
+		humanize.IBytes(torrent.DownRate), humanize.IBytes(torrent.UpRate), torrent.Ratio,
+		humanize.IBytes(torrent.UpTotal), time.Unix(int64(torrent.Age), 0).Format(time.Stamp),
+		torrent.ETA, torrent.Tracker.Hostname())
+	return info + formatLabel(torrent)
+}
+
+// formatLabel formats the label of a torrent as an extra line of its info, empty if it has none
+func formatLabel(torrent *rtapi.Torrent) string {
+	if torrent.Label == "" {
+		return ""
 	}
+	return fmt.Sprintf("\nLabel: `%s`", labelName(torrent))
 }
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	humanize "github.com/pyed/go-humanize"
+	"github.com/pyed/rtapi"
+)
+
+// noLabel is how torrents without a label are shown by 'labels'.
+const noLabel = "(none)"
+
+// labelName returns the label of a torrent as shown to users, ruTorrent saves
+// labels url-encoded to "d.custom1" so they get decoded when possible.
+func labelName(torrent *rtapi.Torrent) string {
+	if name, err := url.PathUnescape(torrent.Label); err == nil {
+		return name
+	}
+	return torrent.Label
+}
+
+// labelQuery is the optional "l:<label>" argument of the listing commands, "l:" alone
+// matches the torrents without a label.
+type labelQuery struct {
+	label string
+	set   bool
+}
+
+// parseLabelQuery pulls a "l:<label>" or "label:<label>" token out of the arguments, returns the rest of them
+func parseLabelQuery(tokens []string) (labelQuery, []string) {
+	var (
+		q    labelQuery
+		rest []string
+	)
+	for _, token := range tokens {
+		for _, prefix := range []string{"l:", "label:"} {
+			if len(token) >= len(prefix) && strings.EqualFold(token[:len(prefix)], prefix) {
+				q = labelQuery{label: token[len(prefix):], set: true}
+				token = ""
+				break
+			}
+		}
+		if token != "" {
+			rest = append(rest, token)
+		}
+	}
+	return q, rest
+}
+
+// filter returns the torrents that match the query, all of them if it's not set
+func (q labelQuery) filter(torrents rtapi.Torrents) rtapi.Torrents {
+	if !q.set {
+		return torrents
+	}
+
+	var matched rtapi.Torrents
+	for _, torrent := range torrents {
+		if strings.EqualFold(labelName(torrent), q.label) {
+			matched = append(matched, torrent)
+		}
+	}
+	return matched
+}
+
+// encodeLabel encodes a label the way ruTorrent saves it to "d.custom1", see 'labelName', with
+// JavaScript's encodeURIComponent, which escapes more than url.PathEscape does, e.g. '&', '+' and '='
+func encodeLabel(label string) string {
+	const hex = "0123456789ABCDEF"
+	var buf strings.Builder
+	for i := 0; i < len(label); i++ {
+		c := label[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("-_.!~*'()", c) >= 0 {
+			buf.WriteByte(c)
+			continue
+		}
+		buf.WriteByte('%')
+		buf.WriteByte(hex[c>>4])
+		buf.WriteByte(hex[c&15])
+	}
+	return buf.String()
+}
+
+// setLabel sets the label of a torrent, an empty label removes it
+func setLabel(hash, label string) error {
+	_, err := rtCall("d.custom1.set", hash, encodeLabel(label))
+	return err
+}
+
+// label takes id[s] of torrent[s] followed by a label to set it on them
+func label(s *session, tokens []string) {
+	if len(tokens) < 2 {
+		s.send("label: needs torrent ID[s] and a label", false)
+		return
+	}
+	labelTorrents(s, "label", tokens[:len(tokens)-1], tokens[len(tokens)-1])
+}
+
+// unlabel takes id[s] of torrent[s] to remove their labels
+func unlabel(s *session, tokens []string) {
+	if len(tokens) == 0 {
+		s.send("unlabel: needs an ID", false)
+		return
+	}
+	labelTorrents(s, "unlabel", tokens, "")
+}
+
+// labelTorrents sets the label of the torrents with the given ids and reports each one
+func labelTorrents(s *session, cmd string, tokens []string, name string) {
+	torrents, err := s.torrents()
+	if err != nil {
+		logger.Print(cmd+":", err)
+		s.send(cmd+": "+err.Error(), false)
+		return
+	}
+
+	for _, i := range tokens {
+		torrent, err := findTorrent(torrents, i)
+		if err != nil {
+			s.send(cmd+": "+err.Error(), false)
+			continue
+		}
+
+		if err := setLabel(torrent.Hash, name); err != nil {
+			logger.Print(cmd+":", err)
+			s.send(cmd+": "+err.Error(), false)
+			continue
+		}
+
+		if name == "" {
+			s.send(fmt.Sprintf("Unlabeled: %s", torrent.Name), false)
+			continue
+		}
+		s.send(fmt.Sprintf("Labeled %s: %s", name, torrent.Name), false)
+	}
+}
+
+// labelStats is what 'labels' shows about a label.
+type labelStats struct {
+	count     int
+	size      uint64
+	completed uint64
+	uploaded  uint64
+}
+
+// labels lists all the labels with how many torrents, their size and ratio
+func labels(s *session, tokens []string) {
+	torrents, err := s.torrents()
+	if err != nil {
+		logger.Print("labels:", err)
+		s.send("labels: "+err.Error(), false)
+		return
+	}
+
+	var names []string
+	stats := make(map[string]*labelStats)
+	for _, torrent := range torrents {
+		name := labelName(torrent)
+		if name == "" {
+			name = noLabel
+		}
+
+		st, ok := stats[name]
+		if !ok {
+			st = new(labelStats)
+			stats[name] = st
+			names = append(names, name)
+		}
+		st.count++
+		st.size += torrent.Size
+		st.completed += torrent.Completed
+		st.uploaded += torrent.UpTotal
+	}
+
+	if len(names) == 0 {
+		s.send("labels: No torrents", false)
+		return
+	}
+
+	slices.Sort(names)
+	buf := new(bytes.Buffer)
+	for _, name := range names {
+		st := stats[name]
+		var ratio float64
+		if st.completed > 0 {
+			ratio = float64(st.uploaded) / float64(st.completed)
+		}
+		buf.WriteString(fmt.Sprintf("*%s* %d torrent(s)\n*%s* R: *%.2f*\n\n",
+			mdReplacer.Replace(name), st.count, humanize.IBytes(st.size), ratio))
+	}
+	buf.WriteString("List the torrents of a label with e.g. *list l:movies*")
+	s.send(buf.String(), true)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/pyed/rtapi"
+)
+
+func TestEncodeLabel(t *testing.T) {
+	// what encodeURIComponent gives in a browser
+	labels := map[string]string{
+		"Movies":          "Movies",
+		"TV Shows":        "TV%20Shows",
+		"R&B":             "R%26B",
+		"a+b=c":           "a%2Bb%3Dc",
+		"2024:q1/q2":      "2024%3Aq1%2Fq2",
+		"50%":             "50%25",
+		"it's (done)!*~_": "it's%20(done)!*~_",
+		"Фильмы":          "%D0%A4%D0%B8%D0%BB%D1%8C%D0%BC%D1%8B",
+		"#1 @home?":       "%231%20%40home%3F",
+	}
+	for label, want := range labels {
+		encoded := encodeLabel(label)
+		if encoded != want {
+			t.Errorf("encodeLabel(%q) = %q, want %q", label, encoded, want)
+		}
+		if name := labelName(&rtapi.Torrent{Label: encoded}); name != label {
+			t.Errorf("labelName(%q) = %q, want %q back", encoded, name, label)
+		}
+	}
+}
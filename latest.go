@@ -9,7 +9,8 @@ import (
 )
 
 // latest takes n and returns the latest n torrents
-func latest(tokens []string) {
+func latest(s *session, tokens []string) {
+	query, tokens := parseLabelQuery(tokens)
 	var (
 		n   = 5 // default to 5
 		err error
@@ -18,17 +19,19 @@ func latest(tokens []string) {
 	if len(tokens) > 0 {
 		n, err = strconv.Atoi(tokens[0])
 		if err != nil {
-			send("latest: argument must be a number", false)
+			s.send("latest: argument must be a number", false)
 			return
 		}
 	}
 
-	torrents, err := rtorrent.Torrents()
+	torrents, err := s.torrents()
 	if err != nil {
 		logger.Print(err)
-		send("latest: "+err.Error(), false)
+		s.send("latest: "+err.Error(), false)
 		return
 	}
+	ids := torrentIDs(torrents)
+	torrents = query.filter(torrents)
 
 	// make sure that we stay in the boundaries
 	if n <= 0 || n > len(torrents) {
@@ -40,11 +43,11 @@ func latest(tokens []string) {
 
 	buf := new(bytes.Buffer)
 	for i := range torrents[:n] {
-		buf.WriteString(fmt.Sprintf("<%d> %s\n", i, torrents[i].Name))
+		buf.WriteString(fmt.Sprintf("<%s> %s\n", ids[torrents[i].Hash], torrents[i].Name))
 	}
 	if buf.Len() == 0 {
-		send("latest: No torrents", false)
+		s.send("latest: No torrents", false)
 		return
 	}
-	send(buf.String(), false)
+	s.send(buf.String(), false)
 }
@@ -4,49 +4,90 @@ import (
 	"bytes"
 	"fmt"
 	"regexp"
+	"strings"
+
+	"github.com/pyed/rtapi"
 )
 
+// stateActive isn't one of rtapi's states, it stands for the torrents that are downloading or
+// uploading right now, whatever their state, see 'filterState'.
+const stateActive = "Active"
+
 // list will form and send a list of all the torrents
 // takes an optional argument which is a query to match against trackers
 // to list only torrents that has a tracker that matchs.
-func list(tokens []string) {
-	torrents, err := rtorrent.Torrents()
+func list(s *session, tokens []string) {
+	query, tokens := parseLabelQuery(tokens)
+	torrents, err := s.torrents()
 	if err != nil {
 		logger.Print(err)
-		send("list: "+err.Error(), false)
+		s.send("list: "+err.Error(), false)
 		return
 	}
 
-	buf := new(bytes.Buffer)
+	ids := torrentIDs(torrents)
+	torrents = query.filter(torrents)
 	// if it gets a query, it will list torrents that has trackers that match the query
 	if len(tokens) != 0 {
-		// (?i) for case insensitivity
-		regx, err := regexp.Compile("(?i)" + tokens[0])
-		if err != nil {
-			send("list: "+err.Error(), false)
+		if torrents, err = filterTracker(torrents, tokens[0]); err != nil {
+			s.send("list: "+err.Error(), false)
 			return
 		}
+	}
 
-		for i := range torrents {
-			if regx.MatchString(torrents[i].Tracker.Hostname()) {
-				buf.WriteString(fmt.Sprintf("<%d> %s\n", i, torrents[i].Name))
-			}
-		}
-	} else { // if we did not get a query, list all torrents
-		for i := range torrents {
-			buf.WriteString(fmt.Sprintf("<%d> %s\n", i, torrents[i].Name))
-		}
+	buf := new(bytes.Buffer)
+	for i := range torrents {
+		buf.WriteString(fmt.Sprintf("<%s> %s\n", ids[torrents[i].Hash], torrents[i].Name))
 	}
 
 	if buf.Len() == 0 {
 		// if we got a tracker query show different message
 		if len(tokens) != 0 {
-			send(fmt.Sprintf("list: No tracker matches: *%s*", tokens[0]), true)
+			s.send(fmt.Sprintf("list: No tracker matches: *%s*", tokens[0]), true)
 			return
 		}
-		send("list: No torrents", false)
+		s.send("list: No torrents", false)
 		return
 	}
 
-	send(buf.String(), false)
+	s.send(buf.String(), false)
+}
+
+// filterState returns the torrents in state, one of rtapi's states or 'stateActive', case insensitive
+func filterState(torrents rtapi.Torrents, state string) rtapi.Torrents {
+	var matched rtapi.Torrents
+	for _, torrent := range torrents {
+		if strings.EqualFold(state, stateActive) && (torrent.DownRate > 0 || torrent.UpRate > 0) ||
+			strings.EqualFold(torrent.State, state) {
+			matched = append(matched, torrent)
+		}
+	}
+	return matched
+}
+
+// filterTracker returns the torrents with a tracker that matches query, a case insensitive regular expression
+func filterTracker(torrents rtapi.Torrents, query string) (rtapi.Torrents, error) {
+	return filterRegexp(torrents, query, func(t *rtapi.Torrent) string { return t.Tracker.Hostname() })
+}
+
+// filterName returns the torrents with a name that matches query, a case insensitive regular expression
+func filterName(torrents rtapi.Torrents, query string) (rtapi.Torrents, error) {
+	return filterRegexp(torrents, query, func(t *rtapi.Torrent) string { return t.Name })
+}
+
+// filterRegexp returns the torrents with a field that matches query, a case insensitive regular expression
+func filterRegexp(torrents rtapi.Torrents, query string, field func(*rtapi.Torrent) string) (rtapi.Torrents, error) {
+	// (?i) for case insensitivity
+	regx, err := regexp.Compile("(?i)" + query)
+	if err != nil {
+		return nil, err
+	}
+
+	var matched rtapi.Torrents
+	for _, torrent := range torrents {
+		if regx.MatchString(field(torrent)) {
+			matched = append(matched, torrent)
+		}
+	}
+	return matched, nil
 }
@@ -8,9 +8,9 @@ import (
 	"io"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
-	"unicode/utf8"
 
 	"github.com/pyed/rtapi"
 	tgbotapi "gopkg.in/telegram-bot-api.v4"
@@ -18,97 +18,35 @@ import (
 
 const (
 	VERSION = "v1.1"
-
-	HELP = `
-	*list* or *li*
-	Lists all the torrents, takes an optional argument which is a query to list only torrents that has a tracker matches the query, or some of it.
-
-	*head* or *he*
-	Lists the first n number of torrents, n defaults to 5 if no argument is provided.
-
-	*tail* or *ta*
-	Lists the last n number of torrents, n defaults to 5 if no argument is provided.
-
-	*down* or *dl*
-	Lists torrents with the status of Downloading or in the queue to download.
-
-	*seeding* or *sd*
-	Lists torrents with the status of Seeding or in the queue to seed.
-	
-	*paused* or *pa*
-	Lists Paused torrents.
-
-	*checking* or *ch*
-	Lists torrents with the status of Verifying or in the queue to verify.
-	
-	*active* or *ac*
-	Lists torrents that are actively uploading or downloading.
-
-	*errors* or *er*
-	Lists torrents with with errors along with the error message.
-
-	*sort* or *so*
-	Manipulate the sorting of the aforementioned commands, Call it without arguments for more. 
-
-	*trackers* or *tr*
-	Lists all the trackers along with the number of torrents.
-
-	*add* or *ad*
-	Takes one or many URLs or magnets to add them, You can send a .torrent file via Telegram to add it.
-
-	*search* or *se*
-	Takes a query and lists torrents with matching names.
-
-	*latest* or *la*
-	Lists the newest n torrents, n defaults to 5 if no argument is provided.
-
-	*info* or *in*
-	Takes one or more torrent's IDs to list more info about them.
-
-	*stop* or *sp*
-	Takes one or more torrent's IDs to stop them, or _all_ to stop all torrents.
-
-	*start* or *st*
-	Takes one or more torrent's IDs to start them, or _all_ to start all torrents.
-
-	*check* or *ck*
-	Takes one or more torrent's IDs to verify them, or _all_ to verify all torrents.
-
-	*del*
-	Takes one or more torrent's IDs to delete them.
-
-	*deldata*
-	Takes one or more torrent's IDs to delete them and their data.
-
-	*stats* or *sa*
-	Shows some stats
-	
-	*speed* or *ss*
-	Shows the upload and download speeds.
-	
-	*count* or *co*
-	Shows the torrents counts per status.
-
-	*help*
-	Shows this help message.
-
-	*version*
-	Shows version numbers.
-
-	- Prefix commands with '/' if you want to talk to your bot in a group. 
-	- report any issues [here](https://github.com/pyed/rtelegram)
-	`
 )
 
 var (
 
 	// flags
-	BotToken   string
-	Masters    []string
-	SCGIURL    string
-	LogFile    string
-	ComLogFile string
-	NoLive     bool
+	BotToken    string
+	Masters     []string
+	Viewers     []string
+	SCGIURL     string
+	LogFile     string
+	ComLogFile  string
+	NoLive      bool
+	WatchEvery  time.Duration
+	StallAfter  time.Duration
+	RulesEvery  time.Duration
+	RSSEvery    time.Duration
+	WatchDirs   watchDirs
+	SpaceCheck  string
+	MinFree     uint64
+	MetricsAddr string
+	APIAddr     string
+	APIToken    string
+
+	// DataDir holds the files that persist across restarts, e.g. the bandwidth schedule
+	DataDir string
+
+	// presets of the 'turtle' command, [up, down]
+	NormalLimits [2]uint64
+	TurtleLimits [2]uint64
 
 	// telegram
 	Bot     *tgbotapi.BotAPI
@@ -117,9 +55,6 @@ var (
 	// rTorrent
 	rtorrent *rtapi.Rtorrent
 
-	// chatID will be used to keep track of which chat to send to.
-	chatID int64
-
 	// logging
 	logger = log.New(os.Stdout, "", log.LstdFlags)
 
@@ -133,16 +68,30 @@ var (
 	mdReplacer = strings.NewReplacer("*", "•")
 )
 
-// init flags
-func init() {
-	var mastersStr string
+// initFlags parses the flags and sets up the logging
+func initFlags() {
+	var mastersStr, viewersStr, normalStr, turtleStr, minFreeStr string
 	// define arguments and parse them.
 	flag.StringVar(&BotToken, "token", "", "Telegram bot token, Can be passed via environment variable 'RT_TOKEN'")
 	flag.StringVar(&mastersStr, "masters", "", "Comma-seperated Telegram handlers, The bot will only respond to them, Can be passed via environment variable 'RT_MASTERS'")
+	flag.StringVar(&viewersStr, "viewers", "", "Comma-seperated Telegram handlers, The bot will only respond to their read-only commands")
 	flag.StringVar(&SCGIURL, "url", "localhost:5000", "rTorrent SCGI URL")
 	flag.StringVar(&LogFile, "logfile", "", "Send logs to a file")
 	flag.StringVar(&ComLogFile, "completed-torrents-logfile", "", "Watch completed torrents log file to notify upon new ones.")
+	flag.StringVar(&DataDir, "data-dir", defaultDataDir(), "Directory to keep the bandwidth schedule and other settings in")
 	flag.BoolVar(&NoLive, "no-live", false, "Don't edit and update info after sending")
+	flag.DurationVar(&WatchEvery, "watch-interval", time.Minute, "How often to poll rTorrent to notify upon completed, added, removed, errored and stalled torrents, 0 to disable")
+	flag.StringVar(&normalStr, "normal-limits", "off:off", "Global UP:DOWN limits to switch to when the turtle mode is off, e.g. 1M:off")
+	flag.StringVar(&turtleStr, "turtle-limits", "100K:500K", "Global UP:DOWN limits to switch to when the turtle mode is on")
+	flag.DurationVar(&StallAfter, "stall-timeout", 30*time.Minute, "Notify when a leeching torrent doesn't download anything for this long, 0 to disable")
+	flag.DurationVar(&RulesEvery, "rules-interval", 10*time.Minute, "How often to check the seeding rules, 0 to disable")
+	flag.DurationVar(&RSSEvery, "rss-interval", 15*time.Minute, "How often to poll the RSS feeds, 0 to disable")
+	flag.StringVar(&SpaceCheck, "space-check", spaceRefuse, "What to do when a torrent is bigger than the free space of its directory: refuse, warn or off")
+	flag.StringVar(&minFreeStr, "min-free", "off", "Pause all downloads when the free space of a download directory drops below this, e.g. 10G")
+	flag.StringVar(&MetricsAddr, "metrics-addr", "", "Address to serve Prometheus metrics on at /metrics, e.g. localhost:9135, off if empty")
+	flag.StringVar(&APIAddr, "api-addr", "", "Address to serve the JSON API on at /api/, e.g. localhost:9136, off if empty")
+	flag.StringVar(&APIToken, "api-token", "", "Token the API requests have to send in the X-API-Token header, Can be passed via environment variable 'RT_API_TOKEN'")
+	flag.Var(&WatchDirs, "watch", "Directory to load .torrent and .magnet files from, formatted as DIR[,d=TARGET][,l=LABEL], can be repeated")
 
 	// set the usage message
 	flag.Usage = func() {
@@ -183,6 +132,45 @@ func init() {
 	mastersStr = strings.ToLower(mastersStr)
 	Masters = strings.Split(mastersStr, ",")
 
+	// process viewersStr into Viewers the same way
+	if viewersStr != "" {
+		viewersStr = strings.Replace(viewersStr, "@", "", -1)
+		viewersStr = strings.Replace(viewersStr, " ", "", -1)
+		viewersStr = strings.ToLower(viewersStr)
+		Viewers = strings.Split(viewersStr, ",")
+	}
+
+	// process the limits of the turtle presets
+	var err error
+	if NormalLimits, err = parseLimits(normalStr); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: -normal-limits: %s\n", err)
+		os.Exit(1)
+	}
+	if TurtleLimits, err = parseLimits(turtleStr); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: -turtle-limits: %s\n", err)
+		os.Exit(1)
+	}
+
+	// process the free space settings
+	if SpaceCheck != spaceRefuse && SpaceCheck != spaceWarn && SpaceCheck != spaceOff {
+		fmt.Fprintf(os.Stderr, "Error: -space-check: expected refuse, warn or off, got: %s\n", SpaceCheck)
+		os.Exit(1)
+	}
+	if MinFree, err = parseSize(minFreeStr); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: -min-free: %s\n", err)
+		os.Exit(1)
+	}
+
+	// the API needs a token, check the environment variable "RT_API_TOKEN"
+	if APIAddr != "" && APIToken == "" {
+		if envVar := os.Getenv("RT_API_TOKEN"); envVar != "" {
+			APIToken = envVar
+		} else {
+			fmt.Fprintf(os.Stderr, "Error: -api-addr needs -api-token\n")
+			os.Exit(1)
+		}
+	}
+
 	// if we got a log file, log to it
 	if LogFile != "" {
 		logf, err := os.OpenFile(LogFile, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
@@ -192,18 +180,28 @@ func init() {
 		logger.SetOutput(logf)
 	}
 
+	// restore the chats, so they keep their settings and get notified after a restart
+	if err := loadSessions(); err != nil {
+		fmt.Fprintf(os.Stderr, "[ERROR] sessions: %s\n", err)
+		os.Exit(1)
+	}
+
+	// deliver the notifications to the chats
+	go dispatchEvents()
+
 	// if we got a completed torrents log file, monitor it for torrents completion to notify upon them.
 	if ComLogFile != "" {
 		go watchCompletedLog(ComLogFile)
 	}
 
-	// log the flags
-	logger.Printf("[INFO] Token=%s\n\t\tMasters=%s\n\t\tURL=%s",
-		BotToken, Masters, SCGIURL)
+	// log the flags, only the bot ID part of the token, the rest of it is the secret
+	botID, _, _ := strings.Cut(BotToken, ":")
+	logger.Printf("[INFO] Token=%s:<redacted>\n\t\tMasters=%s\n\t\tViewers=%s\n\t\tURL=%s",
+		botID, Masters, Viewers, SCGIURL)
 }
 
-// init telegram
-func init() {
+// initTelegram authorizes the bot and starts getting the updates
+func initTelegram() {
 	// authorize using the token
 	var err error
 	Bot, err = tgbotapi.NewBotAPI(BotToken)
@@ -223,170 +221,145 @@ func init() {
 	}
 }
 
-// init rTorrent
-func init() {
+// initRtorrent connects to rTorrent and starts everything that watches it
+func initRtorrent() {
 	var err error
 	rtorrent, err = rtapi.NewRtorrent(SCGIURL)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "[ERROR] rTorrent: %s\n", err)
 		os.Exit(1)
 	}
-}
-
-func main() {
-	for update := range Updates {
-		// ignore edited messages
-		if update.Message == nil {
-			continue
-		}
-
-		// ignore non-Masters
-		if !aMaster(update.Message.From.UserName) {
-			logger.Printf("[INFO] Ignored a message from: %s", update.Message.From.String())
-			continue
-		}
-
-		// update chatID for complete notification
-		if chatID != update.Message.Chat.ID {
-			chatID = update.Message.Chat.ID
-		}
-
-		// tokenize the update
-		tokens := strings.Split(update.Message.Text, " ")
-		command := strings.ToLower(tokens[0])
-
-		switch command {
-		case "list", "/list", "li", "/li":
-			go list(tokens[1:])
-
-		case "head", "/head", "he", "/he":
-			go head(tokens[1:])
-
-		case "tail", "/tail", "ta", "/ta":
-			go tail(tokens[1:])
-
-		case "down", "/down", "dl", "/dl":
-			go downs()
 
-		case "seeding", "/seeding", "sd", "/sd":
-			go seeding()
-
-		case "paused", "/paused", "pa", "/pa":
-			go paused()
-
-		case "hashing", "/hashing", "ha", "/ha":
-			go hashing()
-
-		case "active", "/active", "ac", "/ac":
-			go active()
-
-		case "errors", "/errors", "er", "/er":
-			go errors()
+	// apply the bandwidth schedule
+	if err := loadSchedule(); err != nil {
+		fmt.Fprintf(os.Stderr, "[ERROR] schedule: %s\n", err)
+		os.Exit(1)
+	}
+	go runSchedule()
 
-		case "sort", "/sort", "so", "/so":
-			go sort(tokens[1:])
+	// stop or remove torrents that reached their seeding goals
+	if err := loadRules(); err != nil {
+		fmt.Fprintf(os.Stderr, "[ERROR] rules: %s\n", err)
+		os.Exit(1)
+	}
+	if RulesEvery > 0 {
+		go runRules(RulesEvery)
+	}
 
-		case "trackers", "/trackers", "tr", "/tr":
-			go trackers()
+	// protect torrents from hit and runs
+	if err := loadHnR(); err != nil {
+		fmt.Fprintf(os.Stderr, "[ERROR] hnr: %s\n", err)
+		os.Exit(1)
+	}
 
-		case "add", "/add", "ad", "/ad":
-			go add(tokens[1:], "")
+	// add torrents from the RSS feeds
+	if err := loadFeeds(); err != nil {
+		fmt.Fprintf(os.Stderr, "[ERROR] rss: %s\n", err)
+		os.Exit(1)
+	}
+	if RSSEvery > 0 {
+		go watchFeeds(RSSEvery)
+	}
 
-		case "search", "/search", "se", "/se":
-			go search(tokens[1:])
+	// load the files dropped into the watch directories
+	if len(WatchDirs) > 0 {
+		go watchDirectories(WatchDirs)
+	}
 
-		case "latest", "/latest", "la", "/la":
-			go latest(tokens[1:])
+	// pause the downloads before the disks fill up
+	if MinFree > 0 {
+		go watchDiskSpace(MinFree)
+	}
 
-		case "info", "/info", "in", "/in":
-			go info(tokens[1:])
+	// expose the metrics for Prometheus
+	if MetricsAddr != "" {
+		if err := serveMetrics(MetricsAddr); err != nil {
+			fmt.Fprintf(os.Stderr, "[ERROR] metrics: %s\n", err)
+			os.Exit(1)
+		}
+	}
 
-		case "stop", "/stop", "sp", "/sp":
-			go stop(tokens[1:])
+	// serve the API for scripts
+	if APIAddr != "" {
+		if err := serveAPI(APIAddr, APIToken); err != nil {
+			fmt.Fprintf(os.Stderr, "[ERROR] api: %s\n", err)
+			os.Exit(1)
+		}
+	}
 
-		case "start", "/start", "st", "/st":
-			go start(tokens[1:])
+	// poll rTorrent for changes, completions come from the log file if we got one
+	if WatchEvery > 0 {
+		go watchTorrents(WatchEvery, StallAfter, ComLogFile != "")
+	}
+}
 
-		case "check", "/check", "ck", "/ck":
-			go check(tokens[1:])
+// the setup runs from main rather than init, so the tests can load the package
+func main() {
+	initFlags()
+	initTelegram()
+	initRtorrent()
 
-		case "stats", "/stats", "sa", "/sa":
-			go stats()
+	for update := range Updates {
+		// inline keyboard buttons
+		if update.CallbackQuery != nil {
+			perm, ok := userPermission(update.CallbackQuery.From.UserName)
+			if !ok {
+				logger.Printf("[INFO] Ignored a callback from: %s", update.CallbackQuery.From.String())
+				continue
+			}
 
-		case "speed", "/speed", "ss", "/ss":
-			go speed()
+			// callbacks from inline messages have no chat to reply to
+			if update.CallbackQuery.Message == nil {
+				continue
+			}
 
-		case "count", "/count", "co", "/co":
-			go count()
+			s := getSession(update.CallbackQuery.Message.Chat.ID)
+			go handleCallback(s, update.CallbackQuery, perm)
+			continue
+		}
 
-		case "del", "/del":
-			go del(tokens[1:])
+		// ignore edited messages
+		if update.Message == nil {
+			continue
+		}
 
-		case "deldata", "/deldata":
-			go deldata(tokens[1:])
+		// ignore users that are neither Masters nor Viewers
+		perm, ok := userPermission(update.Message.From.UserName)
+		if !ok {
+			logger.Printf("[INFO] Ignored a message from: %s", update.Message.From.String())
+			continue
+		}
 
-		case "help", "/help":
-			go send(HELP, true)
+		// every chat gets its own session
+		s := getSession(update.Message.Chat.ID)
 
-		case "version", "/version":
-			go getVersion()
+		// tokenize the update
+		tokens := strings.Split(update.Message.Text, " ")
 
-		case "":
+		if tokens[0] == "" {
 			// might be a file received
-			go receiveTorrent(update)
-
-		default:
-			// no such command, try help
-			go send("no such command, try /help", false)
-
+			if perm < permControl {
+				continue
+			}
+			go receiveTorrent(s, update)
+			continue
 		}
-	}
-}
 
-// send takes a chat id and a message to send, returns the message id of the send message
-func send(text string, markdown bool) int {
-	// set typing action
-	action := tgbotapi.NewChatAction(chatID, tgbotapi.ChatTyping)
-	Bot.Send(action)
-
-	// check the rune count, telegram is limited to 4096 chars per message;
-	// so if our message is > 4096, split it in chunks the send them.
-	msgRuneCount := utf8.RuneCountInString(text)
-LenCheck:
-	stop := 4095
-	if msgRuneCount > 4096 {
-		for text[stop] != 10 { // '\n'
-			stop--
-		}
-		msg := tgbotapi.NewMessage(chatID, text[:stop])
-		msg.DisableWebPagePreview = true
-		if markdown {
-			msg.ParseMode = tgbotapi.ModeMarkdown
+		cmd, ok := lookupCommand(tokens[0])
+		if !ok {
+			// no such command, try help
+			go s.send("no such command, try /help", false)
+			continue
 		}
 
-		// send current chunk
-		if _, err := Bot.Send(msg); err != nil {
-			logger.Printf("[ERROR] Send: %s", err)
+		if required := cmd.required(tokens[1:]); perm < required {
+			go s.send(fmt.Sprintf("%s: only allowed for %s", cmd.name, required), false)
+			continue
 		}
-		// move to the next chunk
-		text = text[stop:]
-		msgRuneCount = utf8.RuneCountInString(text)
-		goto LenCheck
-	}
-
-	// if msgRuneCount < 4096, send it normally
-	msg := tgbotapi.NewMessage(chatID, text)
-	msg.DisableWebPagePreview = true
-	if markdown {
-		msg.ParseMode = tgbotapi.ModeMarkdown
-	}
 
-	resp, err := Bot.Send(msg)
-	if err != nil {
-		logger.Printf("[ERROR] Send: %s", err)
+		metrics.command(cmd.name)
+		go cmd.run(s, tokens[1:])
 	}
-
-	return resp.MessageID
 }
 
 func watchCompletedLog(path string) {
@@ -465,27 +438,36 @@ func watchCompletedLog(path string) {
 			continue
 		}
 
-		if chatID == 0 {
-			continue
-		}
+		publish(event{kind: evCompleted, name: text})
+	}
+}
 
-		msg := fmt.Sprintf("Completed: %s", text)
-		send(msg, false)
+// defaultDataDir returns the rtelegram directory inside the user's config directory
+func defaultDataDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "rtelegram"
 	}
+	return filepath.Join(dir, "rtelegram")
 }
 
 // getVersion sends rTorrent/libtorrent version + rtelegram version
-func getVersion() {
-	send(fmt.Sprintf("rTorrent/libtorrent: *%s*\nrtelegram: *%s*", rtorrent.Version, VERSION), true)
+func getVersion(s *session, tokens []string) {
+	s.send(fmt.Sprintf("rTorrent/libtorrent: *%s*\nrtelegram: *%s*", rtorrent.Version, VERSION), true)
 }
 
-// Check if []string contains string
-func aMaster(name string) bool {
+// userPermission returns the permission of a user, ok is false if the user is neither a Master nor a Viewer
+func userPermission(name string) (perm permission, ok bool) {
 	name = strings.ToLower(name)
 	for i := range Masters {
 		if Masters[i] == name {
-			return true
+			return permControl, true
+		}
+	}
+	for i := range Viewers {
+		if Viewers[i] == name {
+			return permView, true
 		}
 	}
-	return false
+	return permView, false
 }
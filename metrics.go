@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pyed/rtapi"
+)
+
+// scgiBuckets are the upper bounds in seconds of the SCGI latency histogram.
+var scgiBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// botMetrics are the counters of the bot itself, rTorrent's side gets read on every scrape.
+type botMetrics struct {
+	sendErrors atomic.Uint64
+
+	mu          sync.Mutex
+	commands    map[string]uint64 // by command name
+	scgiBuckets []uint64          // cumulative, one per 'scgiBuckets'
+	scgiCount   uint64
+	scgiSum     float64
+	scgiErrors  uint64
+}
+
+var metrics = &botMetrics{
+	commands:    make(map[string]uint64),
+	scgiBuckets: make([]uint64, len(scgiBuckets)),
+}
+
+// command counts a handled command
+func (m *botMetrics) command(name string) {
+	m.mu.Lock()
+	m.commands[name]++
+	m.mu.Unlock()
+}
+
+// observeSCGI records how long an rtCall took since start, and whether it failed, it's meant to be deferred.
+// rtapi's own calls don't go through rtCall, they show up in rtorrent_scrape_duration_seconds instead.
+func observeSCGI(start time.Time, err *error) {
+	elapsed := time.Since(start).Seconds()
+
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	for i, bound := range scgiBuckets {
+		if elapsed <= bound {
+			metrics.scgiBuckets[i]++
+		}
+	}
+	metrics.scgiCount++
+	metrics.scgiSum += elapsed
+	if *err != nil {
+		metrics.scgiErrors++
+	}
+}
+
+// serveMetrics serves the metrics in Prometheus' text format on addr at /metrics
+func serveMetrics(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", handleMetrics)
+	go func() {
+		logger.Print("metrics:", http.Serve(ln, mux))
+	}()
+	logger.Printf("[INFO] Metrics: http://%s/metrics", ln.Addr())
+	return nil
+}
+
+// handleMetrics writes the metrics of rTorrent and the bot
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	buf := new(bytes.Buffer)
+	writeBotMetrics(buf)
+	if err := writeRtorrentMetrics(buf); err != nil {
+		logger.Print("metrics:", err)
+		writeMetric(buf, "rtorrent_up", "gauge", "Whether rTorrent could be reached.")
+		buf.WriteString("rtorrent_up 0\n")
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+// writeRtorrentMetrics writes the global rates, the throttles and the per state, per tracker and per torrent gauges
+func writeRtorrentMetrics(buf *bytes.Buffer) error {
+	start := time.Now()
+	torrents, err := rtorrent.Torrents()
+	if err != nil {
+		return err
+	}
+	stats, err := rtorrent.Stats()
+	if err != nil {
+		return err
+	}
+	throttleUp, throttleDown, err := getThrottle()
+	if err != nil {
+		return err
+	}
+	down, up := rtorrent.Speeds()
+	scrape := time.Since(start).Seconds()
+
+	writeMetric(buf, "rtorrent_up", "gauge", "Whether rTorrent could be reached.")
+	buf.WriteString("rtorrent_up 1\n")
+	writeMetric(buf, "rtorrent_scrape_duration_seconds", "gauge", "How long reading rTorrent's state took.")
+	fmt.Fprintf(buf, "rtorrent_scrape_duration_seconds %g\n", scrape)
+
+	writeMetric(buf, "rtorrent_download_rate_bytes", "gauge", "Global download rate in bytes per second.")
+	fmt.Fprintf(buf, "rtorrent_download_rate_bytes %d\n", down)
+	writeMetric(buf, "rtorrent_upload_rate_bytes", "gauge", "Global upload rate in bytes per second.")
+	fmt.Fprintf(buf, "rtorrent_upload_rate_bytes %d\n", up)
+	writeMetric(buf, "rtorrent_downloaded_bytes_total", "counter", "Bytes downloaded since rTorrent started.")
+	fmt.Fprintf(buf, "rtorrent_downloaded_bytes_total %d\n", stats.TotalDown)
+	writeMetric(buf, "rtorrent_uploaded_bytes_total", "counter", "Bytes uploaded since rTorrent started.")
+	fmt.Fprintf(buf, "rtorrent_uploaded_bytes_total %d\n", stats.TotalUp)
+	writeMetric(buf, "rtorrent_throttle_download_bytes", "gauge", "Global download limit in bytes per second, 0 for unlimited.")
+	fmt.Fprintf(buf, "rtorrent_throttle_download_bytes %d\n", throttleDown)
+	writeMetric(buf, "rtorrent_throttle_upload_bytes", "gauge", "Global upload limit in bytes per second, 0 for unlimited.")
+	fmt.Fprintf(buf, "rtorrent_throttle_upload_bytes %d\n", throttleUp)
+
+	writeMetric(buf, "rtorrent_torrents", "gauge", "Torrents per state.")
+	counts := countStates(torrents)
+	for _, state := range torrentStates {
+		fmt.Fprintf(buf, "rtorrent_torrents{state=\"%s\"} %d\n", strings.ToLower(state), counts[state])
+	}
+
+	writeTrackerMetrics(buf, torrents)
+	writeTorrentMetrics(buf, torrents)
+	return nil
+}
+
+// trackerTotals are the sums of the torrents of a tracker.
+type trackerTotals struct {
+	torrents         int
+	size, uploaded   uint64
+	downRate, upRate uint64
+}
+
+// writeTrackerMetrics writes the totals of the torrents of every tracker
+func writeTrackerMetrics(buf *bytes.Buffer, torrents rtapi.Torrents) {
+	totals := make(map[string]*trackerTotals)
+	for _, torrent := range torrents {
+		host := torrent.Tracker.Hostname()
+		t, ok := totals[host]
+		if !ok {
+			t = new(trackerTotals)
+			totals[host] = t
+		}
+		t.torrents++
+		t.size += torrent.Size
+		t.uploaded += torrent.UpTotal
+		t.downRate += torrent.DownRate
+		t.upRate += torrent.UpRate
+	}
+
+	hosts := make([]string, 0, len(totals))
+	for host := range totals {
+		hosts = append(hosts, host)
+	}
+	slices.Sort(hosts)
+
+	gauges := []struct {
+		name, help string
+		value      func(*trackerTotals) uint64
+	}{
+		{"rtorrent_tracker_torrents", "Torrents per tracker.", func(t *trackerTotals) uint64 { return uint64(t.torrents) }},
+		{"rtorrent_tracker_size_bytes", "Size of the torrents per tracker.", func(t *trackerTotals) uint64 { return t.size }},
+		{"rtorrent_tracker_uploaded_bytes", "Bytes uploaded per tracker.", func(t *trackerTotals) uint64 { return t.uploaded }},
+		{"rtorrent_tracker_download_rate_bytes", "Download rate per tracker in bytes per second.", func(t *trackerTotals) uint64 { return t.downRate }},
+		{"rtorrent_tracker_upload_rate_bytes", "Upload rate per tracker in bytes per second.", func(t *trackerTotals) uint64 { return t.upRate }},
+	}
+	for _, g := range gauges {
+		writeMetric(buf, g.name, "gauge", g.help)
+		for _, host := range hosts {
+			fmt.Fprintf(buf, "%s{tracker=\"%s\"} %d\n", g.name, labelValue(host), g.value(totals[host]))
+		}
+	}
+}
+
+// writeTorrentMetrics writes the gauges of every torrent, labeled with its hash and label
+func writeTorrentMetrics(buf *bytes.Buffer, torrents rtapi.Torrents) {
+	labels := make([]string, len(torrents))
+	for i, torrent := range torrents {
+		labels[i] = fmt.Sprintf("hash=\"%s\",label=\"%s\"", torrent.Hash, labelValue(labelName(torrent)))
+	}
+
+	writeMetric(buf, "rtorrent_torrent_ratio", "gauge", "Ratio per torrent.")
+	for i, torrent := range torrents {
+		fmt.Fprintf(buf, "rtorrent_torrent_ratio{%s} %g\n", labels[i], torrent.Ratio)
+	}
+
+	gauges := []struct {
+		name, help string
+		value      func(*rtapi.Torrent) uint64
+	}{
+		{"rtorrent_torrent_size_bytes", "Size per torrent.", func(t *rtapi.Torrent) uint64 { return t.Size }},
+		{"rtorrent_torrent_completed_bytes", "Downloaded bytes per torrent.", func(t *rtapi.Torrent) uint64 { return t.Completed }},
+		{"rtorrent_torrent_uploaded_bytes", "Uploaded bytes per torrent.", func(t *rtapi.Torrent) uint64 { return t.UpTotal }},
+		{"rtorrent_torrent_download_rate_bytes", "Download rate per torrent in bytes per second.", func(t *rtapi.Torrent) uint64 { return t.DownRate }},
+		{"rtorrent_torrent_upload_rate_bytes", "Upload rate per torrent in bytes per second.", func(t *rtapi.Torrent) uint64 { return t.UpRate }},
+	}
+	for _, g := range gauges {
+		writeMetric(buf, g.name, "gauge", g.help)
+		for i, torrent := range torrents {
+			fmt.Fprintf(buf, "%s{%s} %d\n", g.name, labels[i], g.value(torrent))
+		}
+	}
+}
+
+// writeBotMetrics writes the commands handled, the Telegram send errors and the SCGI latency
+func writeBotMetrics(buf *bytes.Buffer) {
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+
+	writeMetric(buf, "rtelegram_commands_total", "counter", "Commands handled per command.")
+	names := make([]string, 0, len(metrics.commands))
+	for name := range metrics.commands {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		fmt.Fprintf(buf, "rtelegram_commands_total{command=\"%s\"} %d\n", labelValue(name), metrics.commands[name])
+	}
+
+	writeMetric(buf, "rtelegram_telegram_send_errors_total", "counter", "Messages Telegram failed to send.")
+	fmt.Fprintf(buf, "rtelegram_telegram_send_errors_total %d\n", metrics.sendErrors.Load())
+
+	writeMetric(buf, "rtelegram_scgi_request_duration_seconds", "histogram", "Latency of the SCGI calls to rTorrent.")
+	for i, bound := range scgiBuckets {
+		fmt.Fprintf(buf, "rtelegram_scgi_request_duration_seconds_bucket{le=\"%g\"} %d\n", bound, metrics.scgiBuckets[i])
+	}
+	fmt.Fprintf(buf, "rtelegram_scgi_request_duration_seconds_bucket{le=\"+Inf\"} %d\n", metrics.scgiCount)
+	fmt.Fprintf(buf, "rtelegram_scgi_request_duration_seconds_sum %g\n", metrics.scgiSum)
+	fmt.Fprintf(buf, "rtelegram_scgi_request_duration_seconds_count %d\n", metrics.scgiCount)
+
+	writeMetric(buf, "rtelegram_scgi_errors_total", "counter", "SCGI calls to rTorrent that failed.")
+	fmt.Fprintf(buf, "rtelegram_scgi_errors_total %d\n", metrics.scgiErrors)
+}
+
+// writeMetric writes the HELP and TYPE lines of a metric
+func writeMetric(buf *bytes.Buffer, name, kind, help string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// labelValue escapes a label value for the text format
+var labelValue = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace
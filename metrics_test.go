@@ -0,0 +1,212 @@
+package main
+
+import (
+	stdErrors "errors"
+	"fmt"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	metricLine  = regexp.MustCompile(`^([a-zA-Z_:][a-zA-Z0-9_:]*)(\{(?:[a-zA-Z_][a-zA-Z0-9_]*="(?:[^"\\\n]|\\["\\n])*",?)*\})? (\S+)$`)
+	commentLine = regexp.MustCompile(`^# (HELP|TYPE) ([a-zA-Z_:][a-zA-Z0-9_:]*) (.+)$`)
+)
+
+// parseExposition checks that text follows Prometheus' text format and returns its samples,
+// keyed by the metric name and its labels as written.
+func parseExposition(t *testing.T, text string) map[string]float64 {
+	t.Helper()
+	if !strings.HasSuffix(text, "\n") {
+		t.Error("the exposition doesn't end with a new line")
+	}
+
+	samples := make(map[string]float64)
+	types := make(map[string]string)
+	helps := make(map[string]bool)
+	done := make(map[string]bool) // families whose samples are over
+	var family string
+	for i, line := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		if m := commentLine.FindStringSubmatch(line); m != nil {
+			name := m[2]
+			if name != family {
+				done[family] = true
+				family = name
+			}
+			if done[name] {
+				t.Errorf("line %d: %s is described again after its samples", i+1, name)
+			}
+			if m[1] == "HELP" {
+				if helps[name] {
+					t.Errorf("line %d: second HELP for %s", i+1, name)
+				}
+				helps[name] = true
+			} else {
+				if _, ok := types[name]; ok {
+					t.Errorf("line %d: second TYPE for %s", i+1, name)
+				}
+				switch m[3] {
+				case "counter", "gauge", "histogram":
+				default:
+					t.Errorf("line %d: unknown type %q", i+1, m[3])
+				}
+				types[name] = m[3]
+			}
+			continue
+		}
+
+		m := metricLine.FindStringSubmatch(line)
+		if m == nil {
+			t.Errorf("line %d: malformed sample %q", i+1, line)
+			continue
+		}
+		name := m[1]
+		if types[family] == "histogram" {
+			for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+				if strings.TrimSuffix(name, suffix) == family {
+					name = family
+				}
+			}
+		}
+		if name != family {
+			t.Errorf("line %d: sample of %s outside its family, after the TYPE of %s", i+1, m[1], family)
+		}
+		if types[family] == "counter" && !strings.HasSuffix(family, "_total") {
+			t.Errorf("line %d: counter %s doesn't end with _total", i+1, family)
+		}
+		value, err := strconv.ParseFloat(m[3], 64)
+		if err != nil {
+			t.Errorf("line %d: value %q: %s", i+1, m[3], err)
+		}
+		key := m[1] + m[2]
+		if _, ok := samples[key]; ok {
+			t.Errorf("line %d: duplicate sample %s", i+1, key)
+		}
+		samples[key] = value
+	}
+
+	for name := range types {
+		if !helps[name] {
+			t.Errorf("%s has a TYPE but no HELP", name)
+		}
+	}
+	return samples
+}
+
+// scrape returns what /metrics serves.
+func scrape(t *testing.T) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	handleMetrics(w, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	return w.Body.String()
+}
+
+func TestMetrics(t *testing.T) {
+	saved := metrics
+	t.Cleanup(func() { metrics = saved })
+	metrics = &botMetrics{commands: make(map[string]uint64), scgiBuckets: make([]uint64, len(scgiBuckets))}
+
+	f := startFakeRtorrent(t,
+		fakeTorrent{name: "a", hash: "AAAA", size: 100, completed: 100, ratio: 1.5, upRate: 10,
+			label: `say%20"hi"\now`, tracker: "https://one.example/announce"},
+		fakeTorrent{name: "b", hash: "BBBB", size: 200, completed: 50, downRate: 30, active: true,
+			tracker: "https://one.example/announce"},
+		fakeTorrent{name: "c", hash: "CCCC", size: 10, completed: 10, tracker: "udp://two.example:80"},
+	)
+	f.handle = func(method string, params []interface{}) (interface{}, error) {
+		switch method {
+		case "throttle.global_down.max_rate":
+			return int64(2048), nil
+		case "throttle.global_up.max_rate":
+			return int64(1024), nil
+		case "directory.default":
+			return "/downloads", nil
+		}
+		return nil, nil
+	}
+
+	metrics.command("list")
+	metrics.command("list")
+	metrics.command(`we"ird`)
+	metrics.sendErrors.Add(2)
+	var ok, failed error = nil, stdErrors.New("refused")
+	observeSCGI(time.Now(), &ok)
+	observeSCGI(time.Now().Add(-time.Minute), &failed)
+
+	samples := parseExposition(t, scrape(t))
+	want := map[string]float64{
+		`rtorrent_up`:                         1,
+		`rtorrent_throttle_download_bytes`:    2048,
+		`rtorrent_throttle_upload_bytes`:      1024,
+		`rtorrent_torrents{state="leeching"}`: 1,
+		`rtorrent_torrents{state="complete"}`: 2,
+		`rtorrent_torrents{state="stopped"}`:  0,
+
+		`rtorrent_tracker_torrents{tracker="one.example"}`:   2,
+		`rtorrent_tracker_size_bytes{tracker="one.example"}`: 300,
+		`rtorrent_tracker_torrents{tracker="two.example"}`:   1,
+
+		`rtorrent_torrent_ratio{hash="AAAA",label="say \"hi\"\\now"}`:             1.5,
+		`rtorrent_torrent_upload_rate_bytes{hash="AAAA",label="say \"hi\"\\now"}`: 10,
+		`rtorrent_torrent_completed_bytes{hash="BBBB",label=""}`:                  50,
+
+		`rtelegram_commands_total{command="list"}`:      2,
+		`rtelegram_commands_total{command="we\"ird"}`:   1,
+		`rtelegram_telegram_send_errors_total`:          2,
+		`rtelegram_scgi_errors_total`:                   1,
+		`rtelegram_scgi_request_duration_seconds_count`: 2,
+	}
+	for key, value := range want {
+		if got, ok := samples[key]; !ok || got != value {
+			t.Errorf("%s = %g (present: %t), want %g", key, got, ok, value)
+		}
+	}
+
+	// the buckets are cumulative, the quick call is in all of them, the minute long one only in +Inf,
+	// the bot's metrics are written before the scrape makes its own calls
+	for _, bound := range scgiBuckets {
+		key := fmt.Sprintf(`rtelegram_scgi_request_duration_seconds_bucket{le="%g"}`, bound)
+		if samples[key] != 1 {
+			t.Errorf("%s = %g, want 1", key, samples[key])
+		}
+	}
+	if key := `rtelegram_scgi_request_duration_seconds_bucket{le="+Inf"}`; samples[key] != 2 {
+		t.Errorf("%s = %g, want 2", key, samples[key])
+	}
+	if sum := samples["rtelegram_scgi_request_duration_seconds_sum"]; sum < 60 {
+		t.Errorf("rtelegram_scgi_request_duration_seconds_sum = %g, want at least 60", sum)
+	}
+}
+
+func TestMetricsWithoutRtorrent(t *testing.T) {
+	f := startFakeRtorrent(t, fakeTorrent{name: "a", hash: "AAAA", tracker: "https://one.example/announce"})
+	f.handle = func(method string, params []interface{}) (interface{}, error) {
+		switch method {
+		case "throttle.global_up.max_rate":
+			// after the torrents and the stats were read
+			return nil, stdErrors.New("Connection refused")
+		case "directory.default":
+			return "/downloads", nil
+		}
+		return nil, nil
+	}
+
+	samples := parseExposition(t, scrape(t))
+	if up, ok := samples["rtorrent_up"]; !ok || up != 0 {
+		t.Errorf("rtorrent_up = %g (present: %t), want 0", up, ok)
+	}
+	for key := range samples {
+		if strings.HasPrefix(key, "rtorrent_") && key != "rtorrent_up" {
+			t.Errorf("%s is served while rTorrent can't be reached", key)
+		}
+	}
+	if _, ok := samples["rtelegram_scgi_errors_total"]; !ok {
+		t.Error("the bot's own metrics are missing")
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	stdErrors "errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	humanize "github.com/pyed/go-humanize"
+	"github.com/pyed/rtapi"
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// moveProgressEvery is how often the progress of a copy across filesystems gets updated.
+const moveProgressEvery = 5 * time.Second
+
+// move takes id[s] of torrent[s] followed by a directory to move their data to it,
+// e.g. "move 1a2b3c /mnt/archive", "move 1a2b3c 4d5e6f ~/done"
+func move(s *session, tokens []string) {
+	if len(tokens) < 2 {
+		s.send("move: needs torrent ID[s] and a directory", false)
+		return
+	}
+
+	dir, created, err := prepareDir(tokens[len(tokens)-1])
+	if err != nil {
+		s.send("move: "+err.Error(), false)
+		return
+	}
+	if created {
+		s.send("New directory created: "+dir, false)
+	}
+
+	torrents, err := s.torrents()
+	if err != nil {
+		logger.Print("move:", err)
+		s.send("move: "+err.Error(), false)
+		return
+	}
+
+	for _, i := range tokens[:len(tokens)-1] {
+		torrent, err := findTorrent(torrents, i)
+		if err != nil {
+			s.send("move: "+err.Error(), false)
+			continue
+		}
+
+		warning, err := moveTorrent(s, torrent, dir)
+		if err != nil {
+			logger.Print("move:", err)
+			s.send(fmt.Sprintf("move: %s: %s", torrent.Name, err), false)
+			continue
+		}
+		s.send(fmt.Sprintf("Moved to %s: %s", dir, torrent.Name), false)
+		if warning != "" {
+			s.send(fmt.Sprintf("move: %s: %s", torrent.Name, warning), false)
+		}
+	}
+}
+
+// the filesystem calls of moves, replaced by the tests to move across filesystems and to fail
+var (
+	rename    = os.Rename
+	removeAll = os.RemoveAll
+)
+
+// moveTorrent stops a torrent, moves its data into dir, points rTorrent to the new place,
+// and starts it again if it was running. It returns a warning if the data got moved but
+// the copy left behind couldn't be removed.
+func moveTorrent(s *session, torrent *rtapi.Torrent, dir string) (string, error) {
+	// d.base_path is empty for closed torrents, so the path is built from d.directory
+	source, err := torrentDataPath(torrent.Hash)
+	if err != nil {
+		return "", err
+	}
+	target := filepath.Join(dir, filepath.Base(source))
+	if target == source {
+		return "", fmt.Errorf("already in %s", dir)
+	}
+	if _, err := os.Lstat(target); err == nil {
+		return "", fmt.Errorf("%s already exists", target)
+	}
+
+	state, err := rtCall("d.state", torrent.Hash)
+	if err != nil {
+		return "", err
+	}
+	running := rtInt(state) == 1
+
+	// a failed move leaves the torrent as it was, running again if it was
+	fail := func(err error) (string, error) {
+		if err := restartTorrent(torrent.Hash, running); err != nil {
+			logger.Print("move:", err)
+		}
+		return "", err
+	}
+
+	for _, method := range []string{"d.stop", "d.close"} {
+		if _, err := rtCall(method, torrent.Hash); err != nil {
+			return fail(err)
+		}
+	}
+
+	// torrents that didn't download anything yet may have no data at all
+	var moved, copied bool
+	if _, err := os.Lstat(source); err == nil {
+		if copied, err = moveData(s, source, target); err != nil {
+			return fail(err)
+		}
+		moved = true
+	}
+
+	if _, err := rtCall("d.directory.set", torrent.Hash, dir); err != nil {
+		// put the data back where rTorrent still looks for it, a copy still has its source
+		var undo error
+		switch {
+		case copied:
+			undo = removeAll(target)
+		case moved:
+			undo = rename(target, source)
+		}
+		if undo != nil {
+			logger.Print("move:", undo)
+			return fail(fmt.Errorf("data moved to %s, but rTorrent didn't take the new directory: %s", target, err))
+		}
+		return fail(fmt.Errorf("rTorrent didn't take the new directory: %s", err))
+	}
+	if err := restartTorrent(torrent.Hash, running); err != nil {
+		return "", err
+	}
+
+	// rTorrent uses the copy now, what's left of the source is only taking space
+	if copied {
+		if err := removeAll(source); err != nil {
+			logger.Print("move:", err)
+			return "couldn't remove the data left in the old place: " + err.Error(), nil
+		}
+	}
+	return "", nil
+}
+
+// torrentDataPath returns the path of the data of a torrent, its directory for multi-file torrents
+func torrentDataPath(hash string) (string, error) {
+	directory, err := rtCall("d.directory", hash)
+	if err != nil {
+		return "", err
+	}
+	multi, err := rtCall("d.is_multi_file", hash)
+	if err != nil {
+		return "", err
+	}
+	if rtInt(multi) == 1 {
+		return rtString(directory), nil
+	}
+
+	name, err := rtCall("d.name", hash)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(rtString(directory), rtString(name)), nil
+}
+
+// restartTorrent starts a torrent again if it was running
+func restartTorrent(hash string, running bool) error {
+	if !running {
+		return nil
+	}
+	_, err := rtCall("d.start", hash)
+	return err
+}
+
+// moveData renames source to target, or copies it with progress messages when they are on different
+// filesystems, copied is true if source got copied and still has to be removed.
+func moveData(s *session, source, target string) (copied bool, err error) {
+	err = rename(source, target)
+	if err == nil || !stdErrors.Is(err, syscall.EXDEV) {
+		return false, err
+	}
+
+	var total int64
+	filepath.Walk(source, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			total += info.Size()
+		}
+		return nil
+	})
+
+	name := filepath.Base(source)
+	msgID := s.send(fmt.Sprintf("Copying %s to %s (%s)", name, filepath.Dir(target), humanize.IBytes(uint64(total))), false)
+
+	var written atomic.Int64
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(moveProgressEvery)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				n := written.Load()
+				var percent float64
+				if total > 0 {
+					percent = float64(n) / float64(total) * 100
+				}
+				editConf := tgbotapi.NewEditMessageText(s.chatID, msgID, fmt.Sprintf("Copying %s to %s: %s of %s (%.1f%%)",
+					name, filepath.Dir(target), humanize.IBytes(uint64(n)), humanize.IBytes(uint64(total)), percent))
+				Bot.Send(editConf)
+			}
+		}
+	}()
+
+	err = copyTree(source, target, &written)
+	close(done)
+	if err != nil {
+		// don't leave a partial copy behind, the source is still intact
+		removeAll(target)
+		return false, err
+	}
+	return true, nil
+}
+
+// copyTree copies a file or a directory recursively, keeping modes and symlinks, counting the copied bytes
+func copyTree(source, target string, copied *atomic.Int64) error {
+	return filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(target, rel)
+
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(dst, info.Mode().Perm())
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, dst)
+		default:
+			return copyFile(path, dst, info.Mode().Perm(), copied)
+		}
+	})
+}
+
+// copyFile copies a regular file, counting the copied bytes
+func copyFile(source, target string, perm os.FileMode, copied *atomic.Int64) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, io.TeeReader(in, countingWriter{copied})); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// countingWriter counts the bytes written to it, and discards them.
+type countingWriter struct {
+	n *atomic.Int64
+}
+
+func (w countingWriter) Write(p []byte) (int, error) {
+	w.n.Add(int64(len(p)))
+	return len(p), nil
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+
+	"github.com/pyed/rtapi"
+)
+
+// writeTree creates files under dir, mapping their relative paths to their contents.
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for rel, content := range files {
+		path := filepath.Join(dir, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCopyTree(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "pack")
+	writeTree(t, source, map[string]string{
+		"a.mkv":          "0123456789",
+		"extras/b.nfo":   "info",
+		"extras/c/d.txt": "",
+	})
+	if err := os.Symlink("a.mkv", filepath.Join(source, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(source, "a.mkv"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	target := filepath.Join(t.TempDir(), "pack")
+	var copied atomic.Int64
+	if err := copyTree(source, target, &copied); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := copied.Load(); n != 14 {
+		t.Errorf("copied %d bytes, want 14", n)
+	}
+	for rel, want := range map[string]string{"a.mkv": "0123456789", "extras/b.nfo": "info", "extras/c/d.txt": ""} {
+		got, err := os.ReadFile(filepath.Join(target, rel))
+		if err != nil {
+			t.Errorf("%s: %s", rel, err)
+			continue
+		}
+		if string(got) != want {
+			t.Errorf("%s = %q, want %q", rel, got, want)
+		}
+	}
+
+	info, err := os.Stat(filepath.Join(target, "a.mkv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("mode of a.mkv = %v, want 0600", info.Mode().Perm())
+	}
+	if link, err := os.Readlink(filepath.Join(target, "link")); err != nil || link != "a.mkv" {
+		t.Errorf("link = %q, %v, want a symlink to a.mkv", link, err)
+	}
+
+	// the source is left alone
+	if _, err := os.Stat(filepath.Join(source, "extras/b.nfo")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCopyTreeSingleFile(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"file.iso": "iso"})
+
+	target := filepath.Join(t.TempDir(), "file.iso")
+	var copied atomic.Int64
+	if err := copyTree(filepath.Join(dir, "file.iso"), target, &copied); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(target); err != nil || string(got) != "iso" {
+		t.Errorf("file.iso = %q, %v", got, err)
+	}
+
+	// an existing file isn't overwritten
+	if err := copyTree(filepath.Join(dir, "file.iso"), target, &copied); err == nil {
+		t.Error("copying over an existing file: no error")
+	}
+}
+
+// startMoveRtorrent fakes rTorrent for moves of a running single-file torrent, its d.directory.set fails with refuse.
+func startMoveRtorrent(t *testing.T, dir string, refuse error) *fakeRtorrent {
+	startFakeTelegram(t)
+	f := startFakeRtorrent(t, fakeTorrent{name: "file.iso", hash: "AAAA0000", active: true})
+	f.handle = func(method string, params []interface{}) (interface{}, error) {
+		switch method {
+		case "d.directory":
+			return dir, nil
+		case "d.name":
+			return "file.iso", nil
+		case "d.state":
+			return int64(1), nil
+		case "d.directory.set":
+			return nil, refuse
+		}
+		return nil, nil
+	}
+	return f
+}
+
+// crossFilesystems makes renames fail as they do between filesystems until the test ends,
+// and removals of the paths in failing fail.
+func crossFilesystems(t *testing.T, failing ...string) {
+	savedRename, savedRemoveAll := rename, removeAll
+	t.Cleanup(func() { rename, removeAll = savedRename, savedRemoveAll })
+	rename = func(source, target string) error {
+		return &os.LinkError{Op: "rename", Old: source, New: target, Err: syscall.EXDEV}
+	}
+	removeAll = func(path string) error {
+		if slices.Contains(failing, path) {
+			return &os.PathError{Op: "unlinkat", Path: path, Err: syscall.EBUSY}
+		}
+		return os.RemoveAll(path)
+	}
+}
+
+func TestMoveTorrent(t *testing.T) {
+	for _, cross := range []bool{false, true} {
+		source, dir := t.TempDir(), t.TempDir()
+		writeTree(t, source, map[string]string{"file.iso": "iso"})
+		f := startMoveRtorrent(t, source, nil)
+		if cross {
+			crossFilesystems(t)
+		}
+
+		warning, err := moveTorrent(&session{chatID: 1}, &rtapi.Torrent{Name: "file.iso", Hash: "AAAA0000"}, dir)
+		if err != nil || warning != "" {
+			t.Errorf("across filesystems %t: %q, %v", cross, warning, err)
+		}
+		if got, err := os.ReadFile(filepath.Join(dir, "file.iso")); err != nil || string(got) != "iso" {
+			t.Errorf("across filesystems %t: moved file.iso = %q, %v", cross, got, err)
+		}
+		if _, err := os.Lstat(filepath.Join(source, "file.iso")); !os.IsNotExist(err) {
+			t.Errorf("across filesystems %t: the source is still there: %v", cross, err)
+		}
+		want := []string{"d.directory AAAA0000", "d.is_multi_file AAAA0000", "d.name AAAA0000", "d.state AAAA0000",
+			"d.stop AAAA0000", "d.close AAAA0000", "d.directory.set AAAA0000 " + dir, "d.start AAAA0000"}
+		if calls := f.called(); !slices.Equal(calls, want) {
+			t.Errorf("across filesystems %t: calls %q, want %q", cross, calls, want)
+		}
+	}
+}
+
+func TestMoveTorrentLeftovers(t *testing.T) {
+	source, dir := t.TempDir(), t.TempDir()
+	writeTree(t, source, map[string]string{"file.iso": "iso"})
+	f := startMoveRtorrent(t, source, nil)
+	crossFilesystems(t, filepath.Join(source, "file.iso"))
+
+	// the copy is used anyway, the source left behind is only worth a warning
+	warning, err := moveTorrent(&session{chatID: 1}, &rtapi.Torrent{Name: "file.iso", Hash: "AAAA0000"}, dir)
+	if err != nil || !strings.Contains(warning, "couldn't remove") {
+		t.Errorf("moveTorrent = %q, %v, want a warning", warning, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "file.iso")); err != nil {
+		t.Error(err)
+	}
+	if calls := f.called(); !slices.Contains(calls, "d.directory.set AAAA0000 "+dir) || calls[len(calls)-1] != "d.start AAAA0000" {
+		t.Errorf("calls %q, want the new directory and a start", calls)
+	}
+}
+
+func TestMoveTorrentRefused(t *testing.T) {
+	for _, cross := range []bool{false, true} {
+		source, dir := t.TempDir(), t.TempDir()
+		writeTree(t, source, map[string]string{"file.iso": "iso"})
+		f := startMoveRtorrent(t, source, fmt.Errorf("Could not set directory."))
+		if cross {
+			crossFilesystems(t)
+		}
+
+		// the data goes back where rTorrent looks for it, and the torrent runs again
+		_, err := moveTorrent(&session{chatID: 1}, &rtapi.Torrent{Name: "file.iso", Hash: "AAAA0000"}, dir)
+		if err == nil || !strings.Contains(err.Error(), "didn't take the new directory") {
+			t.Errorf("across filesystems %t: err = %v", cross, err)
+		}
+		if got, err := os.ReadFile(filepath.Join(source, "file.iso")); err != nil || string(got) != "iso" {
+			t.Errorf("across filesystems %t: file.iso = %q, %v, want it back in place", cross, got, err)
+		}
+		if _, err := os.Lstat(filepath.Join(dir, "file.iso")); !os.IsNotExist(err) {
+			t.Errorf("across filesystems %t: the moved data is still there: %v", cross, err)
+		}
+		if calls := f.called(); calls[len(calls)-1] != "d.start AAAA0000" {
+			t.Errorf("across filesystems %t: calls %q, want a start last", cross, calls)
+		}
+	}
+}
+
+func TestMoveTorrentCloseFails(t *testing.T) {
+	source, dir := t.TempDir(), t.TempDir()
+	writeTree(t, source, map[string]string{"file.iso": "iso"})
+	f := startMoveRtorrent(t, source, nil)
+	handle := f.handle
+	f.handle = func(method string, params []interface{}) (interface{}, error) {
+		if method == "d.close" {
+			return nil, fmt.Errorf("Could not close.")
+		}
+		return handle(method, params)
+	}
+
+	if _, err := moveTorrent(&session{chatID: 1}, &rtapi.Torrent{Name: "file.iso", Hash: "AAAA0000"}, dir); err == nil {
+		t.Error("no error")
+	}
+	if _, err := os.Stat(filepath.Join(source, "file.iso")); err != nil {
+		t.Errorf("the data moved: %v", err)
+	}
+	if calls := f.called(); calls[len(calls)-1] != "d.start AAAA0000" {
+		t.Errorf("calls %q, want the stopped torrent started again", calls)
+	}
+}
@@ -9,28 +9,29 @@ import (
 )
 
 // paused will send the names of the torrents with status 'Paused'
-func paused() {
-	torrents, err := rtorrent.Torrents()
+func paused(s *session, tokens []string) {
+	query, tokens := parseLabelQuery(tokens)
+	torrents, err := s.torrents()
 	if err != nil {
 		logger.Print(err)
-		send("paused: "+err.Error(), false)
+		s.send("paused: "+err.Error(), false)
 		return
 	}
 
+	ids := torrentIDs(torrents)
+	torrents = filterState(query.filter(torrents), rtapi.Stopped)
 	buf := new(bytes.Buffer)
 	for i := range torrents {
-		if torrents[i].State == rtapi.Stopped {
-			buf.WriteString(fmt.Sprintf("<%d> %s\n%s (%s) DL: %s UL: %s  R: %s\n\n",
-				i, torrents[i].Name, torrents[i].State,
-				torrents[i].Percent, humanize.IBytes(torrents[i].Completed),
-				humanize.IBytes(torrents[i].UpTotal), torrents[i].Ratio))
-		}
+		buf.WriteString(fmt.Sprintf("<%s> %s\n%s (%s) DL: %s UL: %s  R: %.2f\n\n",
+			ids[torrents[i].Hash], torrents[i].Name, torrents[i].State,
+			torrents[i].Percent, humanize.IBytes(torrents[i].Completed),
+			humanize.IBytes(torrents[i].UpTotal), torrents[i].Ratio))
 	}
 
 	if buf.Len() == 0 {
-		send("No paused torrents", false)
+		s.send("No paused torrents", false)
 		return
 	}
 
-	send(buf.String(), false)
+	s.send(buf.String(), false)
 }
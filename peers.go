@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"slices"
+	"time"
+
+	humanize "github.com/pyed/go-humanize"
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// maxPeers is how many peers 'peers' shows, so the message fits in one Telegram message and stays editable.
+const maxPeers = 25
+
+// peer is a peer connected to a torrent.
+type peer struct {
+	address   string
+	client    string
+	percent   int64
+	downRate  uint64
+	upRate    uint64
+	encrypted bool
+	incoming  bool
+	snubbed   bool
+}
+
+// flags returns the flags of the peer, E: encrypted, I: incoming, S: snubbed
+func (p peer) flags() string {
+	flags := ""
+	if p.encrypted {
+		flags += "E"
+	}
+	if p.incoming {
+		flags += "I"
+	}
+	if p.snubbed {
+		flags += "S"
+	}
+	if flags == "" {
+		return "-"
+	}
+	return flags
+}
+
+// getPeers returns the peers of a torrent
+func getPeers(hash string) ([]peer, error) {
+	result, err := rtCall("p.multicall", hash, "",
+		"p.address=", "p.client_version=", "p.completed_percent=", "p.down_rate=", "p.up_rate=",
+		"p.is_encrypted=", "p.is_incoming=", "p.is_snubbed=")
+	if err != nil {
+		return nil, err
+	}
+
+	rows := rtList(result)
+	peers := make([]peer, 0, len(rows))
+	for _, row := range rows {
+		fields := rtList(row)
+		if len(fields) < 8 {
+			return nil, fmt.Errorf("p.multicall: expected 8 fields, got %d", len(fields))
+		}
+		peers = append(peers, peer{
+			address:   rtString(fields[0]),
+			client:    rtString(fields[1]),
+			percent:   rtInt(fields[2]),
+			downRate:  uint64(rtInt(fields[3])),
+			upRate:    uint64(rtInt(fields[4])),
+			encrypted: rtInt(fields[5]) == 1,
+			incoming:  rtInt(fields[6]) == 1,
+			snubbed:   rtInt(fields[7]) == 1,
+		})
+	}
+	return peers, nil
+}
+
+// peers lists the peers of a torrent with their client, progress, rates and flags
+func peers(s *session, tokens []string) {
+	if len(tokens) == 0 {
+		s.send("peers: needs a torrent ID", false)
+		return
+	}
+
+	torrents, err := s.torrents()
+	if err != nil {
+		logger.Print("peers:", err)
+		s.send("peers: "+err.Error(), false)
+		return
+	}
+
+	torrent, err := findTorrent(torrents, tokens[0])
+	if err != nil {
+		s.send("peers: "+err.Error(), false)
+		return
+	}
+	id := torrentIDs(torrents)[torrent.Hash]
+
+	list, err := getPeers(torrent.Hash)
+	if err != nil {
+		logger.Print("peers:", err)
+		s.send("peers: "+err.Error(), false)
+		return
+	}
+
+	msgID := s.send(formatPeers(id, torrent.Name, list, true), true)
+
+	if !s.isLive() {
+		return
+	}
+
+	// keep the peers live for 'duration * interval'
+	for i := 0; i < duration; i++ {
+		time.Sleep(time.Second * interval)
+
+		list, err = getPeers(torrent.Hash)
+		if err != nil {
+			logger.Print("peers:", err)
+			return // maybe the torrent got deleted
+		}
+
+		editConf := tgbotapi.NewEditMessageText(s.chatID, msgID, formatPeers(id, torrent.Name, list, true))
+		editConf.ParseMode = tgbotapi.ModeMarkdown
+		Bot.Send(editConf)
+	}
+	// sleep one more time before putting the dashes
+	time.Sleep(time.Second * interval)
+
+	// replace the rates with dashes to indicate that we are done being live
+	editConf := tgbotapi.NewEditMessageText(s.chatID, msgID, formatPeers(id, torrent.Name, list, false))
+	editConf.ParseMode = tgbotapi.ModeMarkdown
+	Bot.Send(editConf)
+}
+
+// formatPeers formats the peers of a torrent as markdown, rates are replaced with dashes when not live
+func formatPeers(id, name string, peers []peer, live bool) string {
+	buf := new(bytes.Buffer)
+	buf.WriteString(fmt.Sprintf("`<%s>` *%s*\n%d peers\n\n", id, mdReplacer.Replace(name), len(peers)))
+
+	// the busiest peers first, the rest only get counted
+	peers = slices.Clone(peers)
+	slices.SortStableFunc(peers, func(a, b peer) int {
+		return cmp.Compare(b.downRate+b.upRate, a.downRate+a.upRate)
+	})
+
+	for _, p := range peers[:min(maxPeers, len(peers))] {
+		down, up := "-", "-"
+		if live {
+			down, up = humanize.IBytes(p.downRate), humanize.IBytes(p.upRate)
+		}
+		buf.WriteString(fmt.Sprintf("`%s` %s\n*%d%%* ↓ *%s*  ↑ *%s* flags: *%s*\n",
+			p.address, mdReplacer.Replace(p.client), p.percent, down, up, p.flags()))
+	}
+	if len(peers) > maxPeers {
+		buf.WriteString(fmt.Sprintf("\n+%d more\n", len(peers)-maxPeers))
+	}
+	return buf.String()
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// live toggles live updates for the chat, or shows the current state without arguments
+func live(s *session, tokens []string) {
+	if len(tokens) == 0 {
+		s.send(fmt.Sprintf("live: *%s*", onOff(s.isLive())), true)
+		return
+	}
+
+	on, ok := parseOnOff(tokens[0])
+	if !ok {
+		s.send("live: takes either 'on' or 'off'", false)
+		return
+	}
+	s.setLive(on)
+	s.send(fmt.Sprintf("live: *%s*", onOff(on)), true)
+}
+
+// notify toggles the notifications of the chat, all of them or of one kind of events,
+// e.g. "notify off", "notify stalled on", shows the subscriptions without arguments
+func notify(s *session, tokens []string) {
+	if len(tokens) == 0 {
+		buf := new(bytes.Buffer)
+		for _, kind := range eventKinds {
+			buf.WriteString(fmt.Sprintf("%s: *%s*\n", kind, onOff(s.subscribed(kind))))
+		}
+		s.send(buf.String(), true)
+		return
+	}
+
+	kinds := eventKinds
+	if len(tokens) > 1 {
+		kind := eventKind(strings.ToLower(tokens[0]))
+		if !slices.Contains(eventKinds, kind) {
+			s.send(fmt.Sprintf("notify: unknown event: %s", tokens[0]), false)
+			return
+		}
+		kinds = []eventKind{kind}
+		tokens = tokens[1:]
+	}
+
+	on, ok := parseOnOff(tokens[0])
+	if !ok {
+		s.send("notify: takes either 'on' or 'off'", false)
+		return
+	}
+
+	for _, kind := range kinds {
+		s.subscribe(kind, on)
+	}
+	s.send(fmt.Sprintf("notify: %s *%s*", strings.Join(eventKindNames(kinds), ", "), onOff(on)), true)
+}
+
+// eventKindNames converts kinds to strings
+func eventKindNames(kinds []eventKind) []string {
+	names := make([]string, len(kinds))
+	for i := range kinds {
+		names[i] = string(kinds[i])
+	}
+	return names
+}
+
+// parseOnOff parses "on" and "off", ok is false for anything else
+func parseOnOff(token string) (on, ok bool) {
+	switch strings.ToLower(token) {
+	case "on":
+		return true, true
+	case "off":
+		return false, true
+	}
+	return false, false
+}
+
+// onOff formats a bool as "on" or "off"
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
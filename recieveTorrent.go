@@ -1,16 +1,23 @@
 package main
 
 import (
+	stdErrors "errors"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
 	"os"
 	"strings"
 
-	"github.com/pyed/rtapi"
+	humanize "github.com/pyed/go-humanize"
 	tgbotapi "gopkg.in/telegram-bot-api.v4"
 )
 
+// maxTorrentFile is the biggest .torrent file the bot accepts, telegram doesn't let bots download more than 20MB anyway.
+const maxTorrentFile = 20 << 20
+
 // receiveTorrent gets an update that potentially has a .torrent file to add
-func receiveTorrent(ud tgbotapi.Update) {
+func receiveTorrent(s *session, ud tgbotapi.Update) {
 	if ud.Message.Document == nil {
 		return // has no document
 	}
@@ -21,52 +28,65 @@ func receiveTorrent(ud tgbotapi.Update) {
 	}
 	file, err := Bot.GetFile(fconfig)
 	if err != nil {
-		send("receiver: "+err.Error(), false)
+		s.send("receiver: "+err.Error(), false)
 		return
 	}
 
-	// if there's no options, just add the torrent
-	if ud.Message.Caption == "" {
-		add([]string{file.Link(BotToken)}, ud.Message.Document.FileName)
+	// download the .torrent ourselves, its link has the bot token in it and shouldn't reach rTorrent
+	data, err := downloadTorrentFile(file.Link(BotToken))
+	if err != nil {
+		logger.Print("receiver:", err)
+		s.send("receiver: couldn't download the file", false)
 		return
 	}
 
-	var tFile rtapi.DotTorrentWithOptions
-	tFile.Link = file.Link(BotToken)
-	tFile.Name = ud.Message.Document.FileName
-	tFile.Dir, tFile.Label = processOptions(ud.Message.Caption)
-
-	// check if dir is there, or try to make it.
-	if tFile.Dir != "" {
-		// if there's '~' expand it
-		if strings.HasPrefix(tFile.Dir, "~") {
-			homedir, err := os.UserHomeDir()
-			if err != nil {
-				send(fmt.Sprintf("receiver: Couldn't expand '~' in: %s", tFile.Dir), false)
-				return
-			}
-			tFile.Dir = strings.Replace(tFile.Dir, "~", homedir, 1)
-		}
+	meta, err := parseTorrent(data)
+	if err != nil {
+		s.send(fmt.Sprintf("receiver: %s: %s", ud.Message.Document.FileName, err), false)
+		return
+	}
 
-		// if the directory isn't there, create it
-		if _, err := os.Stat(tFile.Dir); os.IsNotExist(err) {
-			if err = os.MkdirAll(tFile.Dir, os.ModePerm); err != nil {
-				send(fmt.Sprintf("receiver: Couldn't make directory %s, error: %s", tFile.Dir, err.Error()), false)
-				return
-			} else {
-				send("New directory created: "+tFile.Dir, false)
-			}
-		}
+	if err := checkDuplicate(meta.infoHash); err != nil {
+		s.send("receiver: "+err.Error(), false)
+		return
 	}
 
-	// add the .torrent with options
-	if err := rtorrent.DownloadWithOptions(&tFile); err != nil {
-		logger.Print("add with options:", err)
-		send("add with options: "+err.Error(), false)
+	dir, label := processOptions(ud.Message.Caption)
+
+	// the directory gets created once the user adds the torrent, see 'handleUpload'
+	if dir, err = expandHome(dir); err != nil {
+		s.send("receiver: "+err.Error(), false)
+		return
 	}
 
-	send(fmt.Sprintf("Added: %s", tFile.Name), false)
+	// nothing reaches rTorrent until the user sees what's inside and picks a button
+	previewUpload(s, data, meta, dir, label)
+}
+
+// downloadTorrentFile downloads a file sent to the bot, errors are stripped of the URL since it has the bot token
+func downloadTorrentFile(link string) ([]byte, error) {
+	resp, err := http.Get(link)
+	if err != nil {
+		var urlErr *url.Error
+		if stdErrors.As(err, &urlErr) {
+			return nil, urlErr.Err
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download: %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxTorrentFile+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxTorrentFile {
+		return nil, fmt.Errorf("the file is bigger than %s", humanize.IBytes(maxTorrentFile))
+	}
+	return data, nil
 }
 
 // processOptions looks inside 'ud.Message.Caption' and processes the passed options if any;
@@ -94,3 +114,32 @@ func processOptions(options string) (dir, lable string) {
 	}
 	return
 }
+
+// expandHome expands a leading '~' in dir to the home directory
+func expandHome(dir string) (string, error) {
+	if !strings.HasPrefix(dir, "~") {
+		return dir, nil
+	}
+	homedir, err := os.UserHomeDir()
+	if err != nil {
+		return dir, fmt.Errorf("Couldn't expand '~' in: %s", dir)
+	}
+	return strings.Replace(dir, "~", homedir, 1), nil
+}
+
+// prepareDir expands a leading '~' in dir to the home directory, and creates dir if it isn't there,
+// created reports whether it had to be created.
+func prepareDir(dir string) (path string, created bool, err error) {
+	if dir, err = expandHome(dir); err != nil {
+		return dir, false, err
+	}
+
+	// if the directory isn't there, create it
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if err = os.MkdirAll(dir, os.ModePerm); err != nil {
+			return dir, false, fmt.Errorf("Couldn't make directory %s, error: %s", dir, err.Error())
+		}
+		return dir, true, nil
+	}
+	return dir, false, nil
+}
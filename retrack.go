@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+
+	"github.com/pyed/rtapi"
+)
+
+// trackerChange is a tracker URL of a torrent to be replaced.
+type trackerChange struct {
+	index  int // index of the old tracker, as in "hash:t1"
+	oldURL string
+	newURL string
+}
+
+// retrackChanges returns the enabled trackers of a torrent that match re, with their new URLs,
+// template may refer to the groups of re, e.g. "$1".
+func retrackChanges(hash string, re *regexp.Regexp, template string) ([]trackerChange, error) {
+	trackers, err := torrentTrackers(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []trackerChange
+	for i, t := range trackers {
+		if !t.enabled || !re.MatchString(t.url) {
+			continue
+		}
+		newURL := re.ReplaceAllString(t.url, template)
+		if newURL == t.url {
+			continue
+		}
+		changes = append(changes, trackerChange{index: i, oldURL: t.url, newURL: newURL})
+	}
+	return changes, nil
+}
+
+// applyRetrack disables the old trackers of a torrent, adds the new ones and reannounces,
+// the old ones get disabled first since inserting trackers may shift the indexes.
+func applyRetrack(hash string, changes []trackerChange) error {
+	for _, c := range changes {
+		if err := setTrackerEnabled(hash, c.index, false); err != nil {
+			return err
+		}
+	}
+
+	added := make(map[string]bool)
+	for _, c := range changes {
+		if added[c.newURL] {
+			continue
+		}
+		if _, err := rtCall("d.tracker.insert", hash, "0", c.newURL); err != nil {
+			return err
+		}
+		added[c.newURL] = true
+	}
+
+	_, err := rtCall("d.tracker_announce", hash)
+	return err
+}
+
+// retrack replaces the tracker URLs matching a regular expression in all the torrents, e.g. after a passkey
+// change: "retrack oldpasskey newpasskey", "retrack https://old\.example/(.*) https://new.example/$1"
+func retrack(s *session, tokens []string) {
+	if len(tokens) != 2 {
+		s.send("retrack: needs a pattern and a new URL, e.g. 'retrack oldpasskey newpasskey'", false)
+		return
+	}
+
+	re, err := regexp.Compile(tokens[0])
+	if err != nil {
+		s.send("retrack: "+err.Error(), false)
+		return
+	}
+	template := tokens[1]
+
+	torrents, err := s.torrents()
+	if err != nil {
+		logger.Print("retrack:", err)
+		s.send("retrack: "+err.Error(), false)
+		return
+	}
+	ids := torrentIDs(torrents)
+
+	var matched rtapi.Torrents
+	buf := new(bytes.Buffer)
+	for _, torrent := range torrents {
+		changes, err := retrackChanges(torrent.Hash, re, template)
+		if err != nil {
+			logger.Print("retrack:", err)
+			s.send("retrack: "+err.Error(), false)
+			return
+		}
+		if len(changes) == 0 {
+			continue
+		}
+
+		matched = append(matched, torrent)
+		buf.WriteString(fmt.Sprintf("`<%s>` %s\n", ids[torrent.Hash], mdReplacer.Replace(torrent.Name)))
+		for _, c := range changes {
+			buf.WriteString(fmt.Sprintf("`%s`\n→ `%s`\n", c.oldURL, c.newURL))
+		}
+	}
+
+	if len(matched) == 0 {
+		s.send(fmt.Sprintf("retrack: no enabled tracker matches '%s'", tokens[0]), false)
+		return
+	}
+
+	summary := fmt.Sprintf("*Retrack* (%d):\n%s", len(matched), buf.String())
+	askConfirmation(s, summary, func() {
+		for _, torrent := range matched {
+			// the trackers may have changed while waiting for the confirmation
+			changes, err := retrackChanges(torrent.Hash, re, template)
+			if err == nil && len(changes) > 0 {
+				err = applyRetrack(torrent.Hash, changes)
+			}
+			if err != nil {
+				logger.Print("retrack:", err)
+				s.send(fmt.Sprintf("retrack: %s: %s", torrent.Name, err), false)
+				continue
+			}
+			if len(changes) == 0 {
+				s.send(fmt.Sprintf("Nothing to retrack anymore: %s", torrent.Name), false)
+				continue
+			}
+			s.send(fmt.Sprintf("Retracked and reannounced: %s", torrent.Name), false)
+		}
+	})
+}
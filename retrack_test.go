@@ -0,0 +1,57 @@
+package main
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestRetrack(t *testing.T) {
+	f := startFakeRtorrent(t)
+	f.handle = func(method string, params []interface{}) (interface{}, error) {
+		if method != "t.multicall" {
+			return nil, nil
+		}
+		// url, enabled, seeders, leechers, last success, last failure, failures
+		return []interface{}{
+			[]interface{}{"https://old.example/abc123/announce", int64(1), int64(0), int64(0), int64(0), int64(0), int64(0)},
+			[]interface{}{"https://other.example/announce", int64(1), int64(0), int64(0), int64(0), int64(0), int64(0)},
+			[]interface{}{"https://old.example/abc123/disabled", int64(0), int64(0), int64(0), int64(0), int64(0), int64(0)},
+			[]interface{}{"udp://old.example:80/abc123", int64(1), int64(0), int64(0), int64(0), int64(0), int64(0)},
+		}, nil
+	}
+
+	re := regexp.MustCompile(`https://old\.example/(\w+)/`)
+	changes, err := retrackChanges("AAAA", re, "https://new.example/$1/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []trackerChange{{index: 0, oldURL: "https://old.example/abc123/announce", newURL: "https://new.example/abc123/announce"}}
+	if !reflect.DeepEqual(changes, want) {
+		t.Fatalf("retrackChanges = %+v, want %+v", changes, want)
+	}
+
+	// a replacement that changes nothing isn't a change
+	if changes, _ := retrackChanges("AAAA", regexp.MustCompile("other"), "other"); len(changes) != 0 {
+		t.Errorf("retrackChanges with the same URL = %+v, want none", changes)
+	}
+
+	// the old trackers get disabled before adding the new ones, which may shift the indexes
+	changes, _ = retrackChanges("AAAA", regexp.MustCompile("abc123"), "xyz789")
+	if err := applyRetrack("AAAA", changes); err != nil {
+		t.Fatal(err)
+	}
+	wantCalls := []string{
+		"t.multicall AAAA  t.url= t.is_enabled= t.scrape_complete= t.scrape_incomplete= t.success_time_last= t.failed_time_last= t.failed_counter=",
+		"t.multicall AAAA  t.url= t.is_enabled= t.scrape_complete= t.scrape_incomplete= t.success_time_last= t.failed_time_last= t.failed_counter=",
+		"t.multicall AAAA  t.url= t.is_enabled= t.scrape_complete= t.scrape_incomplete= t.success_time_last= t.failed_time_last= t.failed_counter=",
+		"t.is_enabled.set AAAA:t0 false",
+		"t.is_enabled.set AAAA:t3 false",
+		"d.tracker.insert AAAA 0 https://old.example/xyz789/announce",
+		"d.tracker.insert AAAA 0 udp://old.example:80/xyz789",
+		"d.tracker_announce AAAA",
+	}
+	if got := f.called(); !reflect.DeepEqual(got, wantCalls) {
+		t.Errorf("calls:\n%q\nwant:\n%q", got, wantCalls)
+	}
+}
@@ -0,0 +1,545 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	stdErrors "errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	humanize "github.com/pyed/go-humanize"
+)
+
+const (
+	// rssFile holds the feeds and what has been seen of them, inside the data directory.
+	rssFile = "rss.json"
+
+	// rssSeenMax is how many items and episodes get remembered per feed.
+	rssSeenMax = 1000
+)
+
+// rssFeed is a feed that gets polled for torrents to add, matching items get added with
+// the directory and label of the feed.
+type rssFeed struct {
+	Name    string `json:"name"`
+	URL     string `json:"url"`
+	Include string `json:"include,omitempty"` // regular expression titles must match
+	Exclude string `json:"exclude,omitempty"` // regular expression titles must not match
+	MinSize uint64 `json:"min_size,omitempty"`
+	MaxSize uint64 `json:"max_size,omitempty"` // 0 for no upper bound
+	Dir     string `json:"dir,omitempty"`
+	Label   string `json:"label,omitempty"`
+	Dedupe  bool   `json:"dedupe,omitempty"` // add every episode only once, e.g. the first of "S01E02 720p" and "S01E02 1080p"
+
+	Primed   bool     `json:"primed"` // the first poll only marks the items that are already there as seen
+	Seen     []string `json:"seen,omitempty"`
+	Episodes []string `json:"episodes,omitempty"`
+	Failed   []string `json:"failed,omitempty"` // items whose add failed on the last poll, to notify only once
+}
+
+// rssFeeds is what gets saved to 'rssFile'.
+type rssFeeds struct {
+	Feeds []rssFeed `json:"feeds"`
+}
+
+var (
+	feeds   rssFeeds
+	feedsMu sync.Mutex
+
+	// pollMu makes polls wait for each other, 'rss add' polls while the watcher may be polling
+	pollMu sync.Mutex
+
+	// rssCheck wakes the feed watcher up for an immediate poll
+	rssCheck = make(chan struct{}, 1)
+
+	rssClient = &http.Client{Timeout: 30 * time.Second}
+
+	// episodeRegex matches the show and the episode in titles like "Show.Name.S01E02.720p" or "Show Name 1x02"
+	episodeRegex = regexp.MustCompile(`(?i)^(.*?)[\s._-]*(?:s(\d{1,2})e(\d{1,3})|(\d{1,2})x(\d{2,3}))`)
+)
+
+// String formats the feed as shown by the 'rss' command.
+func (f rssFeed) String() string {
+	buf := new(bytes.Buffer)
+	// only the host, feed URLs often carry passkeys
+	host := f.URL
+	if u, err := url.Parse(f.URL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	buf.WriteString(fmt.Sprintf("*%s* `%s`", mdReplacer.Replace(f.Name), host))
+	if f.Include != "" {
+		buf.WriteString(fmt.Sprintf("\ninclude: `%s`", f.Include))
+	}
+	if f.Exclude != "" {
+		buf.WriteString(fmt.Sprintf("\nexclude: `%s`", f.Exclude))
+	}
+	if f.MinSize > 0 || f.MaxSize > 0 {
+		max := "any"
+		if f.MaxSize > 0 {
+			max = humanize.IBytes(f.MaxSize)
+		}
+		buf.WriteString(fmt.Sprintf("\nsize: *%s* - *%s*", humanize.IBytes(f.MinSize), max))
+	}
+	if f.Dir != "" {
+		buf.WriteString(fmt.Sprintf("\ndir: `%s`", f.Dir))
+	}
+	if f.Label != "" {
+		buf.WriteString(fmt.Sprintf("\nlabel: `%s`", f.Label))
+	}
+	if f.Dedupe {
+		buf.WriteString("\nepisodes only once")
+	}
+	return buf.String()
+}
+
+// rssItem is an item of a RSS feed, or an entry of an Atom feed.
+type rssItem struct {
+	title string
+	id    string // guid, or the link if the feed has none
+	link  string // the .torrent URL or the magnet
+	size  uint64 // 0 if the feed doesn't tell
+}
+
+// matches reports whether an item passes the filters of the feed.
+func (f rssFeed) matches(item rssItem) (bool, error) {
+	if f.Include != "" {
+		ok, err := regexp.MatchString("(?i)"+f.Include, item.title)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	if f.Exclude != "" {
+		ok, err := regexp.MatchString("(?i)"+f.Exclude, item.title)
+		if err != nil || ok {
+			return false, err
+		}
+	}
+
+	// items of an unknown size pass the bounds
+	if item.size > 0 && (item.size < f.MinSize || (f.MaxSize > 0 && item.size > f.MaxSize)) {
+		return false, nil
+	}
+	return true, nil
+}
+
+// episodeKey returns the show and the episode of a title, e.g. "show name s01e02", empty if it's not an episode
+func episodeKey(title string) string {
+	m := episodeRegex.FindStringSubmatch(title)
+	if m == nil {
+		return ""
+	}
+
+	show := strings.ToLower(strings.Join(strings.FieldsFunc(m[1], func(r rune) bool {
+		return r == '.' || r == '_' || r == '-' || r == ' '
+	}), " "))
+	season, episode := m[2], m[3]
+	if season == "" {
+		season, episode = m[4], m[5]
+	}
+	s, _ := strconv.Atoi(season)
+	e, _ := strconv.Atoi(episode)
+	return fmt.Sprintf("%s s%02de%02d", show, s, e)
+}
+
+// fetchFeed downloads and parses a RSS or Atom feed
+func fetchFeed(url string) ([]rssItem, error) {
+	resp, err := rssClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return nil, err
+	}
+	return parseFeed(data)
+}
+
+// parseFeed parses a RSS 2.0 or an Atom feed
+func parseFeed(data []byte) ([]rssItem, error) {
+	var doc struct {
+		XMLName xml.Name
+		Items   []struct {
+			Title     string `xml:"title"`
+			Link      string `xml:"link"`
+			GUID      string `xml:"guid"`
+			Enclosure struct {
+				URL    string `xml:"url,attr"`
+				Length uint64 `xml:"length,attr"`
+			} `xml:"enclosure"`
+			ContentLength uint64 `xml:"contentLength"` // torrent namespace, used by some trackers
+		} `xml:"channel>item"`
+		Entries []struct {
+			Title string `xml:"title"`
+			ID    string `xml:"id"`
+			Links []struct {
+				Href   string `xml:"href,attr"`
+				Rel    string `xml:"rel,attr"`
+				Length uint64 `xml:"length,attr"`
+			} `xml:"link"`
+		} `xml:"entry"`
+	}
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("not a RSS or Atom feed: %s", err)
+	}
+
+	var items []rssItem
+	for _, i := range doc.Items {
+		item := rssItem{title: i.Title, id: i.GUID, link: i.Link, size: i.ContentLength}
+		if i.Enclosure.URL != "" {
+			item.link = i.Enclosure.URL
+			if i.Enclosure.Length > 0 {
+				item.size = i.Enclosure.Length
+			}
+		}
+		items = append(items, item)
+	}
+
+	for _, e := range doc.Entries {
+		item := rssItem{title: e.Title, id: e.ID}
+		for _, l := range e.Links {
+			// prefer the enclosure, which is the torrent, over the page of the item
+			if item.link == "" || l.Rel == "enclosure" {
+				item.link, item.size = l.Href, l.Length
+			}
+		}
+		items = append(items, item)
+	}
+
+	for i := range items {
+		items[i].title = strings.TrimSpace(items[i].title)
+		items[i].link = strings.TrimSpace(items[i].link)
+		if items[i].id == "" {
+			items[i].id = items[i].link
+		}
+	}
+	return items, nil
+}
+
+// loadFeeds reads the feeds from the data directory.
+func loadFeeds() error {
+	feedsMu.Lock()
+	defer feedsMu.Unlock()
+	return loadJSON(rssFile, &feeds)
+}
+
+// editFeeds applies edit to the feeds and saves them.
+func editFeeds(edit func(*rssFeeds) error) error {
+	feedsMu.Lock()
+	defer feedsMu.Unlock()
+
+	edited := rssFeeds{Feeds: append([]rssFeed(nil), feeds.Feeds...)}
+	if err := edit(&edited); err != nil {
+		return err
+	}
+	if err := saveJSON(rssFile, edited); err != nil {
+		return err
+	}
+	feeds = edited
+	return nil
+}
+
+// watchFeeds polls all the feeds every 'every', or when asked to by 'rss check'
+func watchFeeds(every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		feedsMu.Lock()
+		current := append([]rssFeed(nil), feeds.Feeds...)
+		feedsMu.Unlock()
+
+		for _, feed := range current {
+			if err := pollFeed(feed); err != nil {
+				logger.Printf("rss: %s: %s", feed.Name, err)
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-rssCheck:
+		}
+	}
+}
+
+// pollFeed adds the new matching items of a feed and remembers what it has seen
+func pollFeed(feed rssFeed) error {
+	pollMu.Lock()
+	defer pollMu.Unlock()
+
+	// what's been seen may have changed while waiting for another poll
+	feedsMu.Lock()
+	found := false
+	for _, f := range feeds.Feeds {
+		if f.Name == feed.Name && f.URL == feed.URL {
+			feed, found = f, true
+			break
+		}
+	}
+	feedsMu.Unlock()
+	if !found {
+		return nil
+	}
+
+	items, err := fetchFeed(feed.URL)
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool, len(feed.Seen))
+	for _, id := range feed.Seen {
+		seen[id] = true
+	}
+	episodes := make(map[string]bool, len(feed.Episodes))
+	for _, ep := range feed.Episodes {
+		episodes[ep] = true
+	}
+	failed := make(map[string]bool, len(feed.Failed))
+	for _, id := range feed.Failed {
+		failed[id] = true
+	}
+
+	var newSeen, newEpisodes, stillFailing []string
+	markSeen := func(item rssItem) {
+		seen[item.id] = true
+		newSeen = append(newSeen, item.id)
+	}
+	for _, item := range items {
+		if item.id == "" || seen[item.id] {
+			continue
+		}
+
+		if !feed.Primed {
+			markSeen(item)
+			continue
+		}
+
+		ok, err := feed.matches(item)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			markSeen(item)
+			continue
+		}
+
+		ep := ""
+		if feed.Dedupe {
+			if ep = episodeKey(item.title); ep != "" && episodes[ep] {
+				markSeen(item)
+				continue
+			}
+		}
+
+		// failed adds stay unseen so they get retried on the next poll, unless
+		// there's nothing to retry, the failure is only notified the first time
+		err = addFeedItem(feed, item)
+		if err != nil {
+			logger.Printf("rss: %s: %s", feed.Name, err)
+			if !failed[item.id] {
+				publish(event{kind: evRSS, name: item.title, message: fmt.Sprintf("Failed to add from %s: %s", feed.Name, err)})
+			}
+			if item.link != "" && !stdErrors.Is(err, errAlreadyPresent) {
+				stillFailing = append(stillFailing, item.id)
+				continue
+			}
+		} else {
+			publish(event{kind: evRSS, name: item.title, message: "From: " + feed.Name})
+		}
+
+		markSeen(item)
+		if ep != "" {
+			episodes[ep] = true
+			newEpisodes = append(newEpisodes, ep)
+		}
+	}
+
+	if feed.Primed && len(newSeen) == 0 && slices.Equal(feed.Failed, stillFailing) {
+		return nil
+	}
+
+	// the feed may have been edited or removed in the meantime
+	return editFeeds(func(rf *rssFeeds) error {
+		for i := range rf.Feeds {
+			f := &rf.Feeds[i]
+			if f.Name != feed.Name || f.URL != feed.URL {
+				continue
+			}
+			f.Primed = true
+			f.Seen = lastN(append(f.Seen, newSeen...), rssSeenMax)
+			f.Episodes = lastN(append(f.Episodes, newEpisodes...), rssSeenMax)
+			f.Failed = stillFailing
+		}
+		return nil
+	})
+}
+
+// addFeedItem adds an item with the directory and the label of its feed
+func addFeedItem(feed rssFeed, item rssItem) error {
+	if item.link == "" {
+		return fmt.Errorf("%s has no link", item.title)
+	}
+
+	dir := feed.Dir
+	if dir != "" {
+		var err error
+		if dir, _, err = prepareDir(dir); err != nil {
+			return err
+		}
+	}
+	return addTorrent(item.link, item.title, dir, feed.Label, true)
+}
+
+// lastN returns the last n elements of s
+func lastN(s []string, n int) []string {
+	if len(s) > n {
+		return s[len(s)-n:]
+	}
+	return s
+}
+
+// rssCmd shows and edits the feeds:
+// "rss", "rss add <name> <url> [include=RE] [exclude=RE] [min=SIZE] [max=SIZE] [d=DIR] [l=LABEL] [dedupe]",
+// "rss del <n>", "rss check"
+func rssCmd(s *session, tokens []string) {
+	if len(tokens) == 0 {
+		feedsMu.Lock()
+		buf := new(bytes.Buffer)
+		for i, feed := range feeds.Feeds {
+			buf.WriteString(fmt.Sprintf("`<%d>` %s\n\n", i, feed))
+		}
+		feedsMu.Unlock()
+
+		if buf.Len() == 0 {
+			buf.WriteString("No feeds, add one with: *rss add shows https://example.org/rss include=720p dedupe l=TV*\n")
+		}
+		s.send(buf.String(), true)
+		return
+	}
+
+	var err error
+	switch strings.ToLower(tokens[0]) {
+	case "add":
+		var feed rssFeed
+		if feed, err = parseFeedArgs(tokens[1:]); err == nil {
+			err = editFeeds(func(rf *rssFeeds) error {
+				for _, f := range rf.Feeds {
+					if strings.EqualFold(f.Name, feed.Name) {
+						return fmt.Errorf("there's already a feed named '%s'", feed.Name)
+					}
+				}
+				rf.Feeds = append(rf.Feeds, feed)
+				return nil
+			})
+		}
+		if err == nil {
+			// fetch it now, so it starts watching from what's in the feed already
+			if err = pollFeed(feed); err != nil {
+				err = fmt.Errorf("feed added, but fetching it failed: %s", err)
+			}
+		}
+
+	case "del":
+		if len(tokens) < 2 {
+			err = fmt.Errorf("needs the number of a feed")
+			break
+		}
+		err = editFeeds(func(rf *rssFeeds) error {
+			n, err := strconv.Atoi(tokens[1])
+			if err != nil || n < 0 || n >= len(rf.Feeds) {
+				return fmt.Errorf("no feed with the number '%s'", tokens[1])
+			}
+			rf.Feeds = append(rf.Feeds[:n], rf.Feeds[n+1:]...)
+			return nil
+		})
+
+	case "check":
+		select {
+		case rssCheck <- struct{}{}:
+		default:
+		}
+		s.send("Checking the feeds", false)
+		return
+
+	default:
+		err = fmt.Errorf("unknown argument: %s", tokens[0])
+	}
+
+	if err != nil {
+		s.send("rss: "+err.Error(), false)
+		return
+	}
+	rssCmd(s, nil)
+}
+
+// rssPerm listing the feeds is for viewers, editing them is for masters
+func rssPerm(tokens []string) permission {
+	if len(tokens) > 0 {
+		return permControl
+	}
+	return permView
+}
+
+// parseFeedArgs parses "<name> <url> [options...]", options are like processOptions' d= and l=
+func parseFeedArgs(tokens []string) (rssFeed, error) {
+	var feed rssFeed
+	if len(tokens) < 2 {
+		return feed, fmt.Errorf("usage: rss add <name> <url> [include=RE] [exclude=RE] [min=SIZE] [max=SIZE] [d=DIR] [l=LABEL] [dedupe]")
+	}
+	feed.Name, feed.URL = tokens[0], tokens[1]
+	if !strings.HasPrefix(feed.URL, "http://") && !strings.HasPrefix(feed.URL, "https://") {
+		return feed, fmt.Errorf("'%s' is not a http(s) URL", feed.URL)
+	}
+
+	for _, token := range tokens[2:] {
+		if strings.ToLower(token) == "dedupe" {
+			feed.Dedupe = true
+			continue
+		}
+
+		key, value, ok := strings.Cut(token, "=")
+		if !ok {
+			return feed, fmt.Errorf("unknown option '%s'", token)
+		}
+
+		var err error
+		switch strings.ToLower(key) {
+		case "include", "exclude":
+			if _, err = regexp.Compile(value); err != nil {
+				return feed, err
+			}
+			if strings.ToLower(key) == "include" {
+				feed.Include = value
+			} else {
+				feed.Exclude = value
+			}
+		case "min":
+			feed.MinSize, err = parseSize(value)
+		case "max":
+			feed.MaxSize, err = parseSize(value)
+		case "d":
+			feed.Dir = value
+		case "l":
+			feed.Label = value
+		default:
+			return feed, fmt.Errorf("unknown option '%s'", token)
+		}
+		if err != nil {
+			return feed, err
+		}
+	}
+	return feed, nil
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestEpisodeKey(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"Show.Name.S01E02.720p.WEB", "show name s01e02"},
+		{"Show Name - s1e2 - Title", "show name s01e02"},
+		{"show_name.S10E100.1080p", "show name s10e100"},
+		{"Show Name 1x02 HDTV", "show name s01e02"},
+		{"SHOW.NAME.S01E02.REPACK", "show name s01e02"},
+		{"Some.Movie.2019.1080p", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := episodeKey(tt.title); got != tt.want {
+			t.Errorf("episodeKey(%q) = %q, want %q", tt.title, got, tt.want)
+		}
+	}
+}
+
+func TestParseFeed(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    []rssItem
+		wantErr bool
+	}{
+		{
+			name: "rss",
+			data: `<?xml version="1.0"?>
+<rss version="2.0" xmlns:torrent="http://xmlns.ezrss.it/0.1/">
+<channel>
+	<item>
+		<title> Show.S01E01 </title>
+		<link>https://example.com/1.torrent</link>
+		<guid>item-1</guid>
+		<torrent:contentLength>1024</torrent:contentLength>
+	</item>
+	<item>
+		<title>Show.S01E02</title>
+		<link>https://example.com/page/2</link>
+		<enclosure url="https://example.com/2.torrent" length="2048" type="application/x-bittorrent"/>
+	</item>
+</channel>
+</rss>`,
+			want: []rssItem{
+				{title: "Show.S01E01", id: "item-1", link: "https://example.com/1.torrent", size: 1024},
+				{title: "Show.S01E02", id: "https://example.com/2.torrent", link: "https://example.com/2.torrent", size: 2048},
+			},
+		},
+		{
+			name: "atom",
+			data: `<?xml version="1.0"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+	<entry>
+		<title>Show.S01E03</title>
+		<id>urn:entry:3</id>
+		<link rel="alternate" href="https://example.com/page/3"/>
+		<link rel="enclosure" href="magnet:?xt=urn:btih:abc" length="4096"/>
+	</entry>
+	<entry>
+		<title>Show.S01E04</title>
+		<link href="https://example.com/4.torrent"/>
+	</entry>
+</feed>`,
+			want: []rssItem{
+				{title: "Show.S01E03", id: "urn:entry:3", link: "magnet:?xt=urn:btih:abc", size: 4096},
+				{title: "Show.S01E04", id: "https://example.com/4.torrent", link: "https://example.com/4.torrent"},
+			},
+		},
+		{
+			name:    "not a feed",
+			data:    "<html><body>",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseFeed([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFeedMatches(t *testing.T) {
+	feed := rssFeed{Include: `s\d+e\d+`, Exclude: "cam", MinSize: 100, MaxSize: 1000}
+
+	check := func(item rssItem, want bool) {
+		t.Helper()
+		if got, err := feed.matches(item); err != nil || got != want {
+			t.Errorf("matches(%+v) = %t, %v, want %t", item, got, err, want)
+		}
+	}
+
+	check(rssItem{title: "Show.S01E01", size: 500}, true)
+	check(rssItem{title: "Show.S01E01"}, true) // the size of the item is unknown
+	check(rssItem{title: "Show.S01E01.CAM", size: 500}, false)
+	check(rssItem{title: "Some.Movie", size: 500}, false)
+	check(rssItem{title: "Show.S01E01", size: 50}, false)
+	check(rssItem{title: "Show.S01E01", size: 5000}, false)
+
+	// a bad pattern is an error, not a match
+	if _, err := (rssFeed{Include: "("}).matches(rssItem{title: "a"}); err == nil {
+		t.Error("matches with an invalid include pattern: no error")
+	}
+}
+
+// drainEvents returns the events published so far.
+func drainEvents() []event {
+	var published []event
+	for {
+		select {
+		case e := <-events:
+			published = append(published, e)
+		default:
+			return published
+		}
+	}
+}
+
+// startFeed serves a feed with one magnet item and saves it as the only, primed, feed until the test ends.
+func startFeed(t *testing.T, dir string) rssFeed {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `<rss><channel><item><title>Show.S01E01</title><guid>ep-1</guid>
+<link>magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567</link></item></channel></rss>`)
+	}))
+	t.Cleanup(server.Close)
+
+	savedDir, savedFeeds := DataDir, feeds
+	t.Cleanup(func() { DataDir, feeds = savedDir, savedFeeds })
+	DataDir = t.TempDir()
+	feed := rssFeed{Name: "shows", URL: server.URL, Dir: dir, Primed: true}
+	feeds = rssFeeds{Feeds: []rssFeed{feed}}
+	drainEvents()
+	return feed
+}
+
+func TestPollFeedFailures(t *testing.T) {
+	feed := startFeed(t, "")
+	f := startFakeRtorrent(t)
+	f.down = true
+
+	// the failure is notified once, and retried on every poll
+	for poll := 1; poll <= 3; poll++ {
+		if err := pollFeed(feed); err != nil {
+			t.Fatal(err)
+		}
+		published := drainEvents()
+		if poll == 1 && (len(published) != 1 || !strings.HasPrefix(published[0].message, "Failed to add")) {
+			t.Errorf("poll %d: published %v, want the failure", poll, published)
+		}
+		if poll > 1 && len(published) != 0 {
+			t.Errorf("poll %d: published %v again", poll, published)
+		}
+		if got := feeds.Feeds[0]; len(got.Seen) != 0 || !reflect.DeepEqual(got.Failed, []string{"ep-1"}) {
+			t.Errorf("poll %d: seen %q, failed %q", poll, got.Seen, got.Failed)
+		}
+	}
+
+	f.mu.Lock()
+	f.down = false
+	f.mu.Unlock()
+	if err := pollFeed(feed); err != nil {
+		t.Fatal(err)
+	}
+	if published := drainEvents(); len(published) != 1 || published[0].message != "From: shows" {
+		t.Errorf("published %v, want the item added", published)
+	}
+	if got := feeds.Feeds[0]; !reflect.DeepEqual(got.Seen, []string{"ep-1"}) || len(got.Failed) != 0 {
+		t.Errorf("seen %q, failed %q, want the item seen only", got.Seen, got.Failed)
+	}
+}
+
+func TestPollFeedConcurrently(t *testing.T) {
+	startFakeRtorrent(t)
+	feed := startFeed(t, "")
+
+	// like 'rss add' while the watcher polls, both polls start from the same copy of the feed
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := pollFeed(feed); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if published := drainEvents(); len(published) != 1 {
+		t.Errorf("published %v, want the item added once", published)
+	}
+	if seen := feeds.Feeds[0].Seen; !reflect.DeepEqual(seen, []string{"ep-1"}) {
+		t.Errorf("seen %q", seen)
+	}
+}
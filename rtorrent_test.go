@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pyed/rtapi"
+)
+
+// fakeTorrent is a torrent of the fake rTorrent.
+type fakeTorrent struct {
+	name, hash, path, label, message, tracker string
+	size, completed, downRate, upRate         uint64
+	ratio                                     float64
+	active, multiFile                         bool
+}
+
+// fakeRtorrent answers XML-RPC calls over SCGI the way rTorrent does, for rtapi and rtCall.
+type fakeRtorrent struct {
+	mu       sync.Mutex
+	torrents []fakeTorrent
+	calls    []string // "method param..." of the calls that aren't covered by the fake itself
+
+	// handle answers the calls that aren't covered by the fake itself, it may be nil,
+	// and a nil result is answered as 0
+	handle func(method string, params []interface{}) (interface{}, error)
+
+	down bool // every call fails, as if rTorrent was gone
+}
+
+// startFakeRtorrent points rtCall and rtorrent at a fake rTorrent holding torrents, until the test ends.
+func startFakeRtorrent(t *testing.T, torrents ...fakeTorrent) *fakeRtorrent {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &fakeRtorrent{torrents: torrents}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+
+	savedURL, savedRtorrent := SCGIURL, rtorrent
+	t.Cleanup(func() {
+		l.Close()
+		SCGIURL, rtorrent = savedURL, savedRtorrent
+	})
+
+	SCGIURL = l.Addr().String()
+	if rtorrent, err = rtapi.NewRtorrent(SCGIURL); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+// called returns the calls made to methods that aren't covered by the fake itself.
+func (f *fakeRtorrent) called() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+// serve answers one SCGI request.
+func (f *fakeRtorrent) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	// "<length>:<headers>,<body>", the headers are NUL separated pairs
+	length, err := r.ReadString(':')
+	if err != nil {
+		return
+	}
+	n, _ := strconv.Atoi(strings.TrimSuffix(length, ":"))
+	headers := make([]byte, n+1)
+	if _, err := io.ReadFull(r, headers); err != nil {
+		return
+	}
+	fields := strings.Split(string(headers), "\x00")
+	var size int
+	for i := 0; i+1 < len(fields); i += 2 {
+		if fields[i] == "CONTENT_LENGTH" {
+			size, _ = strconv.Atoi(fields[i+1])
+		}
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return
+	}
+
+	var call struct {
+		MethodName string        `xml:"methodName"`
+		Params     []xmlrpcValue `xml:"params>param>value"`
+	}
+	if err := xml.Unmarshal(body, &call); err != nil {
+		return
+	}
+	params := make([]interface{}, len(call.Params))
+	for i := range call.Params {
+		params[i] = call.Params[i].decode()
+	}
+
+	buf := new(bytes.Buffer)
+	buf.WriteString("Status: 200 OK\r\nContent-Type: text/xml\r\n\r\n")
+	buf.WriteString(xml.Header)
+	result, err := f.call(call.MethodName, params)
+	if err != nil {
+		buf.WriteString("<methodResponse><fault><value><struct>")
+		buf.WriteString("<member><name>faultCode</name><value><i4>-503</i4></value></member>")
+		buf.WriteString("<member><name>faultString</name><value><string>")
+		xml.EscapeText(buf, []byte(err.Error()))
+		buf.WriteString("</string></value></member></struct></value></fault></methodResponse>")
+	} else {
+		buf.WriteString("<methodResponse><params><param>")
+		if err := encodeValue(buf, result); err != nil {
+			panic(err)
+		}
+		buf.WriteString("</param></params></methodResponse>")
+	}
+	conn.Write(buf.Bytes())
+}
+
+// call answers a method call.
+func (f *fakeRtorrent) call(method string, params []interface{}) (interface{}, error) {
+	f.mu.Lock()
+	down := f.down
+	f.mu.Unlock()
+	if down {
+		return nil, fmt.Errorf("rTorrent is down")
+	}
+
+	switch method {
+	case "system.multicall":
+		var results []interface{}
+		for _, c := range rtList(params[0]) {
+			c, _ := c.(map[string]interface{})
+			result, err := f.call(rtString(c["methodName"]), rtList(c["params"]))
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, []interface{}{result})
+		}
+		return results, nil
+	case "system.client_version":
+		return "0.9.8", nil
+	case "system.library_version":
+		return "0.13.8", nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch method {
+	case "d.multicall2":
+		// params are the target, the view and the fields
+		var rows []interface{}
+		for _, t := range f.torrents {
+			row := make([]interface{}, 0, len(params)-2)
+			for _, field := range params[2:] {
+				value, err := t.field(rtString(field))
+				if err != nil {
+					return nil, err
+				}
+				row = append(row, value)
+			}
+			rows = append(rows, row)
+		}
+		return rows, nil
+	case "t.url":
+		hash, _, _ := strings.Cut(rtString(params[0]), ":")
+		if t := f.torrent(hash); t != nil {
+			return t.tracker, nil
+		}
+		return nil, fmt.Errorf("Could not find info-hash.")
+	}
+
+	call := method
+	for _, p := range params {
+		call += " " + rtString(p)
+	}
+	f.calls = append(f.calls, call)
+
+	switch method {
+	case "d.stop", "d.close":
+		if t := f.torrent(rtString(params[0])); t != nil {
+			t.active = false
+		}
+	case "d.start":
+		if t := f.torrent(rtString(params[0])); t != nil {
+			t.active = true
+		}
+	case "d.erase":
+		for i := range f.torrents {
+			if f.torrents[i].hash == rtString(params[0]) {
+				f.torrents = append(f.torrents[:i], f.torrents[i+1:]...)
+				break
+			}
+		}
+	}
+
+	if f.handle == nil {
+		return int64(0), nil
+	}
+	result, err := f.handle(method, params)
+	if result == nil {
+		// rTorrent answers 0 to the calls that have nothing to return
+		result = int64(0)
+	}
+	return result, err
+}
+
+// field returns the value of a d.multicall2 field, e.g. "d.name=".
+func (t *fakeTorrent) field(name string) (interface{}, error) {
+	complete := t.completed >= t.size
+	switch name {
+	case "d.name=":
+		return t.name, nil
+	case "d.hash=":
+		return t.hash, nil
+	case "d.down.rate=":
+		return t.downRate, nil
+	case "d.up.rate=":
+		return t.upRate, nil
+	case "d.size_chunks=", "d.size_bytes=":
+		return t.size, nil
+	case "d.chunk_size=":
+		return int64(1), nil
+	case "d.completed_chunks=", "d.completed_bytes=":
+		return t.completed, nil
+	case "d.ratio=":
+		return int64(t.ratio * 1000), nil
+	case "d.load_date=", "d.timestamp.finished=":
+		return int64(0), nil
+	case "d.message=":
+		return t.message, nil
+	case "d.base_path=":
+		return t.path, nil
+	case "d.directory=":
+		// the torrent's own directory for multi-file torrents, the one holding the file otherwise
+		if t.multiFile {
+			return t.path, nil
+		}
+		return path.Dir(t.path), nil
+	case "d.is_multi_file=":
+		return rtBool(t.multiFile), nil
+	case "d.is_active=":
+		return rtBool(t.active), nil
+	case "d.connection_current=":
+		if complete {
+			return "seed", nil
+		}
+		return "leech", nil
+	case "d.complete=":
+		return rtBool(complete), nil
+	case "d.hashing=":
+		return int64(0), nil
+	case "d.custom1=":
+		return t.label, nil
+	}
+	return nil, fmt.Errorf("Unsupported d.multicall2 field %s", name)
+}
+
+// rtBool returns a boolean the way rTorrent does, as 0 or 1.
+func rtBool(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// torrent returns the torrent with a hash, f.mu must be held.
+func (f *fakeRtorrent) torrent(hash string) *fakeTorrent {
+	for i := range f.torrents {
+		if f.torrents[i].hash == hash {
+			return &f.torrents[i]
+		}
+	}
+	return nil
+}
+
+func TestRtCall(t *testing.T) {
+	f := startFakeRtorrent(t, fakeTorrent{name: "a", hash: "AAAA", size: 10, completed: 5, tracker: "http://tracker.example/announce"})
+	f.handle = func(method string, params []interface{}) (interface{}, error) {
+		switch method {
+		case "echo":
+			return params, nil
+		case "fail":
+			return nil, fmt.Errorf("Unsupported target type found.")
+		}
+		return nil, nil
+	}
+
+	result, err := rtCall("echo", "a <b>", 42, int64(-1), uint64(7), true, []byte{0, 1}, []interface{}{"x", 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{"a <b>", int64(42), int64(-1), int64(7), true, []byte{0, 1}, []interface{}{"x", int64(1)}}
+	if fmt.Sprint(result) != fmt.Sprint(want) {
+		t.Errorf("echo = %v, want %v", result, want)
+	}
+
+	if _, err := rtCall("fail"); err == nil || err.Error() != "fail: Unsupported target type found." {
+		t.Errorf("fail: error = %v", err)
+	}
+
+	if _, err := rtCall("echo", 1.5); err == nil {
+		t.Error("echo(1.5): no error for an unsupported type")
+	}
+
+	// rtapi talks to the same fake
+	torrents, err := rtorrent.Torrents()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(torrents) != 1 || torrents[0].Hash != "AAAA" || torrents[0].State != rtapi.Stopped ||
+		torrents[0].Percent != "50.0%" || torrents[0].Tracker.Hostname() != "tracker.example" {
+		t.Errorf("Torrents() = %+v", torrents[0])
+	}
+}
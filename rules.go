@@ -0,0 +1,376 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pyed/rtapi"
+)
+
+// rulesFile holds the seeding rules, inside the data directory.
+const rulesFile = "rules.json"
+
+// seeding rule actions, named after the commands that do the same
+const (
+	actionStop    = "stop"
+	actionDel     = "del"
+	actionDelData = "deldata"
+)
+
+// seedingRule applies an action to the complete torrents of its scope once they reach a ratio,
+// or once they have been seeding for some time, whichever comes first.
+type seedingRule struct {
+	Scope    string  `json:"scope"`     // "global", "tracker:<host>" or "label:<label>"
+	Ratio    float64 `json:"ratio"`     // 0 for no ratio goal
+	SeedTime int64   `json:"seed_time"` // seconds, 0 for no time goal
+	Action   string  `json:"action"`    // one of the action* constants
+}
+
+// seedingRules is what gets saved to 'rulesFile'.
+type seedingRules struct {
+	Rules []seedingRule `json:"rules"`
+}
+
+var (
+	rules   seedingRules
+	rulesMu sync.Mutex
+)
+
+// String formats the rule as shown by the 'rules' command.
+func (r seedingRule) String() string {
+	var goals []string
+	if r.Ratio > 0 {
+		goals = append(goals, fmt.Sprintf("ratio *%.2f*", r.Ratio))
+	}
+	if r.SeedTime > 0 {
+		goals = append(goals, fmt.Sprintf("seeding *%s*", formatSeedTime(r.SeedTime)))
+	}
+	return fmt.Sprintf("%s: *%s* at %s", mdReplacer.Replace(r.Scope), r.Action, strings.Join(goals, " or "))
+}
+
+// specificity ranks the scopes, label rules win over tracker rules, which win over global ones
+func (r seedingRule) specificity() int {
+	switch {
+	case strings.HasPrefix(r.Scope, "label:"):
+		return 2
+	case strings.HasPrefix(r.Scope, "tracker:"):
+		return 1
+	}
+	return 0
+}
+
+// covers reports whether the torrent is in the scope of the rule.
+func (r seedingRule) covers(torrent *rtapi.Torrent) bool {
+	scope, value, _ := strings.Cut(r.Scope, ":")
+	switch scope {
+	case "label":
+		return strings.EqualFold(labelName(torrent), value)
+	case "tracker":
+		return matchesTracker(torrent, value)
+	}
+	return true
+}
+
+// matchesTracker reports whether the tracker of a torrent is host or one of its subdomains
+func matchesTracker(torrent *rtapi.Torrent, host string) bool {
+	hostname := strings.ToLower(torrent.Tracker.Hostname())
+	host = strings.ToLower(host)
+	return hostname == host || strings.HasSuffix(hostname, "."+host)
+}
+
+// reached reports whether a torrent that has been seeding for seedTime reached one of the goals of the rule.
+func (r seedingRule) reached(torrent *rtapi.Torrent, seedTime time.Duration) bool {
+	return (r.Ratio > 0 && torrent.Ratio >= r.Ratio) ||
+		(r.SeedTime > 0 && seedTime >= time.Duration(r.SeedTime)*time.Second)
+}
+
+// loadRules reads the seeding rules from the data directory.
+func loadRules() error {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+	return loadJSON(rulesFile, &rules)
+}
+
+// editRules applies edit to the seeding rules and saves them.
+func editRules(edit func(*seedingRules) error) error {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+
+	edited := seedingRules{Rules: append([]seedingRule(nil), rules.Rules...)}
+	if err := edit(&edited); err != nil {
+		return err
+	}
+	if err := saveJSON(rulesFile, edited); err != nil {
+		return err
+	}
+	rules = edited
+	return nil
+}
+
+// rulesFor returns the rules that govern a torrent, only the rules of the most specific scope
+// that covers it count, e.g. a label rule overrides the global rules for the torrents of that label.
+func rulesFor(torrent *rtapi.Torrent) []seedingRule {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+
+	var matched []seedingRule
+	best := -1
+	for _, rule := range rules.Rules {
+		if !rule.covers(torrent) {
+			continue
+		}
+		switch spec := rule.specificity(); {
+		case spec > best:
+			best, matched = spec, []seedingRule{rule}
+		case spec == best:
+			matched = append(matched, rule)
+		}
+	}
+	return matched
+}
+
+// finishedTimes returns when every torrent finished downloading, by hash, as unix time
+func finishedTimes() (map[string]int64, error) {
+	result, err := rtCall("d.multicall2", "", "main", "d.hash=", "d.timestamp.finished=")
+	if err != nil {
+		return nil, err
+	}
+
+	finished := make(map[string]int64)
+	for _, row := range rtList(result) {
+		fields := rtList(row)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("d.multicall2: expected 2 fields, got %d", len(fields))
+		}
+		finished[rtString(fields[0])] = rtInt(fields[1])
+	}
+	return finished, nil
+}
+
+// seedTime returns how long a complete torrent has been seeding, torrents that got added
+// already complete have no finish time, their age is used instead.
+func seedTime(torrent *rtapi.Torrent, finished map[string]int64) time.Duration {
+	since := finished[torrent.Hash]
+	if since == 0 {
+		since = int64(torrent.Age)
+	}
+	return time.Since(time.Unix(since, 0))
+}
+
+// runRules evaluates the seeding rules every 'every', and notifies about every action taken
+func runRules(every time.Duration) {
+	for ; ; time.Sleep(every) {
+		rulesMu.Lock()
+		empty := len(rules.Rules) == 0
+		rulesMu.Unlock()
+		if empty {
+			continue
+		}
+
+		if err := applyRules(); err != nil {
+			logger.Print("rules:", err)
+		}
+	}
+}
+
+// applyRules applies the first rule that a complete torrent reached the goal of
+func applyRules() error {
+	torrents, err := rtorrent.Torrents()
+	if err != nil {
+		return err
+	}
+	finished, err := finishedTimes()
+	if err != nil {
+		return err
+	}
+	ids := torrentIDs(torrents)
+
+	for _, torrent := range torrents {
+		// magnets without their metadata yet have no size, they aren't finished
+		if torrent.Size == 0 || torrent.Completed < torrent.Size || torrent.State == rtapi.Hashing {
+			continue
+		}
+
+		seeding := seedTime(torrent, finished)
+		for _, rule := range rulesFor(torrent) {
+			// stopped torrents have nothing left to stop, rtapi reports finished ones as Complete
+			stopped := torrent.State == rtapi.Stopped || torrent.State == rtapi.Complete
+			if !rule.reached(torrent, seeding) || (rule.Action == actionStop && stopped) {
+				continue
+			}
+
+			// never delete a torrent before it meets the hit and run requirement of its tracker
+			if rule.Action != actionStop && hnrMissing(torrent, finished) != "" {
+				continue
+			}
+
+			var (
+				err  error
+				done string
+			)
+			switch rule.Action {
+			case actionStop:
+				err, done = rtorrent.Stop(torrent), "Stopped"
+			case actionDel:
+				err, done = rtorrent.Delete(false, torrent), "Deleted"
+			case actionDelData:
+				err, done = rtorrent.Delete(true, torrent), "Deleted with data"
+			}
+
+			message := fmt.Sprintf("%s at ratio %.2f after seeding %s, rule: %s", done, torrent.Ratio,
+				formatSeedTime(int64(seeding.Seconds())), rule.Scope)
+			if err != nil {
+				message = fmt.Sprintf("Failed to %s at ratio %.2f, rule: %s: %s", rule.Action, torrent.Ratio, rule.Scope, err)
+			}
+			publish(event{kind: evSeeding, id: ids[torrent.Hash], name: torrent.Name, message: message})
+			break
+		}
+	}
+	return nil
+}
+
+// rulesCmd shows and edits the seeding rules:
+// "rules", "rules add <scope> [ratio=R] [time=T] <stop|del|deldata>", "rules del <n>"
+func rulesCmd(s *session, tokens []string) {
+	if len(tokens) == 0 {
+		rulesMu.Lock()
+		buf := new(bytes.Buffer)
+		for i, rule := range rules.Rules {
+			buf.WriteString(fmt.Sprintf("`<%d>` %s\n", i, rule))
+		}
+		rulesMu.Unlock()
+
+		if buf.Len() == 0 {
+			buf.WriteString("No seeding rules, add one with: *rules add global ratio=2 time=14d stop*\n")
+		}
+		s.send(buf.String(), true)
+		return
+	}
+
+	var err error
+	switch strings.ToLower(tokens[0]) {
+	case "add":
+		var rule seedingRule
+		if rule, err = parseSeedingRule(tokens[1:]); err == nil {
+			err = editRules(func(sr *seedingRules) error {
+				sr.Rules = append(sr.Rules, rule)
+				return nil
+			})
+		}
+
+	case "del":
+		if len(tokens) < 2 {
+			err = fmt.Errorf("needs the number of a rule")
+			break
+		}
+		err = editRules(func(sr *seedingRules) error {
+			n, err := strconv.Atoi(tokens[1])
+			if err != nil || n < 0 || n >= len(sr.Rules) {
+				return fmt.Errorf("no rule with the number '%s'", tokens[1])
+			}
+			sr.Rules = append(sr.Rules[:n], sr.Rules[n+1:]...)
+			return nil
+		})
+
+	default:
+		err = fmt.Errorf("unknown argument: %s", tokens[0])
+	}
+
+	if err != nil {
+		s.send("rules: "+err.Error(), false)
+		return
+	}
+	rulesCmd(s, nil)
+}
+
+// rulesPerm listing the rules is for viewers, editing them is for masters
+func rulesPerm(tokens []string) permission {
+	if len(tokens) > 0 {
+		return permControl
+	}
+	return permView
+}
+
+// parseSeedingRule parses "<scope> [ratio=R] [time=T] <action>", e.g. "tracker:example.org ratio=2 time=14d stop"
+func parseSeedingRule(tokens []string) (seedingRule, error) {
+	var rule seedingRule
+	if len(tokens) < 3 {
+		return rule, fmt.Errorf("usage: rules add <global|tracker:host|label:name> [ratio=R] [time=T] <stop|del|deldata>")
+	}
+
+	scope, value, _ := strings.Cut(tokens[0], ":")
+	switch scope = strings.ToLower(scope); {
+	case scope == "global" && value == "":
+		rule.Scope = scope
+	case (scope == "tracker" || scope == "label") && value != "":
+		rule.Scope = scope + ":" + value
+	default:
+		return rule, fmt.Errorf("unknown scope '%s', expected global, tracker:<host> or label:<name>", tokens[0])
+	}
+
+	for _, token := range tokens[1 : len(tokens)-1] {
+		key, value, _ := strings.Cut(strings.ToLower(token), "=")
+		var err error
+		switch key {
+		case "ratio":
+			if rule.Ratio, err = strconv.ParseFloat(value, 64); err != nil || rule.Ratio <= 0 {
+				return rule, fmt.Errorf("invalid ratio '%s'", value)
+			}
+		case "time":
+			if rule.SeedTime, err = parseSeedTime(value); err != nil {
+				return rule, err
+			}
+		default:
+			return rule, fmt.Errorf("unknown goal '%s', expected ratio=R or time=T", token)
+		}
+	}
+	if rule.Ratio == 0 && rule.SeedTime == 0 {
+		return rule, fmt.Errorf("needs a ratio=R or time=T goal")
+	}
+
+	rule.Action = strings.ToLower(tokens[len(tokens)-1])
+	switch rule.Action {
+	case actionStop, actionDel, actionDelData:
+	default:
+		return rule, fmt.Errorf("unknown action '%s', expected stop, del or deldata", tokens[len(tokens)-1])
+	}
+	return rule, nil
+}
+
+// parseSeedTime parses a seeding time to seconds, e.g. "14d", "36h", "90m"
+func parseSeedTime(value string) (int64, error) {
+	var (
+		d   time.Duration
+		err error
+	)
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		var n float64
+		n, err = strconv.ParseFloat(days, 64)
+		d = time.Duration(n * float64(24*time.Hour))
+	} else {
+		d, err = time.ParseDuration(value)
+	}
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid time '%s', expected e.g. 14d, 36h or 90m", value)
+	}
+	return int64(d.Seconds()), nil
+}
+
+// formatSeedTime formats seconds in days and hours, e.g. "14d", "2d5h", "40m"
+func formatSeedTime(seconds int64) string {
+	d := time.Duration(seconds) * time.Second
+	days, hours := int64(d/(24*time.Hour)), int64(d%(24*time.Hour)/time.Hour)
+	switch {
+	case days > 0 && hours > 0:
+		return fmt.Sprintf("%dd%dh", days, hours)
+	case days > 0:
+		return fmt.Sprintf("%dd", days)
+	case hours > 0:
+		return fmt.Sprintf("%dh", hours)
+	}
+	return fmt.Sprintf("%dm", int64(d/time.Minute))
+}
@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestSeedTime(t *testing.T) {
+	// what users type, in seconds, and how it's shown back
+	times := []struct {
+		typed   string
+		seconds int64
+		shown   string
+	}{
+		{"14d", 14 * 24 * 3600, "14d"},
+		{"1.5d", 36 * 3600, "1d12h"},
+		{"36h", 36 * 3600, "1d12h"},
+		{"53h", 53 * 3600, "2d5h"},
+		{"90m", 90 * 60, "1h"}, // minutes are only shown below an hour
+		{"1h30m", 90 * 60, "1h"},
+		{"40m", 40 * 60, "40m"},
+	}
+	for _, st := range times {
+		seconds, err := parseSeedTime(st.typed)
+		if err != nil || seconds != st.seconds {
+			t.Errorf("parseSeedTime(%q) = %d, %v, want %d", st.typed, seconds, err, st.seconds)
+			continue
+		}
+		if shown := formatSeedTime(seconds); shown != st.shown {
+			t.Errorf("formatSeedTime(%d) = %q, want %q", seconds, shown, st.shown)
+		}
+	}
+
+	if shown := formatSeedTime(0); shown != "0m" {
+		t.Errorf("formatSeedTime(0) = %q, want 0m", shown)
+	}
+
+	// a seed time needs a unit and has to be positive
+	for _, typed := range []string{"0d", "-2h", "14", "d", ""} {
+		if seconds, err := parseSeedTime(typed); err == nil {
+			t.Errorf("parseSeedTime(%q) = %d, want an error", typed, seconds)
+		}
+	}
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// scheduleFile holds the bandwidth schedule, inside the data directory.
+const scheduleFile = "schedule.json"
+
+// scheduleRule applies a throttle profile on some days between two times of the day, a rule
+// that ends before it starts runs overnight, e.g. 22:00-07:00 on fri lasts until sat 07:00.
+type scheduleRule struct {
+	Name string   `json:"name"`
+	Days []string `json:"days"` // e.g. ["mon", "tue"], empty for every day
+	From string   `json:"from"` // "HH:MM"
+	To   string   `json:"to"`   // "HH:MM"
+	Up   uint64   `json:"up"`   // bytes per second, 0 is unlimited
+	Down uint64   `json:"down"` // bytes per second, 0 is unlimited
+}
+
+// bandwidthSchedule is what gets saved to 'scheduleFile'.
+type bandwidthSchedule struct {
+	Enabled bool           `json:"enabled"`
+	Rules   []scheduleRule `json:"rules"`
+}
+
+var (
+	schedule   bandwidthSchedule
+	scheduleMu sync.Mutex
+
+	// scheduleChanged wakes the scheduler up after the schedule gets edited
+	scheduleChanged = make(chan struct{}, 1)
+)
+
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// active reports whether the rule applies at t.
+func (r scheduleRule) active(t time.Time) bool {
+	from, _ := parseClock(r.From)
+	to, _ := parseClock(r.To)
+	now := t.Hour()*60 + t.Minute()
+
+	day := t.Weekday()
+	switch {
+	case from <= to:
+		if now < from || now >= to {
+			return false
+		}
+	case now >= from:
+		// overnight, before midnight
+	case now < to:
+		// overnight, after midnight it is still the rule of the day before
+		day = (day + 6) % 7
+	default:
+		return false
+	}
+
+	if len(r.Days) == 0 {
+		return true
+	}
+	for _, d := range r.Days {
+		if d == weekdays[day] {
+			return true
+		}
+	}
+	return false
+}
+
+// String formats the rule as shown by the 'schedule' command.
+func (r scheduleRule) String() string {
+	days := "every day"
+	if len(r.Days) > 0 {
+		days = strings.Join(r.Days, ",")
+	}
+	return fmt.Sprintf("*%s* %s %s-%s ↑ *%s* ↓ *%s*", r.Name, days, r.From, r.To,
+		formatLimit(r.Up), formatLimit(r.Down))
+}
+
+// loadSchedule reads the schedule from the data directory.
+func loadSchedule() error {
+	scheduleMu.Lock()
+	defer scheduleMu.Unlock()
+	return loadJSON(scheduleFile, &schedule)
+}
+
+// editSchedule applies edit to the schedule, saves it, and wakes the scheduler up.
+func editSchedule(edit func(*bandwidthSchedule) error) error {
+	scheduleMu.Lock()
+	defer scheduleMu.Unlock()
+
+	edited := schedule
+	edited.Rules = append([]scheduleRule(nil), schedule.Rules...)
+	if err := edit(&edited); err != nil {
+		return err
+	}
+	if err := saveJSON(scheduleFile, edited); err != nil {
+		return err
+	}
+	schedule = edited
+
+	select {
+	case scheduleChanged <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// currentProfile returns the name and limits that should be in effect at t, the last matching
+// rule wins, and the normal limits apply when none matches.
+func currentProfile(t time.Time) (name string, up, down uint64) {
+	scheduleMu.Lock()
+	defer scheduleMu.Unlock()
+
+	name, up, down = "normal", NormalLimits[0], NormalLimits[1]
+	for _, rule := range schedule.Rules {
+		if rule.active(t) {
+			name, up, down = rule.Name, rule.Up, rule.Down
+		}
+	}
+	return name, up, down
+}
+
+// runSchedule applies the throttle profiles of the schedule, it only touches the limits when the
+// profile switches, so a manual 'throttle' stays until the next switch.
+func runSchedule() {
+	var applied string // the profile we applied last, empty before the first run
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		scheduleMu.Lock()
+		enabled := schedule.Enabled
+		scheduleMu.Unlock()
+
+		if enabled {
+			name, up, down := currentProfile(time.Now())
+			profile := fmt.Sprintf("%s %d %d", name, up, down)
+
+			if profile != applied {
+				if err := applyProfile(name, up, down, applied == ""); err != nil {
+					logger.Print("schedule:", err)
+				} else {
+					applied = profile
+				}
+			}
+		} else {
+			applied = ""
+		}
+
+		select {
+		case <-ticker.C:
+		case <-scheduleChanged:
+		}
+	}
+}
+
+// applyProfile sets the limits of a profile and notifies the chats, on startup the
+// limits may be already in place, then there's nothing to do.
+func applyProfile(name string, up, down uint64, startup bool) error {
+	if startup {
+		currentUp, currentDown, err := getThrottle()
+		if err != nil {
+			return err
+		}
+		if currentUp == up && currentDown == down {
+			return nil
+		}
+	}
+
+	if err := setThrottle(up, down); err != nil {
+		return err
+	}
+
+	publish(event{kind: evSchedule, name: name,
+		message: fmt.Sprintf("Throttle ↑ %s ↓ %s", formatLimit(up), formatLimit(down))})
+	return nil
+}
+
+// scheduleCmd shows and edits the bandwidth schedule:
+// "schedule", "schedule on|off", "schedule add <name> <days> <HH:MM-HH:MM> <up> <down>", "schedule del <n>"
+func scheduleCmd(s *session, tokens []string) {
+	if len(tokens) == 0 {
+		scheduleMu.Lock()
+		buf := new(bytes.Buffer)
+		buf.WriteString(fmt.Sprintf("Schedule: *%s*\n", onOff(schedule.Enabled)))
+		for i, rule := range schedule.Rules {
+			buf.WriteString(fmt.Sprintf("`<%d>` %s\n", i, rule))
+		}
+		if len(schedule.Rules) == 0 {
+			buf.WriteString("No rules, add one with: *schedule add night mon-fri 22:00-07:00 100K 1M*\n")
+		}
+		scheduleMu.Unlock()
+
+		name, up, down := currentProfile(time.Now())
+		buf.WriteString(fmt.Sprintf("Now: *%s* %s", name, formatThrottle(up, down)))
+		s.send(buf.String(), true)
+		return
+	}
+
+	var err error
+	switch strings.ToLower(tokens[0]) {
+	case "on", "off":
+		on, _ := parseOnOff(tokens[0])
+		err = editSchedule(func(bs *bandwidthSchedule) error {
+			bs.Enabled = on
+			return nil
+		})
+
+	case "add":
+		var rule scheduleRule
+		if rule, err = parseScheduleRule(tokens[1:]); err == nil {
+			err = editSchedule(func(bs *bandwidthSchedule) error {
+				bs.Rules = append(bs.Rules, rule)
+				return nil
+			})
+		}
+
+	case "del":
+		if len(tokens) < 2 {
+			err = fmt.Errorf("needs the number of a rule")
+			break
+		}
+		err = editSchedule(func(bs *bandwidthSchedule) error {
+			n, err := strconv.Atoi(tokens[1])
+			if err != nil || n < 0 || n >= len(bs.Rules) {
+				return fmt.Errorf("no rule with the number '%s'", tokens[1])
+			}
+			bs.Rules = append(bs.Rules[:n], bs.Rules[n+1:]...)
+			return nil
+		})
+
+	default:
+		err = fmt.Errorf("unknown argument: %s", tokens[0])
+	}
+
+	if err != nil {
+		s.send("schedule: "+err.Error(), false)
+		return
+	}
+	scheduleCmd(s, nil)
+}
+
+// parseScheduleRule parses "<name> <days> <HH:MM-HH:MM> <up> <down>", where days is "all", "weekdays",
+// "weekends", or a comma separated list of days and ranges, e.g. "mon-fri", "sat,sun"
+func parseScheduleRule(tokens []string) (scheduleRule, error) {
+	var rule scheduleRule
+	if len(tokens) != 5 {
+		return rule, fmt.Errorf("usage: schedule add <name> <days> <HH:MM-HH:MM> <up> <down>")
+	}
+	rule.Name = tokens[0]
+
+	days, err := parseDays(tokens[1])
+	if err != nil {
+		return rule, err
+	}
+	rule.Days = days
+
+	var ok bool
+	if rule.From, rule.To, ok = strings.Cut(tokens[2], "-"); !ok {
+		return rule, fmt.Errorf("invalid time range '%s', expected HH:MM-HH:MM", tokens[2])
+	}
+	var minutes [2]int
+	for i, clock := range []string{rule.From, rule.To} {
+		if minutes[i], err = parseClock(clock); err != nil {
+			return rule, err
+		}
+	}
+	// it would never apply, a rule for the whole day is 00:00-23:59
+	if minutes[0] == minutes[1] {
+		return rule, fmt.Errorf("empty time range '%s', the end has to be another time than the start", tokens[2])
+	}
+
+	if rule.Up, err = parseSize(tokens[3]); err != nil {
+		return rule, err
+	}
+	if rule.Down, err = parseSize(tokens[4]); err != nil {
+		return rule, err
+	}
+	return rule, nil
+}
+
+// parseDays parses the days of a rule, returns nil for every day
+func parseDays(spec string) ([]string, error) {
+	switch strings.ToLower(spec) {
+	case "all", "daily", "everyday":
+		return nil, nil
+	case "weekdays":
+		spec = "mon-fri"
+	case "weekends":
+		spec = "sat,sun"
+	}
+
+	indexOf := func(day string) (int, error) {
+		for i := range weekdays {
+			if weekdays[i] == day {
+				return i, nil
+			}
+		}
+		return 0, fmt.Errorf("unknown day '%s', expected one of %s", day, strings.Join(weekdays, ","))
+	}
+
+	var days []string
+	for _, part := range strings.Split(strings.ToLower(spec), ",") {
+		first, last, isRange := strings.Cut(part, "-")
+		from, err := indexOf(first)
+		if err != nil {
+			return nil, err
+		}
+		to := from
+		if isRange {
+			if to, err = indexOf(last); err != nil {
+				return nil, err
+			}
+		}
+
+		// ranges may wrap around the week, e.g. fri-mon
+		for i := from; ; i = (i + 1) % 7 {
+			days = append(days, weekdays[i])
+			if i == to {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// parseClock parses "HH:MM" to minutes since midnight
+func parseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time '%s', expected HH:MM", clock)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
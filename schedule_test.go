@@ -0,0 +1,129 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseDays(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []string
+		wantErr bool
+	}{
+		{in: "all", want: nil},
+		{in: "Daily", want: nil},
+		{in: "weekdays", want: []string{"mon", "tue", "wed", "thu", "fri"}},
+		{in: "weekends", want: []string{"sat", "sun"}},
+		{in: "mon", want: []string{"mon"}},
+		{in: "MON,wed", want: []string{"mon", "wed"}},
+		{in: "fri-mon", want: []string{"fri", "sat", "sun", "mon"}},
+		{in: "tue-thu,sat", want: []string{"tue", "wed", "thu", "sat"}},
+		{in: "monday", wantErr: true},
+		{in: "mon-", wantErr: true},
+		{in: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseDays(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseDays(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseDays(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseClock(t *testing.T) {
+	for in, want := range map[string]int{"00:00": 0, "08:30": 8*60 + 30, "23:59": 23*60 + 59} {
+		if got, err := parseClock(in); err != nil || got != want {
+			t.Errorf("parseClock(%q) = %d, %v, want %d", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"24:00", "8", "noon", "12:60"} {
+		if _, err := parseClock(in); err == nil {
+			t.Errorf("parseClock(%q): no error", in)
+		}
+	}
+}
+
+func TestParseScheduleRule(t *testing.T) {
+	rule, err := parseScheduleRule([]string{"night", "weekdays", "23:00-07:00", "1M", "off"})
+	want := scheduleRule{Name: "night", Days: []string{"mon", "tue", "wed", "thu", "fri"}, From: "23:00", To: "07:00", Up: 1 << 20}
+	if err != nil || !reflect.DeepEqual(rule, want) {
+		t.Errorf("parseScheduleRule = %+v, %v, want %+v", rule, err, want)
+	}
+
+	for _, times := range []string{"08:00-08:00", "8:00", "08:00-25:00"} {
+		if _, err := parseScheduleRule([]string{"r", "all", times, "1M", "1M"}); err == nil {
+			t.Errorf("parseScheduleRule with %q: no error", times)
+		}
+	}
+}
+
+func TestScheduleRuleActive(t *testing.T) {
+	// 2024-01-05 is a friday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, time.January, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	daytime := scheduleRule{From: "09:00", To: "17:00"}
+	overnight := scheduleRule{From: "23:00", To: "07:00", Days: []string{"fri"}}
+
+	tests := []struct {
+		name string
+		rule scheduleRule
+		t    time.Time
+		want bool
+	}{
+		{"before the window", daytime, at(5, 8, 59), false},
+		{"start of the window", daytime, at(5, 9, 0), true},
+		{"end of the window", daytime, at(5, 17, 0), false},
+		{"overnight before midnight", overnight, at(5, 23, 30), true},
+		{"overnight after midnight belongs to the day before", overnight, at(6, 6, 59), true},
+		{"overnight after it ends", overnight, at(6, 7, 0), false},
+		{"overnight on another day", overnight, at(6, 23, 30), false},
+		{"overnight after midnight of another day", overnight, at(5, 1, 0), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.active(tt.t); got != tt.want {
+				t.Errorf("active(%s) = %t, want %t", tt.t.Format("Mon 15:04"), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCurrentProfile(t *testing.T) {
+	saved, savedLimits := schedule, NormalLimits
+	defer func() { schedule, NormalLimits = saved, savedLimits }()
+
+	NormalLimits = [2]uint64{0, 0}
+	schedule = bandwidthSchedule{Rules: []scheduleRule{
+		{Name: "work", From: "09:00", To: "17:00", Up: 100, Down: 200},
+		{Name: "lunch", From: "12:00", To: "13:00", Up: 300, Down: 400},
+	}}
+
+	// walk through the day
+	day := time.Date(2024, time.January, 5, 0, 0, 0, 0, time.UTC)
+	for _, want := range []struct {
+		at       time.Duration
+		name     string
+		up, down uint64
+	}{
+		{8 * time.Hour, "normal", 0, 0},
+		{10 * time.Hour, "work", 100, 200},
+		{12*time.Hour + 30*time.Minute, "lunch", 300, 400}, // the last matching rule wins
+		{13 * time.Hour, "work", 100, 200},
+		{17 * time.Hour, "normal", 0, 0},
+	} {
+		name, up, down := currentProfile(day.Add(want.at))
+		if name != want.name || up != want.up || down != want.down {
+			t.Errorf("at %s: %s %d/%d, want %s %d/%d", want.at, name, up, down, want.name, want.up, want.down)
+		}
+	}
+}
@@ -3,43 +3,41 @@ package main
 import (
 	"bytes"
 	"fmt"
-	"regexp"
 	"strings"
 )
 
 // search takes a query and returns torrents with match
-func search(tokens []string) {
+func search(s *session, tokens []string) {
+	query, tokens := parseLabelQuery(tokens)
+
 	// make sure that we got a query
 	if len(tokens) == 0 {
-		send("search: needs an argument", false)
+		s.send("search: needs an argument", false)
 		return
 	}
 
-	query := strings.Join(tokens, " ")
-	// "(?i)" for case insensitivity
-	regx, err := regexp.Compile("(?i)" + query)
+	torrents, err := s.torrents()
 	if err != nil {
 		logger.Print(err)
-		send("search: "+err.Error(), false)
+		s.send("search: "+err.Error(), false)
 		return
 	}
 
-	torrents, err := rtorrent.Torrents()
+	ids := torrentIDs(torrents)
+	torrents, err = filterName(query.filter(torrents), strings.Join(tokens, " "))
 	if err != nil {
 		logger.Print(err)
-		send("search: "+err.Error(), false)
+		s.send("search: "+err.Error(), false)
 		return
 	}
 
 	buf := new(bytes.Buffer)
 	for i := range torrents {
-		if regx.MatchString(torrents[i].Name) {
-			buf.WriteString(fmt.Sprintf("<%d> %s\n", i, torrents[i].Name))
-		}
+		buf.WriteString(fmt.Sprintf("<%s> %s\n", ids[torrents[i].Hash], torrents[i].Name))
 	}
 	if buf.Len() == 0 {
-		send("No matches!", false)
+		s.send("No matches!", false)
 		return
 	}
-	send(buf.String(), false)
+	s.send(buf.String(), false)
 }
@@ -8,26 +8,27 @@ import (
 )
 
 // seeding will send the names of the torrents with the status 'Seeding'.
-func seeding() {
-	torrents, err := rtorrent.Torrents()
+func seeding(s *session, tokens []string) {
+	query, tokens := parseLabelQuery(tokens)
+	torrents, err := s.torrents()
 	if err != nil {
 		logger.Print(err)
-		send("seeding: "+err.Error(), false)
+		s.send("seeding: "+err.Error(), false)
 		return
 	}
 
+	ids := torrentIDs(torrents)
+	torrents = filterState(query.filter(torrents), rtapi.Seeding)
 	buf := new(bytes.Buffer)
 	for i := range torrents {
-		if torrents[i].State == rtapi.Seeding {
-			buf.WriteString(fmt.Sprintf("<%d> %s\n", i, torrents[i].Name))
-		}
+		buf.WriteString(fmt.Sprintf("<%s> %s\n", ids[torrents[i].Hash], torrents[i].Name))
 	}
 
 	if buf.Len() == 0 {
-		send("No torrents seeding", false)
+		s.send("No torrents seeding", false)
 		return
 	}
 
-	send(buf.String(), false)
+	s.send(buf.String(), false)
 
 }
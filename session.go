@@ -0,0 +1,249 @@
+package main
+
+import (
+	"sync"
+	"unicode/utf8"
+
+	"github.com/pyed/rtapi"
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// session holds the state of a chat, commands run within the session of the chat they came from,
+// so live updates, sorting and notifications of one chat don't leak into another.
+type session struct {
+	chatID int64
+
+	mu       sync.Mutex
+	sortArg  string                 // the sorting as typed, e.g. "rev size", see 'lookupSorting'
+	sortName string                 // name of the sorting in use, see 'sortings'
+	sortBy   func(t rtapi.Torrents) // nil for rTorrent's order
+	live     bool                   // edit and update info after sending
+	events   map[eventKind]bool     // the events the chat is subscribed to
+}
+
+// sessionsFile holds the settings of the chats, inside the data directory.
+const sessionsFile = "sessions.json"
+
+// sessionPrefs is what gets saved of a session to 'sessionsFile', by chat ID.
+type sessionPrefs struct {
+	Live   bool
+	Events map[eventKind]bool
+	Sort   string `json:",omitempty"` // as typed after 'sort', empty for rTorrent's order
+}
+
+var (
+	sessions   = make(map[int64]*session)
+	sessionsMu sync.Mutex
+)
+
+// getSession returns the session of a chat, creating it if needed.
+func getSession(chatID int64) *session {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+
+	s, ok := sessions[chatID]
+	if !ok {
+		s = &session{
+			chatID: chatID,
+			live:   !NoLive,
+			events: make(map[eventKind]bool),
+		}
+		for _, kind := range defaultSubscriptions {
+			s.events[kind] = true
+		}
+		sessions[chatID] = s
+
+		// remember the chat, so it keeps getting notified after a restart
+		if err := saveSessionsLocked(); err != nil {
+			logger.Print("sessions:", err)
+		}
+	}
+	return s
+}
+
+// loadSessions restores the sessions of the chats from the data directory.
+func loadSessions() error {
+	var saved map[int64]sessionPrefs
+	if err := loadJSON(sessionsFile, &saved); err != nil {
+		return err
+	}
+
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	for chatID, prefs := range saved {
+		events := prefs.Events
+		if events == nil {
+			events = make(map[eventKind]bool)
+		}
+		s := &session{chatID: chatID, live: prefs.Live, events: events}
+		// a sorting that's gone is left out, the chat gets rTorrent's order
+		if name, sortBy, ok := lookupSorting(prefs.Sort); ok {
+			s.sortArg, s.sortName, s.sortBy = prefs.Sort, name, sortBy
+		}
+		sessions[chatID] = s
+	}
+	return nil
+}
+
+// saveSessions saves the settings of all the sessions to the data directory.
+func saveSessions() {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+	if err := saveSessionsLocked(); err != nil {
+		logger.Print("sessions:", err)
+	}
+}
+
+// saveSessionsLocked is saveSessions for callers that hold sessionsMu.
+func saveSessionsLocked() error {
+	saved := make(map[int64]sessionPrefs, len(sessions))
+	for chatID, s := range sessions {
+		s.mu.Lock()
+		prefs := sessionPrefs{Live: s.live, Events: make(map[eventKind]bool, len(s.events)), Sort: s.sortArg}
+		for kind, on := range s.events {
+			prefs.Events[kind] = on
+		}
+		s.mu.Unlock()
+		saved[chatID] = prefs
+	}
+	return saveJSON(sessionsFile, saved)
+}
+
+// allSessions returns a snapshot of the current sessions.
+func allSessions() []*session {
+	sessionsMu.Lock()
+	defer sessionsMu.Unlock()
+
+	all := make([]*session, 0, len(sessions))
+	for _, s := range sessions {
+		all = append(all, s)
+	}
+	return all
+}
+
+// torrents returns rTorrent's torrents sorted by the session's sorting.
+func (s *session) torrents() (rtapi.Torrents, error) {
+	torrents, err := rtorrent.Torrents()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	sortBy := s.sortBy
+	s.mu.Unlock()
+
+	if sortBy != nil {
+		sortBy(torrents)
+	}
+	return torrents, nil
+}
+
+// setSorting changes the sorting of the session to one typed after 'sort', and saves it,
+// it returns the name of the sorting, ok is false if there's no such sorting.
+func (s *session) setSorting(arg string) (name string, ok bool) {
+	name, sortBy, ok := lookupSorting(arg)
+	if !ok {
+		return "", false
+	}
+	s.mu.Lock()
+	s.sortArg, s.sortName, s.sortBy = arg, name, sortBy
+	s.mu.Unlock()
+	saveSessions()
+	return name, true
+}
+
+// sorting returns the name of the sorting in use.
+func (s *session) sorting() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sortName == "" {
+		return "default"
+	}
+	return s.sortName
+}
+
+// isLive reports whether messages should be kept updated after sending them.
+func (s *session) isLive() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.live
+}
+
+// setLive toggles live updates, and saves it.
+func (s *session) setLive(live bool) {
+	s.mu.Lock()
+	s.live = live
+	s.mu.Unlock()
+	saveSessions()
+}
+
+// subscribed reports whether the session gets notified about events of a kind.
+func (s *session) subscribed(kind eventKind) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.events[kind]
+}
+
+// subscribe toggles the notifications about events of a kind, and saves it.
+func (s *session) subscribe(kind eventKind, on bool) {
+	s.mu.Lock()
+	s.events[kind] = on
+	s.mu.Unlock()
+	saveSessions()
+}
+
+// send takes a message to send to the session's chat, returns the message id of the send message
+func (s *session) send(text string, markdown bool) int {
+	return s.sendWithKeyboard(text, markdown, nil)
+}
+
+// sendWithKeyboard works like send, and attaches an inline keyboard to the message, or the last chunk of it.
+func (s *session) sendWithKeyboard(text string, markdown bool, keyboard *tgbotapi.InlineKeyboardMarkup) int {
+	// set typing action
+	action := tgbotapi.NewChatAction(s.chatID, tgbotapi.ChatTyping)
+	Bot.Send(action)
+
+	// check the rune count, telegram is limited to 4096 chars per message;
+	// so if our message is > 4096, split it in chunks the send them.
+	msgRuneCount := utf8.RuneCountInString(text)
+LenCheck:
+	stop := 4095
+	if msgRuneCount > 4096 {
+		for text[stop] != 10 { // '\n'
+			stop--
+		}
+		msg := tgbotapi.NewMessage(s.chatID, text[:stop])
+		msg.DisableWebPagePreview = true
+		if markdown {
+			msg.ParseMode = tgbotapi.ModeMarkdown
+		}
+
+		// send current chunk
+		if _, err := Bot.Send(msg); err != nil {
+			logger.Printf("[ERROR] Send: %s", err)
+			metrics.sendErrors.Add(1)
+		}
+		// move to the next chunk
+		text = text[stop:]
+		msgRuneCount = utf8.RuneCountInString(text)
+		goto LenCheck
+	}
+
+	// if msgRuneCount < 4096, send it normally
+	msg := tgbotapi.NewMessage(s.chatID, text)
+	msg.DisableWebPagePreview = true
+	if markdown {
+		msg.ParseMode = tgbotapi.ModeMarkdown
+	}
+	if keyboard != nil {
+		msg.ReplyMarkup = keyboard
+	}
+
+	resp, err := Bot.Send(msg)
+	if err != nil {
+		logger.Printf("[ERROR] Send: %s", err)
+		metrics.sendErrors.Add(1)
+	}
+
+	return resp.MessageID
+}
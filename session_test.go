@@ -0,0 +1,76 @@
+package main
+
+import "testing"
+
+// withSessions runs f with an empty set of sessions saved in a temporary data directory.
+func withSessions(t *testing.T, f func()) {
+	t.Helper()
+	savedDir, savedSessions := DataDir, sessions
+	defer func() { DataDir, sessions = savedDir, savedSessions }()
+
+	DataDir = t.TempDir()
+	sessions = make(map[int64]*session)
+	f()
+}
+
+func TestSessionsSurviveRestarts(t *testing.T) {
+	withSessions(t, func() {
+		getSession(1).setLive(false)
+		getSession(1).subscribe(evCompleted, false)
+		getSession(2).setLive(true)
+		getSession(2).subscribe(evAdded, true)
+		getSession(2).setSorting("REV size")
+
+		// a restart
+		sessions = make(map[int64]*session)
+		if err := loadSessions(); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(sessions) != 2 {
+			t.Fatalf("got %d sessions after loading, want 2", len(sessions))
+		}
+		if getSession(1).isLive() {
+			t.Error("live of chat 1 = on, want off")
+		}
+		if !getSession(2).isLive() {
+			t.Error("live of chat 2 = off, want on")
+		}
+		if getSession(1).subscribed(evCompleted) {
+			t.Error("chat 1 is subscribed to completed after loading, want unsubscribed")
+		}
+		if !getSession(2).subscribed(evAdded) {
+			t.Error("chat 2 isn't subscribed to added after loading")
+		}
+		if got := getSession(1).sorting(); got != "default" {
+			t.Errorf("sorting of chat 1 = %q, want default", got)
+		}
+		if got := getSession(2).sorting(); got != "reversed size" || getSession(2).sortBy == nil {
+			t.Errorf("sorting of chat 2 = %q, want reversed size", got)
+		}
+	})
+}
+
+func TestLoadSessionsWithoutFile(t *testing.T) {
+	withSessions(t, func() {
+		if err := loadSessions(); err != nil {
+			t.Fatal(err)
+		}
+		if len(sessions) != 0 {
+			t.Errorf("got %d sessions without a file, want none", len(sessions))
+		}
+	})
+}
+
+func TestLookupSorting(t *testing.T) {
+	for arg, want := range map[string]string{"size": "size", "Rev UPRATE": "reversed up rate", "upload": "up total"} {
+		if name, sortBy, ok := lookupSorting(arg); !ok || name != want || sortBy == nil {
+			t.Errorf("lookupSorting(%q) = %q, %t, want %q", arg, name, ok, want)
+		}
+	}
+	for _, arg := range []string{"", "rev", "speed", "rev rev size", "size rev"} {
+		if name, _, ok := lookupSorting(arg); ok {
+			t.Errorf("lookupSorting(%q) = %q, want no sorting", arg, name)
+		}
+	}
+}
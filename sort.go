@@ -6,85 +6,79 @@ import (
 	"github.com/pyed/rtapi"
 )
 
-// sort changes torrents sorting
-func sort(tokens []string) {
+// sorting is a sorting method, rtapi's sorting type isn't exported, so each method is wrapped in a function.
+type sorting struct {
+	desc    string // e.g. "down rate"
+	by, rev func(rtapi.Torrents)
+}
+
+// sortings maps the arguments of 'sort' to their sorting methods.
+var sortings = map[string]sorting{
+	"name": {"name",
+		func(t rtapi.Torrents) { t.Sort(rtapi.ByName) },
+		func(t rtapi.Torrents) { t.Sort(rtapi.ByNameRev) }},
+	"downrate": {"down rate",
+		func(t rtapi.Torrents) { t.Sort(rtapi.ByDownRate) },
+		func(t rtapi.Torrents) { t.Sort(rtapi.ByDownRateRev) }},
+	"uprate": {"up rate",
+		func(t rtapi.Torrents) { t.Sort(rtapi.ByUpRate) },
+		func(t rtapi.Torrents) { t.Sort(rtapi.ByUpRateRev) }},
+	"size": {"size",
+		func(t rtapi.Torrents) { t.Sort(rtapi.BySize) },
+		func(t rtapi.Torrents) { t.Sort(rtapi.BySizeRev) }},
+	"ratio": {"ratio",
+		func(t rtapi.Torrents) { t.Sort(rtapi.ByRatio) },
+		func(t rtapi.Torrents) { t.Sort(rtapi.ByRatioRev) }},
+	"age": {"age",
+		func(t rtapi.Torrents) { t.Sort(rtapi.ByAge) },
+		func(t rtapi.Torrents) { t.Sort(rtapi.ByAgeRev) }},
+	"upload": {"up total",
+		func(t rtapi.Torrents) { t.Sort(rtapi.ByUpTotal) },
+		func(t rtapi.Torrents) { t.Sort(rtapi.ByUpTotalRev) }},
+}
+
+// lookupSorting returns the name and the method of a sorting as typed after 'sort', e.g. "size" or "rev size"
+func lookupSorting(arg string) (name string, sortBy func(rtapi.Torrents), ok bool) {
+	fields := strings.Fields(strings.ToLower(arg))
+	reversed := len(fields) == 2 && fields[0] == "rev"
+	if reversed {
+		fields = fields[1:]
+	}
+	if len(fields) != 1 {
+		return "", nil, false
+	}
+
+	method, ok := sortings[fields[0]]
+	if !ok {
+		return "", nil, false
+	}
+	if reversed {
+		return "reversed " + method.desc, method.rev, true
+	}
+	return method.desc, method.by, true
+}
+
+// sort changes torrents sorting of the session
+func sort(s *session, tokens []string) {
 	if len(tokens) == 0 {
-		send(`sort takes one of:
+		s.send(`sort takes one of:
 			(*name, downrate, uprate, size, ratio, age, upload*)
 			optionally start with (*rev*) for reversed order
-			e.g. "*sort rev size*" to get biggest torrents first.`, true)
+			e.g. "*sort rev size*" to get biggest torrents first.
+			current sorting: `+"`"+s.sorting()+"`", true)
 		return
 	}
 
-	var reversed bool
-	if strings.ToLower(tokens[0]) == "rev" &&
-		len(tokens) > 1 {
-		reversed = true
-		tokens = tokens[1:]
+	// "rev" alone sorts by nothing, and anything after the method is ignored
+	arg := tokens[0]
+	if strings.ToLower(arg) == "rev" && len(tokens) > 1 {
+		arg += " " + tokens[1]
 	}
 
-	switch strings.ToLower(tokens[0]) {
-	case "name":
-		if reversed {
-			rtapi.CurrentSorting = rtapi.ByNameRev
-			send("sort: by `reversed name`", true)
-			break
-		}
-		rtapi.CurrentSorting = rtapi.ByName
-		send("sort: by `name`", true)
-
-	case "downrate":
-		if reversed {
-			rtapi.CurrentSorting = rtapi.ByDownRateRev
-			send("sort: by `reversed down rate`", true)
-			break
-		}
-		rtapi.CurrentSorting = rtapi.ByDownRate
-		send("sort: by `down rate`", true)
-
-	case "uprate":
-		if reversed {
-			rtapi.CurrentSorting = rtapi.ByUpRateRev
-			send("sort: by `reversed up rate`", true)
-			break
-		}
-		rtapi.CurrentSorting = rtapi.ByUpRate
-		send("sort: by `up rate`", true)
-	case "size":
-		if reversed {
-			rtapi.CurrentSorting = rtapi.BySizeRev
-			send("sort: by `reversed size`", true)
-			break
-		}
-		rtapi.CurrentSorting = rtapi.BySize
-		send("sort: by `size`", true)
-	case "ratio":
-		if reversed {
-			rtapi.CurrentSorting = rtapi.ByRatioRev
-			send("sort: by `reversed ratio`", true)
-			break
-		}
-		rtapi.CurrentSorting = rtapi.ByRatio
-		send("sort: by `ratio`", true)
-
-	case "age":
-		if reversed {
-			rtapi.CurrentSorting = rtapi.ByAgeRev
-			send("sort: by `reversed age`", true)
-			break
-		}
-		rtapi.CurrentSorting = rtapi.ByAge
-		send("sort: by `age`", true)
-	case "upload":
-		if reversed {
-			rtapi.CurrentSorting = rtapi.ByUpTotalRev
-			send("sort: by `reversed up total`", true)
-			break
-		}
-		rtapi.CurrentSorting = rtapi.ByUpTotal
-		send("sort: by `up total`", true)
-	default:
-		send("unkown sorting method", false)
+	name, ok := s.setSorting(arg)
+	if !ok {
+		s.send("unkown sorting method", false)
 		return
 	}
+	s.send("sort: by `"+name+"`", true)
 }
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"time"
+
+	humanize "github.com/pyed/go-humanize"
+	"github.com/pyed/rtapi"
+)
+
+// what -space-check does when a torrent is bigger than the free space of its directory
+const (
+	spaceRefuse = "refuse"
+	spaceWarn   = "warn"
+	spaceOff    = "off"
+)
+
+// diskCheckEvery is how often the free space of the download filesystems gets checked.
+const diskCheckEvery = time.Minute
+
+// targetDir returns the directory a torrent added to dir ends up in, rTorrent's default one if dir is empty
+func targetDir(dir string) (string, error) {
+	if dir != "" {
+		return dir, nil
+	}
+	stats, err := rtorrent.Stats()
+	if err != nil {
+		return "", err
+	}
+	return stats.Directory, nil
+}
+
+// checkFreeSpace returns an error if a torrent of the given size doesn't fit in the free space of dir,
+// paths that can't be checked, e.g. because rTorrent runs on another machine, pass.
+func checkFreeSpace(size uint64, dir string) error {
+	dir, err := targetDir(dir)
+	if err != nil {
+		return err
+	}
+
+	_, _, free, err := diskUsage(dir)
+	if err != nil {
+		logger.Print("space:", err)
+		return nil
+	}
+	if size > free {
+		return fmt.Errorf("not enough free space, needs %s, %s free in %s",
+			humanize.IBytes(size), humanize.IBytes(free), dir)
+	}
+	return nil
+}
+
+// guardFreeSpace applies -space-check to a torrent about to be added, refuses it, or adds it with a warning
+func guardFreeSpace(name string, size uint64, dir string) error {
+	if SpaceCheck == spaceOff || size == 0 {
+		return nil
+	}
+
+	err := checkFreeSpace(size, dir)
+	if err == nil || SpaceCheck == spaceRefuse {
+		return err
+	}
+	publish(event{kind: evDiskSpace, name: name, message: "Added anyway: " + err.Error()})
+	return nil
+}
+
+// downloadDirs returns the directories that hold the data of the torrents, and rTorrent's default one
+func downloadDirs(torrents rtapi.Torrents) []string {
+	var dirs []string
+	if stats, err := rtorrent.Stats(); err == nil && stats.Directory != "" {
+		dirs = append(dirs, stats.Directory)
+	}
+	for _, torrent := range torrents {
+		if torrent.Path == "" {
+			continue // closed torrents have no path
+		}
+		if dir := filepath.Dir(torrent.Path); !slices.Contains(dirs, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// watchDiskSpace pauses all the leeching torrents and alerts the chats once the free space of a
+// download filesystem drops below minFree, and tells them when it's back above it.
+func watchDiskSpace(minFree uint64) {
+	low := make(map[string]bool) // by filesystem ID
+
+	for ; ; time.Sleep(diskCheckEvery) {
+		torrents, err := rtorrent.Torrents()
+		if err != nil {
+			logger.Print("space:", err)
+			continue
+		}
+		checkDiskSpace(torrents, minFree, low)
+	}
+}
+
+// checkDiskSpace checks the download filesystems once, low has the ones that were below minFree.
+// The leeching torrents get paused on every check while one is low, downloads started in the
+// meantime would fill it up too, but the chats only get alerted when it gets low.
+func checkDiskSpace(torrents rtapi.Torrents, minFree uint64, low map[string]bool) {
+	checked := make(map[string]bool)
+	var paused string // what pausing did, they are paused once per check
+	for _, dir := range downloadDirs(torrents) {
+		fs, err := filesystemID(dir)
+		if err != nil || checked[fs] {
+			continue // not on this machine, or already checked
+		}
+		checked[fs] = true
+
+		_, _, free, err := diskUsage(dir)
+		if err != nil {
+			logger.Print("space:", err)
+			continue
+		}
+
+		switch {
+		case free < minFree:
+			if paused == "" {
+				paused = pauseLeeching(torrents)
+			}
+			if !low[fs] {
+				low[fs] = true
+				publish(event{kind: evDiskSpace, name: dir, message: fmt.Sprintf("Only %s free, below %s. %s",
+					humanize.IBytes(free), humanize.IBytes(minFree), paused)})
+			}
+		case low[fs]:
+			low[fs] = false
+			publish(event{kind: evDiskSpace, name: dir, message: fmt.Sprintf(
+				"Back to %s free, start the paused downloads when you are ready", humanize.IBytes(free))})
+		}
+	}
+}
+
+// pauseLeeching stops all the leeching torrents, returns what it did to tell the chats
+func pauseLeeching(torrents rtapi.Torrents) string {
+	var leeching rtapi.Torrents
+	for _, torrent := range torrents {
+		if torrent.State == rtapi.Leeching {
+			leeching = append(leeching, torrent)
+		}
+	}
+	if len(leeching) == 0 {
+		return "No downloads to pause."
+	}
+
+	if err := rtorrent.Stop(leeching...); err != nil {
+		logger.Print("space:", err)
+		return "Failed to pause the downloads: " + err.Error()
+	}
+	return fmt.Sprintf("Paused %d download(s).", len(leeching))
+}
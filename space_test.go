@@ -0,0 +1,73 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pyed/rtapi"
+)
+
+func TestDiskUsage(t *testing.T) {
+	total, used, free, err := diskUsage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the blocks reserved for root are neither used nor free
+	if total == 0 || used+free > total {
+		t.Errorf("total %d, used %d, free %d", total, used, free)
+	}
+}
+
+func TestCheckDiskSpace(t *testing.T) {
+	dir := t.TempDir()
+	f := startFakeRtorrent(t)
+	f.handle = func(method string, params []interface{}) (interface{}, error) {
+		if method == "directory.default" {
+			return dir, nil
+		}
+		return nil, nil
+	}
+	torrents := rtapi.Torrents{{Name: "a", Hash: "AAAA0000", State: rtapi.Leeching, Path: filepath.Join(dir, "a")}}
+	drainEvents()
+
+	stops := func() int {
+		n := 0
+		for _, call := range f.called() {
+			if call == "d.stop AAAA0000" {
+				n++
+			}
+		}
+		return n
+	}
+	// rtapi doesn't wait for the answers of its actions
+	waitStops := func(want int) {
+		t.Helper()
+		for deadline := time.Now().Add(time.Second); stops() < want && time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		}
+		if n := stops(); n != want {
+			t.Errorf("stopped %d time(s), want %d", n, want)
+		}
+	}
+
+	// nothing is ever enough, the downloads get paused on every check but the chats are alerted once
+	low := make(map[string]bool)
+	checkDiskSpace(torrents, ^uint64(0), low)
+	waitStops(1)
+	if published := drainEvents(); len(published) != 1 || !strings.Contains(published[0].message, "Paused 1 download(s)") {
+		t.Errorf("first check: published %v, want the alert", published)
+	}
+
+	checkDiskSpace(torrents, ^uint64(0), low)
+	waitStops(2)
+	if published := drainEvents(); len(published) != 0 {
+		t.Errorf("second check: published %v again", published)
+	}
+
+	checkDiskSpace(torrents, 0, low)
+	if published := drainEvents(); len(published) != 1 || !strings.HasPrefix(published[0].message, "Back to") {
+		t.Errorf("published %v, want the space back", published)
+	}
+	waitStops(2)
+}
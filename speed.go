@@ -9,14 +9,14 @@ import (
 )
 
 // speed will echo back the current download and upload speeds
-func speed() {
+func speed(s *session, tokens []string) {
 	down, up := rtorrent.Speeds()
 
 	msg := fmt.Sprintf("↓ %s  ↑ %s", humanize.IBytes(down), humanize.IBytes(up))
 
-	msgID := send(msg, false)
+	msgID := s.send(msg, false)
 
-	if NoLive {
+	if !s.isLive() {
 		return
 	}
 
@@ -26,7 +26,7 @@ func speed() {
 
 		msg = fmt.Sprintf("↓ %s  ↑ %s", humanize.IBytes(down), humanize.IBytes(up))
 
-		editConf := tgbotapi.NewEditMessageText(chatID, msgID, msg)
+		editConf := tgbotapi.NewEditMessageText(s.chatID, msgID, msg)
 		Bot.Send(editConf)
 		time.Sleep(time.Second * interval)
 	}
@@ -34,6 +34,6 @@ func speed() {
 	time.Sleep(time.Second * interval)
 
 	// show dashes to indicate that we are done updating.
-	editConf := tgbotapi.NewEditMessageText(chatID, msgID, "↓ - B  ↑ - B")
+	editConf := tgbotapi.NewEditMessageText(s.chatID, msgID, "↓ - B  ↑ - B")
 	Bot.Send(editConf)
 }
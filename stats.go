@@ -4,52 +4,30 @@ import (
 	"fmt"
 
 	humanize "github.com/pyed/go-humanize"
+	"github.com/pyed/rtapi"
 )
 
 // stats echo back transmission stats
-func stats() {
+func stats(s *session, tokens []string) {
 	stats, err := rtorrent.Stats()
 	if err != nil {
 		logger.Print("stats:", err)
-		send("stats: "+err.Error(), false)
+		s.send("stats: "+err.Error(), false)
 		return
 	}
 
-	torrents, err := rtorrent.Torrents()
+	torrents, err := s.torrents()
 	if err != nil {
 		logger.Print("stats:", err)
-		send("stats: "+err.Error(), false)
+		s.send("stats: "+err.Error(), false)
 		return
 	}
 
-	var totalUp, totalDown uint64
-	for i := range torrents {
-		totalUp += torrents[i].UpTotal
-		totalDown += torrents[i].Completed
-	}
-
-	var ratio float64
-	if totalDown > 0 {
-		ratio = float64(totalUp) / float64(totalDown)
-	}
-
-	// show 'off' instead of 0 for throttling
-	var throttleUp, throttleDown string
-	if stats.ThrottleUp == 0 {
-		throttleUp = "off"
-	} else {
-		throttleUp = humanize.IBytes(stats.ThrottleUp)
-	}
-
-	if stats.ThrottleDown == 0 {
-		throttleDown = "off"
-	} else {
-		throttleDown = humanize.IBytes(stats.ThrottleDown)
-	}
+	totalUp, totalDown, ratio := torrentTotals(torrents)
 
 	msg := fmt.Sprintf(
 		`
-\[Throttle  *%s* / *%s*]
+%s
 \[Port *%s*]
 \[*%s*]
 Total Uploaded: *%s*
@@ -59,10 +37,22 @@ All-time Upload: *%s*
 All-time Download: *%s*
 Global Ratio: *%.2f*
 		`,
-		throttleUp, throttleDown, stats.Port, stats.Directory,
+		formatThrottle(stats.ThrottleUp, stats.ThrottleDown), stats.Port, stats.Directory,
 		humanize.IBytes(stats.TotalUp), humanize.IBytes(stats.TotalDown),
 		humanize.IBytes(totalUp), humanize.IBytes(totalDown), ratio,
 	)
 
-	send(msg, true)
+	s.send(msg, true)
+}
+
+// torrentTotals returns what the torrents uploaded and downloaded, and the ratio of the two
+func torrentTotals(torrents rtapi.Torrents) (up, down uint64, ratio float64) {
+	for i := range torrents {
+		up += torrents[i].UpTotal
+		down += torrents[i].Completed
+	}
+	if down > 0 {
+		ratio = float64(up) / float64(down)
+	}
+	return up, down, ratio
 }
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// loadJSON reads the file 'name' from the data directory into v, a missing file leaves v untouched.
+func loadJSON(name string, v interface{}) error {
+	data, err := os.ReadFile(filepath.Join(DataDir, name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// saveJSON writes v to the file 'name' in the data directory, through a temporary
+// file so a crash doesn't leave a half written file behind.
+func saveJSON(name string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(DataDir, 0700); err != nil {
+		return err
+	}
+
+	path := filepath.Join(DataDir, name)
+	if err := os.WriteFile(path+".tmp", data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
@@ -11,7 +11,8 @@ import (
 )
 
 // tail lists the last 5 or n torrents
-func tail(tokens []string) {
+func tail(s *session, tokens []string) {
+	query, tokens := parseLabelQuery(tokens)
 	var (
 		n   = 5 // default to 5
 		err error
@@ -20,17 +21,19 @@ func tail(tokens []string) {
 	if len(tokens) > 0 {
 		n, err = strconv.Atoi(tokens[0])
 		if err != nil {
-			send("tail: argument must be a number", false)
+			s.send("tail: argument must be a number", false)
 			return
 		}
 	}
 
-	torrents, err := rtorrent.Torrents()
+	torrents, err := s.torrents()
 	if err != nil {
 		logger.Print(err)
-		send("tail: "+err.Error(), false)
+		s.send("tail: "+err.Error(), false)
 		return
 	}
+	ids := torrentIDs(torrents)
+	torrents = query.filter(torrents)
 
 	// make sure that we stay in the boundaries
 	if n <= 0 || n > len(torrents) {
@@ -38,22 +41,23 @@ func tail(tokens []string) {
 	}
 
 	buf := new(bytes.Buffer)
-	for i, torrent := range torrents[len(torrents)-n:] {
+	for _, torrent := range torrents[len(torrents)-n:] {
 		torrentName := mdReplacer.Replace(torrent.Name) // escape markdown
-		buf.WriteString(fmt.Sprintf("`<%d>` *%s*\n%s *%s* (%s) ↓ *%s*  ↑ *%s* R: *%.2f*\n\n",
-			i+len(torrents)-n, torrentName, torrent.State, humanize.IBytes(torrent.Completed),
+		buf.WriteString(fmt.Sprintf("`<%s>` *%s*\n%s *%s* (%s) ↓ *%s*  ↑ *%s* R: *%.2f*\n\n",
+			ids[torrent.Hash], torrentName, torrent.State, humanize.IBytes(torrent.Completed),
 			torrent.Percent, humanize.IBytes(torrent.DownRate),
 			humanize.IBytes(torrent.UpRate), torrent.Ratio))
 	}
 
 	if buf.Len() == 0 {
-		send("tail: No torrents", false)
+		s.send("tail: No torrents", false)
 		return
 	}
 
-	msgID := send(buf.String(), true)
+	keyboard := torrentsKeyboard(torrents[len(torrents)-n:], ids)
+	msgID := s.sendWithKeyboard(buf.String(), true, keyboard)
 
-	if NoLive {
+	if !s.isLive() {
 		return
 	}
 
@@ -62,12 +66,14 @@ func tail(tokens []string) {
 		time.Sleep(time.Second * interval)
 		buf.Reset()
 
-		torrents, err = rtorrent.Torrents()
+		torrents, err = s.torrents()
 		if err != nil {
 			logger.Print("tail:", err)
 			continue // try again if some error heppened
 		}
 
+		ids = torrentIDs(torrents)
+		torrents = query.filter(torrents)
 		if len(torrents) < 1 {
 			continue
 		}
@@ -77,17 +83,18 @@ func tail(tokens []string) {
 			n = len(torrents)
 		}
 
-		for i, torrent := range torrents[len(torrents)-n:] {
+		for _, torrent := range torrents[len(torrents)-n:] {
 			torrentName := mdReplacer.Replace(torrent.Name) // escape markdown
-			buf.WriteString(fmt.Sprintf("`<%d>` *%s*\n%s *%s* (%s) ↓ *%s*  ↑ *%s* R: *%.2f*\n\n",
-				i+len(torrents)-n, torrentName, torrent.State, humanize.IBytes(torrent.Completed),
+			buf.WriteString(fmt.Sprintf("`<%s>` *%s*\n%s *%s* (%s) ↓ *%s*  ↑ *%s* R: *%.2f*\n\n",
+				ids[torrent.Hash], torrentName, torrent.State, humanize.IBytes(torrent.Completed),
 				torrent.Percent, humanize.IBytes(torrent.DownRate),
 				humanize.IBytes(torrent.UpRate), torrent.Ratio))
 		}
 
 		// no need to check if it is empty, as if the buffer is empty telegram won't change the message
-		editConf := tgbotapi.NewEditMessageText(chatID, msgID, buf.String())
+		editConf := tgbotapi.NewEditMessageText(s.chatID, msgID, buf.String())
 		editConf.ParseMode = tgbotapi.ModeMarkdown
+		editConf.ReplyMarkup = torrentsKeyboard(torrents[len(torrents)-n:], ids)
 		Bot.Send(editConf)
 	}
 
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// fakeTelegram stands in for the Bot API, it records the requests and answers each with a new message.
+type fakeTelegram struct {
+	mu       sync.Mutex
+	requests []url.Values // the form of each request, with its API method as "method"
+}
+
+// startFakeTelegram points Bot at a fake Telegram until the test ends.
+func startFakeTelegram(t *testing.T) *fakeTelegram {
+	f := new(fakeTelegram)
+	saved := Bot
+	t.Cleanup(func() { Bot = saved })
+	Bot = &tgbotapi.BotAPI{Token: "123:secret", Client: &http.Client{Transport: f}}
+	return f
+}
+
+func (f *fakeTelegram) RoundTrip(r *http.Request) (*http.Response, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	form := r.PostForm
+	form.Set("method", path.Base(r.URL.Path))
+
+	f.mu.Lock()
+	f.requests = append(f.requests, form)
+	id := len(f.requests)
+	f.mu.Unlock()
+
+	body := fmt.Sprintf(`{"ok":true,"result":{"message_id":%d,"date":0,"chat":{"id":1,"type":"private"}}}`, id)
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    r,
+	}, nil
+}
+
+// sent returns the requests of an API method, e.g. "sendMessage", and forgets all the requests.
+func (f *fakeTelegram) sent(method string) []url.Values {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var requests []url.Values
+	for _, r := range f.requests {
+		if r.Get("method") == method {
+			requests = append(requests, r)
+		}
+	}
+	f.requests = nil
+	return requests
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	humanize "github.com/pyed/go-humanize"
+)
+
+// throttle sets rTorrent's global upload and download limits, e.g. "throttle down 2M",
+// "throttle up off" or "throttle 500K 1M" for both, shows the current limits without arguments
+func throttle(s *session, tokens []string) {
+	up, down, err := getThrottle()
+	if err != nil {
+		logger.Print("throttle:", err)
+		s.send("throttle: "+err.Error(), false)
+		return
+	}
+
+	switch len(tokens) {
+	case 0:
+		s.send(formatThrottle(up, down), true)
+		return
+
+	case 1:
+		s.send("throttle: needs a direction and a limit, e.g. 'throttle down 2M', or two limits 'throttle 500K 1M'", false)
+		return
+	}
+
+	switch strings.ToLower(tokens[0]) {
+	case "up", "ul":
+		up, err = parseSize(tokens[1])
+	case "down", "dl":
+		down, err = parseSize(tokens[1])
+	default:
+		if up, err = parseSize(tokens[0]); err == nil {
+			down, err = parseSize(tokens[1])
+		}
+	}
+	if err != nil {
+		s.send("throttle: "+err.Error(), false)
+		return
+	}
+
+	if err := setThrottle(up, down); err != nil {
+		logger.Print("throttle:", err)
+		s.send("throttle: "+err.Error(), false)
+		return
+	}
+	s.send(formatThrottle(up, down), true)
+}
+
+// turtle flips the global limits between the normal and the turtle presets
+func turtle(s *session, tokens []string) {
+	up, down, err := getThrottle()
+	if err != nil {
+		logger.Print("turtle:", err)
+		s.send("turtle: "+err.Error(), false)
+		return
+	}
+
+	mode, limits := "on", TurtleLimits
+	if up == TurtleLimits[0] && down == TurtleLimits[1] {
+		mode, limits = "off", NormalLimits
+	}
+
+	if err := setThrottle(limits[0], limits[1]); err != nil {
+		logger.Print("turtle:", err)
+		s.send("turtle: "+err.Error(), false)
+		return
+	}
+	s.send(fmt.Sprintf("turtle: *%s*\n%s", mode, formatThrottle(limits[0], limits[1])), true)
+}
+
+// getThrottle returns rTorrent's global upload and download limits in bytes, 0 means unlimited
+func getThrottle() (up, down uint64, err error) {
+	upVal, err := rtCall("throttle.global_up.max_rate", "")
+	if err != nil {
+		return 0, 0, err
+	}
+	downVal, err := rtCall("throttle.global_down.max_rate", "")
+	if err != nil {
+		return 0, 0, err
+	}
+	return uint64(rtInt(upVal)), uint64(rtInt(downVal)), nil
+}
+
+// setThrottle sets rTorrent's global upload and download limits in bytes, 0 means unlimited
+func setThrottle(up, down uint64) error {
+	if _, err := rtCall("throttle.global_up.max_rate.set", "", up); err != nil {
+		return err
+	}
+	_, err := rtCall("throttle.global_down.max_rate.set", "", down)
+	return err
+}
+
+// formatThrottle formats the limits the same way 'stats' shows them
+func formatThrottle(up, down uint64) string {
+	return fmt.Sprintf("\\[Throttle  *%s* / *%s*]", formatLimit(up), formatLimit(down))
+}
+
+// formatLimit shows 'off' instead of 0 for throttling
+func formatLimit(limit uint64) string {
+	if limit == 0 {
+		return "off"
+	}
+	return humanize.IBytes(limit)
+}
+
+// parseSize parses human sizes, e.g. "500K", "1.5MB" or "2GiB" where K, M and G are powers
+// of 1024 to match how sizes are shown, "off" and "0" are 0
+func parseSize(size string) (uint64, error) {
+	orig := size
+	size = strings.ToLower(strings.TrimSpace(size))
+	if size == "off" {
+		return 0, nil
+	}
+
+	// treat "2m" and "2mb" as "2mib"
+	for _, unit := range []string{"k", "m", "g", "t"} {
+		switch {
+		case strings.HasSuffix(size, unit):
+			size += "ib"
+		case strings.HasSuffix(size, unit+"b"):
+			size = strings.TrimSuffix(size, "b") + "ib"
+		}
+	}
+
+	n, err := humanize.ParseBytes(size)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size: %s", orig)
+	}
+	return n, nil
+}
+
+// parseLimits parses a pair of limits formatted as "UP:DOWN", e.g. "100K:500K"
+func parseLimits(pair string) ([2]uint64, error) {
+	upStr, downStr, ok := strings.Cut(pair, ":")
+	if !ok {
+		return [2]uint64{}, fmt.Errorf("invalid limits '%s', expected UP:DOWN", pair)
+	}
+
+	up, err := parseSize(upStr)
+	if err != nil {
+		return [2]uint64{}, err
+	}
+	down, err := parseSize(downStr)
+	if err != nil {
+		return [2]uint64{}, err
+	}
+	return [2]uint64{up, down}, nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	sizes := map[string]uint64{
+		"off":   0,
+		"OFF":   0,
+		"0":     0,
+		"500":   500,
+		"500K":  500 << 10,
+		"500kb": 500 << 10,
+		"1.5M":  3 << 19,
+		"1.5MB": 3 << 19,
+		"2GiB":  2 << 30,
+		" 1t ":  1 << 40,
+	}
+	for in, want := range sizes {
+		if got, err := parseSize(in); err != nil || got != want {
+			t.Errorf("parseSize(%q) = %d, %v, want %d", in, got, err, want)
+		}
+	}
+
+	for _, in := range []string{"", "fast", "10X", "1.5.5M"} {
+		if got, err := parseSize(in); err == nil {
+			t.Errorf("parseSize(%q) = %d, want an error", in, got)
+		}
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	limits, err := parseLimits("100K:500K")
+	if err != nil || limits != [2]uint64{100 << 10, 500 << 10} {
+		t.Errorf("parseLimits(100K:500K) = %v, %v", limits, err)
+	}
+	// either side can be unlimited
+	if limits, err := parseLimits("off:1M"); err != nil || limits != [2]uint64{0, 1 << 20} {
+		t.Errorf("parseLimits(off:1M) = %v, %v", limits, err)
+	}
+
+	for _, in := range []string{"100K", "100K:slow", ":", "1M:2M:3M"} {
+		if _, err := parseLimits(in); err == nil {
+			t.Errorf("parseLimits(%q): no error", in)
+		}
+	}
+}
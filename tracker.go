@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tracker is one of the trackers of a torrent.
+type tracker struct {
+	url         string
+	enabled     bool
+	seeders     int64
+	leechers    int64
+	lastSuccess int64 // unix time of the last successful announce, 0 if none
+	lastFailure int64 // unix time of the last failed announce, 0 if none
+	failures    int64 // failed announces in a row
+}
+
+// status describes the state of the tracker
+func (t tracker) status() string {
+	switch {
+	case !t.enabled:
+		return "disabled"
+	case t.lastFailure > t.lastSuccess:
+		return "failing"
+	case t.lastSuccess > 0:
+		return "working"
+	}
+	return "not contacted yet"
+}
+
+// torrentTrackers returns all the trackers of a torrent, indexes match rTorrent's, e.g. "hash:t1"
+func torrentTrackers(hash string) ([]tracker, error) {
+	result, err := rtCall("t.multicall", hash, "",
+		"t.url=", "t.is_enabled=", "t.scrape_complete=", "t.scrape_incomplete=",
+		"t.success_time_last=", "t.failed_time_last=", "t.failed_counter=")
+	if err != nil {
+		return nil, err
+	}
+
+	rows := rtList(result)
+	trackers := make([]tracker, 0, len(rows))
+	for _, row := range rows {
+		fields := rtList(row)
+		if len(fields) < 7 {
+			return nil, fmt.Errorf("t.multicall: expected 7 fields, got %d", len(fields))
+		}
+		trackers = append(trackers, tracker{
+			url:         rtString(fields[0]),
+			enabled:     rtInt(fields[1]) == 1,
+			seeders:     rtInt(fields[2]),
+			leechers:    rtInt(fields[3]),
+			lastSuccess: rtInt(fields[4]),
+			lastFailure: rtInt(fields[5]),
+			failures:    rtInt(fields[6]),
+		})
+	}
+	return trackers, nil
+}
+
+// trackerCmd lists the trackers of a torrent, or edits them:
+// "tracker <id>", "tracker <id> add <url>", "tracker <id> disable <n>", "tracker <id> enable <n>"
+func trackerCmd(s *session, tokens []string) {
+	if len(tokens) == 0 {
+		s.send("tracker: needs a torrent ID", false)
+		return
+	}
+
+	torrents, err := s.torrents()
+	if err != nil {
+		logger.Print("tracker:", err)
+		s.send("tracker: "+err.Error(), false)
+		return
+	}
+
+	torrent, err := findTorrent(torrents, tokens[0])
+	if err != nil {
+		s.send("tracker: "+err.Error(), false)
+		return
+	}
+
+	if len(tokens) == 1 {
+		trackers, err := torrentTrackers(torrent.Hash)
+		if err != nil {
+			logger.Print("tracker:", err)
+			s.send("tracker: "+err.Error(), false)
+			return
+		}
+
+		buf := new(bytes.Buffer)
+		buf.WriteString(fmt.Sprintf("`<%s>` *%s*\n\n", torrentIDs(torrents)[torrent.Hash], mdReplacer.Replace(torrent.Name)))
+		for i, t := range trackers {
+			buf.WriteString(fmt.Sprintf("`<%d>` `%s`\n*%s* S: *%d* L: *%d* Last announce: *%s*\n",
+				i, t.url, t.status(), t.seeders, t.leechers, formatUnix(t.lastSuccess)))
+			if t.lastFailure > t.lastSuccess {
+				buf.WriteString(fmt.Sprintf("Last error: *%s* (%d failures)", formatUnix(t.lastFailure), t.failures))
+				// rTorrent only keeps the message of the latest tracker error, on the torrent itself
+				if torrent.Message != "" {
+					buf.WriteString(fmt.Sprintf(" `%s`", torrent.Message))
+				}
+				buf.WriteString("\n")
+			}
+		}
+		s.send(buf.String(), true)
+		return
+	}
+
+	if len(tokens) < 3 {
+		s.send("tracker: needs an action and its argument, e.g. 'tracker <id> add <url>'", false)
+		return
+	}
+
+	switch strings.ToLower(tokens[1]) {
+	case "add":
+		if _, err := rtCall("d.tracker.insert", torrent.Hash, "0", tokens[2]); err != nil {
+			logger.Print("tracker:", err)
+			s.send("tracker: "+err.Error(), false)
+			return
+		}
+		s.send(fmt.Sprintf("Tracker added to: %s", torrent.Name), false)
+
+	case "disable", "enable":
+		n, err := strconv.Atoi(tokens[2])
+		if err != nil {
+			s.send(fmt.Sprintf("tracker: %s is not a number", tokens[2]), false)
+			return
+		}
+
+		enabled := strings.ToLower(tokens[1]) == "enable"
+		if err := setTrackerEnabled(torrent.Hash, n, enabled); err != nil {
+			logger.Print("tracker:", err)
+			s.send("tracker: "+err.Error(), false)
+			return
+		}
+		s.send(fmt.Sprintf("Tracker <%d> %sd for: %s", n, strings.ToLower(tokens[1]), torrent.Name), false)
+
+	default:
+		s.send(fmt.Sprintf("tracker: unknown action '%s', expected add, disable or enable", tokens[1]), false)
+	}
+}
+
+// setTrackerEnabled enables or disables the tracker with the index n of a torrent
+func setTrackerEnabled(hash string, n int, enabled bool) error {
+	_, err := rtCall("t.is_enabled.set", fmt.Sprintf("%s:t%d", hash, n), enabled)
+	return err
+}
+
+// trackerPerm listing trackers is for viewers, editing them is for masters
+func trackerPerm(tokens []string) permission {
+	if len(tokens) > 1 {
+		return permControl
+	}
+	return permView
+}
+
+// reannounce takes id[s] of torrent[s] or 'all' to announce them to their trackers now
+func reannounce(s *session, tokens []string) {
+	if len(tokens) == 0 {
+		s.send("reannounce: needs an argument", false)
+		return
+	}
+
+	torrents, err := s.torrents()
+	if err != nil {
+		logger.Print("reannounce:", err)
+		s.send("reannounce: "+err.Error(), false)
+		return
+	}
+
+	if tokens[0] == "all" {
+		for _, torrent := range torrents {
+			if _, err := rtCall("d.tracker_announce", torrent.Hash); err != nil {
+				logger.Print("reannounce:", err)
+				s.send("reannounce: error occurred while announcing some torrents", false)
+				return
+			}
+		}
+		s.send("reannounced all torrents", false)
+		return
+	}
+
+	for _, i := range tokens {
+		torrent, err := findTorrent(torrents, i)
+		if err != nil {
+			s.send("reannounce: "+err.Error(), false)
+			continue
+		}
+
+		if _, err := rtCall("d.tracker_announce", torrent.Hash); err != nil {
+			logger.Print("reannounce:", err)
+			s.send("reannounce: "+err.Error(), false)
+			continue
+		}
+		s.send(fmt.Sprintf("Reannounced: %s", torrent.Name), false)
+	}
+}
+
+// formatUnix formats a unix time, 0 is shown as "never"
+func formatUnix(t int64) string {
+	if t == 0 {
+		return "never"
+	}
+	return time.Unix(t, 0).Format(time.Stamp)
+}
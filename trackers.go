@@ -9,11 +9,11 @@ import (
 var trackerRegex = regexp.MustCompile(`[https?|udp]://([^:/]*)`)
 
 // trackers will send a list of trackers and how many torrents each one has
-func trackers() {
-	torrents, err := rtorrent.Torrents()
+func trackers(s *session, tokens []string) {
+	torrents, err := s.torrents()
 	if err != nil {
 		logger.Print(err)
-		send("trackers: "+err.Error(), false)
+		s.send("trackers: "+err.Error(), false)
 		return
 	}
 
@@ -35,8 +35,8 @@ func trackers() {
 	}
 
 	if buf.Len() == 0 {
-		send("No trackers!", false)
+		s.send("No trackers!", false)
 		return
 	}
-	send(buf.String(), false)
+	s.send(buf.String(), false)
 }
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	humanize "github.com/pyed/go-humanize"
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+const (
+	// uploadTimeout is how long a received .torrent waits for a button before it's dropped.
+	uploadTimeout = 10 * time.Minute
+
+	// previewFiles is how many of the largest files the preview shows.
+	previewFiles = 5
+
+	// maxDirButtons is how many directories 'Choose directory' offers.
+	maxDirButtons = 8
+)
+
+// upload callbacks, the data is "upload:<op>:<code>", or "upload:setdir:<code>:<n>" for the n-th directory
+const (
+	upAdd    = "add"
+	upPaused = "paused"
+	upDir    = "dir"
+	upSetDir = "setdir"
+	upCancel = "cancel"
+)
+
+// pendingUpload is a received .torrent waiting for the user to add it or cancel.
+type pendingUpload struct {
+	session *session
+	data    []byte
+	meta    *metaInfo
+	dir     string // empty for rTorrent's default
+	label   string
+	dirs    []string // the directories offered by 'Choose directory'
+	expires time.Time
+}
+
+var (
+	uploads   = make(map[string]*pendingUpload)
+	uploadsMu sync.Mutex
+)
+
+// previewUpload sends what's inside a received .torrent with buttons to add it, add it paused,
+// choose its directory, or cancel
+func previewUpload(s *session, data []byte, meta *metaInfo, dir, label string) {
+	b := make([]byte, 3)
+	if _, err := rand.Read(b); err != nil {
+		logger.Print("receiver:", err)
+		s.send("receiver: "+err.Error(), false)
+		return
+	}
+	code := hex.EncodeToString(b)
+
+	u := &pendingUpload{session: s, data: data, meta: meta, dir: dir, label: label,
+		expires: time.Now().Add(uploadTimeout)}
+
+	uploadsMu.Lock()
+	// drop the expired ones while we are at it
+	for c, pending := range uploads {
+		if time.Now().After(pending.expires) {
+			delete(uploads, c)
+		}
+	}
+	uploads[code] = u
+	uploadsMu.Unlock()
+
+	s.sendWithKeyboard(formatUpload(u), true, uploadKeyboard(code))
+}
+
+// formatUpload formats the preview of a pending upload as markdown
+func formatUpload(u *pendingUpload) string {
+	meta := u.meta
+	buf := new(bytes.Buffer)
+	buf.WriteString(fmt.Sprintf("*%s*\nHash: `%s`\nSize: *%s* in *%d* file(s), private: *%s*\n",
+		mdReplacer.Replace(meta.name), meta.infoHash, humanize.IBytes(uint64(meta.size)), len(meta.files),
+		map[bool]string{true: "yes", false: "no"}[meta.private]))
+
+	files := slices.Clone(meta.files)
+	slices.SortStableFunc(files, func(a, b metaFile) int {
+		return cmp.Compare(b.size, a.size)
+	})
+	if len(files) > 1 {
+		buf.WriteString("\nLargest files:\n")
+		for _, f := range files[:min(previewFiles, len(files))] {
+			buf.WriteString(fmt.Sprintf("*%s* %s\n", humanize.IBytes(uint64(f.size)), mdReplacer.Replace(f.path)))
+		}
+	}
+
+	if len(meta.trackers) > 0 {
+		buf.WriteString("\nTrackers:\n")
+		for _, tracker := range meta.trackers {
+			// only the hosts, announce URLs often carry passkeys
+			host := tracker
+			if u, err := url.Parse(tracker); err == nil && u.Host != "" {
+				host = u.Host
+			}
+			buf.WriteString(fmt.Sprintf("`%s`\n", host))
+		}
+	}
+
+	dir := u.dir
+	if dir == "" {
+		dir = "default"
+	}
+	buf.WriteString(fmt.Sprintf("\nDirectory: `%s`", dir))
+	if u.label != "" {
+		buf.WriteString(fmt.Sprintf("\nLabel: `%s`", u.label))
+	}
+	if SpaceCheck != spaceOff {
+		if err := checkFreeSpace(uint64(meta.size), u.dir); err != nil {
+			buf.WriteString("\n\n⚠ " + mdReplacer.Replace(err.Error()))
+		}
+	}
+	return buf.String()
+}
+
+// uploadKeyboard returns the buttons of a pending upload
+func uploadKeyboard(code string) *tgbotapi.InlineKeyboardMarkup {
+	button := func(text, op string) tgbotapi.InlineKeyboardButton {
+		return tgbotapi.NewInlineKeyboardButtonData(text, cbUpload+":"+op+":"+code)
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			button("▶ Add", upAdd),
+			button("⏸ Add paused", upPaused),
+		),
+		tgbotapi.NewInlineKeyboardRow(
+			button("📁 Choose directory", upDir),
+			button("✖ Cancel", upCancel),
+		),
+	)
+	return &keyboard
+}
+
+// uploadDirs returns the directories to offer for a pending upload, rTorrent's default one first,
+// then the directories that hold the most torrents
+func uploadDirs(s *session) ([]string, error) {
+	stats, err := rtorrent.Stats()
+	if err != nil {
+		return nil, err
+	}
+	torrents, err := s.torrents()
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int)
+	var dirs []string
+	for _, torrent := range torrents {
+		if torrent.Path == "" {
+			continue // closed torrents have no path
+		}
+		dir := filepath.Dir(torrent.Path)
+		if counts[dir] == 0 {
+			dirs = append(dirs, dir)
+		}
+		counts[dir]++
+	}
+	slices.SortStableFunc(dirs, func(a, b string) int {
+		return counts[b] - counts[a]
+	})
+
+	dirs = slices.DeleteFunc(dirs, func(dir string) bool {
+		return dir == stats.Directory
+	})
+	dirs = append([]string{stats.Directory}, dirs...)
+	return dirs[:min(maxDirButtons, len(dirs))], nil
+}
+
+// handleUpload handles the buttons of a pending upload, data is "<op>:<code>" or "setdir:<code>:<n>"
+func handleUpload(s *session, cb *tgbotapi.CallbackQuery, data string) {
+	parts := strings.Split(data, ":")
+	if len(parts) < 2 || cb.Message == nil {
+		answerCallback(cb, "unknown action")
+		return
+	}
+	op, code := parts[0], parts[1]
+
+	uploadsMu.Lock()
+	u, ok := uploads[code]
+	if ok && (u.session != s || time.Now().After(u.expires)) {
+		ok = false
+	}
+	// adding or cancelling ends the upload
+	if ok && (op == upAdd || op == upPaused || op == upCancel) {
+		delete(uploads, code)
+	}
+	uploadsMu.Unlock()
+
+	if !ok {
+		answerCallback(cb, "No pending torrent, it may have expired")
+		return
+	}
+
+	edit := func(text string, keyboard *tgbotapi.InlineKeyboardMarkup) {
+		editConf := tgbotapi.NewEditMessageText(s.chatID, cb.Message.MessageID, text)
+		editConf.ParseMode = tgbotapi.ModeMarkdown
+		editConf.ReplyMarkup = keyboard
+		Bot.Send(editConf)
+	}
+
+	switch op {
+	case upCancel:
+		edit(formatUpload(u)+"\n\n*Cancelled*", nil)
+		answerCallback(cb, "Cancelled")
+
+	case upAdd, upPaused:
+		// the directory of the caption only gets created now, so cancelling leaves nothing behind
+		if u.dir != "" {
+			_, created, err := prepareDir(u.dir)
+			if err != nil {
+				logger.Print("add:", err)
+				answerCallback(cb, "add: "+err.Error())
+				s.send("add: "+err.Error(), false)
+				return
+			}
+			if created {
+				s.send("New directory created: "+u.dir, false)
+			}
+		}
+		if err := addTorrentData(u.data, u.dir, u.label, op == upAdd); err != nil {
+			logger.Print("add:", err)
+			answerCallback(cb, "add: "+err.Error())
+			s.send("add: "+err.Error(), false)
+			return
+		}
+		done := "Added"
+		if op == upPaused {
+			done = "Added paused"
+		}
+		edit(formatUpload(u)+"\n\n*"+done+"*", nil)
+		answerCallback(cb, done)
+		s.send(fmt.Sprintf("%s: %s", done, u.meta.name), false)
+
+	case upDir:
+		dirs, err := uploadDirs(s)
+		if err != nil {
+			logger.Print("receiver:", err)
+			answerCallback(cb, "receiver: "+err.Error())
+			return
+		}
+		uploadsMu.Lock()
+		u.dirs = dirs
+		uploadsMu.Unlock()
+
+		rows := make([][]tgbotapi.InlineKeyboardButton, 0, len(dirs)+1)
+		for i, dir := range dirs {
+			rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+				dir, fmt.Sprintf("%s:%s:%s:%d", cbUpload, upSetDir, code, i))))
+		}
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData(
+			"« Back", fmt.Sprintf("%s:%s:%s:-1", cbUpload, upSetDir, code))))
+		keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+		edit(formatUpload(u)+"\n\nChoose a directory, or send the torrent again with *d=/some/dir* as its caption.", &keyboard)
+		answerCallback(cb, "")
+
+	case upSetDir:
+		n := -1
+		if len(parts) > 2 {
+			n, _ = strconv.Atoi(parts[2])
+		}
+		uploadsMu.Lock()
+		if n >= 0 && n < len(u.dirs) {
+			u.dir = u.dirs[n]
+		}
+		uploadsMu.Unlock()
+		edit(formatUpload(u), uploadKeyboard(code))
+		answerCallback(cb, "")
+
+	default:
+		answerCallback(cb, "unknown action")
+	}
+}
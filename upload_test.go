@@ -0,0 +1,162 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "gopkg.in/telegram-bot-api.v4"
+)
+
+// pendingCode returns the code of the only pending upload.
+func pendingCode(t *testing.T) string {
+	t.Helper()
+	uploadsMu.Lock()
+	defer uploadsMu.Unlock()
+	if len(uploads) != 1 {
+		t.Fatalf("got %d pending uploads, want 1", len(uploads))
+	}
+	for code := range uploads {
+		return code
+	}
+	return ""
+}
+
+func TestUploadFlow(t *testing.T) {
+	base := t.TempDir()
+	downloads, tv, movies := filepath.Join(base, "downloads"), filepath.Join(base, "tv"), filepath.Join(base, "movies")
+	for _, dir := range []string{downloads, tv, movies} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tg := startFakeTelegram(t)
+	rt := startFakeRtorrent(t,
+		fakeTorrent{name: "a", hash: "AAAA", path: filepath.Join(tv, "a"), size: 1, completed: 1},
+		fakeTorrent{name: "b", hash: "BBBB", path: filepath.Join(tv, "b"), size: 1, completed: 1},
+		fakeTorrent{name: "c", hash: "CCCC", path: filepath.Join(movies, "c"), size: 1, completed: 1},
+		fakeTorrent{name: "d", hash: "DDDD", path: filepath.Join(downloads, "d"), size: 1, completed: 1},
+	)
+	rt.handle = func(method string, params []interface{}) (interface{}, error) {
+		if method == "directory.default" {
+			return downloads, nil
+		}
+		return nil, nil
+	}
+	uploads = make(map[string]*pendingUpload)
+
+	s := &session{chatID: 1, events: make(map[eventKind]bool)}
+	data := []byte("d8:announce43:https://tracker.example/passkey123/announce4:infod5:filesl" +
+		"d6:lengthi100e4:pathl9:small.txtee" +
+		"d6:lengthi200e4:pathl7:big.mkvee" +
+		"e4:name4:pack12:piece lengthi16384e6:pieces20:012345678901234567897:privatei1eee")
+	meta, err := parseTorrent(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previewUpload(s, data, meta, "", "tv")
+
+	preview := tg.sent("sendMessage")
+	if len(preview) != 1 {
+		t.Fatalf("sent %d messages, want the preview", len(preview))
+	}
+	text := preview[0].Get("text")
+	for _, want := range []string{"*pack*", meta.infoHash, "in *2* file(s), private: *yes*", "`tracker.example`", "Label: `tv`"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("preview %q doesn't have %q", text, want)
+		}
+	}
+	if strings.Contains(text, "passkey123") {
+		t.Errorf("preview %q shows the passkey of the tracker", text)
+	}
+	if big, small := strings.Index(text, "big.mkv"), strings.Index(text, "small.txt"); big == -1 || big > small {
+		t.Errorf("preview %q doesn't list the largest file first", text)
+	}
+
+	code := pendingCode(t)
+	cb := &tgbotapi.CallbackQuery{ID: "1", Message: &tgbotapi.Message{MessageID: 10}}
+
+	// only the chat it was sent to can use the buttons
+	handleUpload(&session{chatID: 2}, cb, upAdd+":"+code)
+	if answers := tg.sent("answerCallbackQuery"); len(answers) != 1 || !strings.Contains(answers[0].Get("text"), "No pending torrent") {
+		t.Errorf("another chat: answers = %v", answers)
+	}
+
+	// choose the directory that holds the most torrents, after rTorrent's default one
+	handleUpload(s, cb, upDir+":"+code)
+	edits := tg.sent("editMessageText")
+	if len(edits) != 1 {
+		t.Fatalf("dir: got %d edits, want 1", len(edits))
+	}
+	markup := edits[0].Get("reply_markup")
+	if d, v, m := strings.Index(markup, downloads), strings.Index(markup, tv), strings.Index(markup, movies); d == -1 || d > v || v > m {
+		t.Errorf("dir: buttons %s, want downloads, tv then movies", markup)
+	}
+
+	handleUpload(s, cb, upSetDir+":"+code+":1")
+	if edits := tg.sent("editMessageText"); len(edits) != 1 || !strings.Contains(edits[0].Get("text"), "Directory: `"+tv+"`") {
+		t.Errorf("setdir: edits = %v", edits)
+	}
+
+	handleUpload(s, cb, upPaused+":"+code)
+	var load string
+	for _, call := range rt.called() {
+		if strings.HasPrefix(call, "load.") {
+			load = call
+		}
+	}
+	if !strings.HasPrefix(load, "load.raw ") || !strings.HasSuffix(load, ` d.directory.set="`+tv+`" d.custom1.set=tv`) {
+		t.Errorf("add paused: called %q", load)
+	}
+	if msgs := tg.sent("sendMessage"); len(msgs) != 1 || msgs[0].Get("text") != "Added paused: pack" {
+		t.Errorf("add paused: messages = %v", msgs)
+	}
+
+	uploadsMu.Lock()
+	left := len(uploads)
+	uploadsMu.Unlock()
+	if left != 0 {
+		t.Errorf("%d uploads still pending after adding", left)
+	}
+}
+
+func TestUploadCancelAndExpiry(t *testing.T) {
+	tg := startFakeTelegram(t)
+	rt := startFakeRtorrent(t)
+	dir := t.TempDir()
+	rt.handle = func(method string, params []interface{}) (interface{}, error) {
+		if method == "directory.default" {
+			return dir, nil
+		}
+		return nil, nil
+	}
+	uploads = make(map[string]*pendingUpload)
+	s := &session{chatID: 1}
+	meta := &metaInfo{name: "pack", files: []metaFile{{path: "pack", size: 1}}, size: 1}
+	cb := &tgbotapi.CallbackQuery{ID: "1", Message: &tgbotapi.Message{MessageID: 10}}
+
+	previewUpload(s, nil, meta, "", "")
+	code := pendingCode(t)
+	handleUpload(s, cb, upCancel+":"+code)
+	if edits := tg.sent("editMessageText"); len(edits) != 1 || !strings.HasSuffix(edits[0].Get("text"), "*Cancelled*") {
+		t.Errorf("cancel: edits = %v", edits)
+	}
+	handleUpload(s, cb, upAdd+":"+code)
+	if answers := tg.sent("answerCallbackQuery"); len(answers) != 1 || !strings.Contains(answers[0].Get("text"), "No pending torrent") {
+		t.Errorf("add after cancel: answers = %v", answers)
+	}
+
+	previewUpload(s, nil, meta, "", "")
+	code = pendingCode(t)
+	uploadsMu.Lock()
+	uploads[code].expires = time.Now().Add(-time.Second)
+	uploadsMu.Unlock()
+	tg.sent("")
+	handleUpload(s, cb, upAdd+":"+code)
+	if answers := tg.sent("answerCallbackQuery"); len(answers) != 1 || !strings.Contains(answers[0].Get("text"), "No pending torrent") {
+		t.Errorf("expired: answers = %v", answers)
+	}
+}
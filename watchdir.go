@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// watchDirEvery is how often the watch directories get scanned.
+	watchDirEvery = 10 * time.Second
+
+	// watchDirSettle is how long a file has to stay untouched before it gets loaded,
+	// so files that are still being written get skipped until the next scan.
+	watchDirSettle = 2 * time.Second
+)
+
+// watchDir is a directory that gets scanned for .torrent and .magnet files,
+// they get added to dir with label, then moved to its done or failed subdirectory.
+type watchDir struct {
+	path  string
+	dir   string
+	label string
+
+	// stuck holds the files that got loaded but couldn't be archived, by their modification
+	// time, so they don't get loaded again on every scan unless they change
+	stuck map[string]time.Time
+}
+
+// watchDirs collects the repeated -watch flags.
+type watchDirs []watchDir
+
+func (w *watchDirs) String() string {
+	paths := make([]string, len(*w))
+	for i := range *w {
+		paths[i] = (*w)[i].path
+	}
+	return strings.Join(paths, " ")
+}
+
+// Set parses "DIR[,d=TARGET][,l=LABEL]", with the same d= and l= options captions take.
+func (w *watchDirs) Set(value string) error {
+	parts := strings.Split(value, ",")
+	wd := watchDir{path: parts[0]}
+	for _, o := range parts[1:] {
+		switch {
+		case strings.HasPrefix(o, "d="):
+			wd.dir = o[2:]
+		case strings.HasPrefix(o, "l="):
+			wd.label = o[2:]
+		default:
+			return fmt.Errorf("unknown option '%s', expected d=DIR or l=LABEL", o)
+		}
+	}
+	if wd.path == "" {
+		return fmt.Errorf("needs a directory to watch")
+	}
+	*w = append(*w, wd)
+	return nil
+}
+
+// watchDirectories scans the watch directories every 'watchDirEvery'
+func watchDirectories(dirs []watchDir) {
+	for i := range dirs {
+		var err error
+		if dirs[i].path, _, err = prepareDir(dirs[i].path); err != nil {
+			logger.Print("watch:", err)
+		}
+		dirs[i].stuck = make(map[string]time.Time)
+	}
+
+	for ; ; time.Sleep(watchDirEvery) {
+		for _, wd := range dirs {
+			wd.scan()
+		}
+	}
+}
+
+// scan loads the settled .torrent and .magnet files of the directory
+func (wd watchDir) scan() {
+	entries, err := os.ReadDir(wd.path)
+	if err != nil {
+		logger.Print("watch:", err)
+		return
+	}
+
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if !entry.Type().IsRegular() || (ext != ".torrent" && ext != ".magnet") {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < watchDirSettle {
+			continue
+		}
+
+		file := filepath.Join(wd.path, entry.Name())
+		if modTime, ok := wd.stuck[file]; ok && modTime.Equal(info.ModTime()) {
+			continue
+		}
+		delete(wd.stuck, file)
+
+		sub := "done"
+		if err := wd.load(file); err != nil {
+			logger.Printf("watch: %s: %s", file, err)
+			publish(event{kind: evWatchDir, name: entry.Name(), message: "Failed: " + err.Error()})
+			sub = "failed"
+		} else {
+			publish(event{kind: evWatchDir, name: entry.Name(), message: "Added from: " + wd.path})
+		}
+
+		if err := wd.archive(file, sub); err != nil {
+			logger.Printf("watch: %s: %s, skipping it until it changes", file, err)
+			wd.stuck[file] = info.ModTime()
+		}
+	}
+}
+
+// load adds a .torrent or a .magnet file to the target directory with the label of the watch directory
+func (wd watchDir) load(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	dir := wd.dir
+	if dir != "" {
+		if dir, _, err = prepareDir(dir); err != nil {
+			return err
+		}
+	}
+
+	// .magnet files hold the magnet link as text
+	if strings.EqualFold(filepath.Ext(file), ".magnet") {
+		link := strings.TrimSpace(string(data))
+		if !strings.HasPrefix(link, "magnet:") {
+			return fmt.Errorf("not a magnet link")
+		}
+		return addTorrent(link, filepath.Base(file), dir, wd.label, true)
+	}
+
+	if _, err := parseTorrent(data); err != nil {
+		return err
+	}
+	return addTorrentData(data, dir, wd.label, true)
+}
+
+// archive moves a processed file to the subdirectory sub of the watch directory, so it doesn't get loaded again
+func (wd watchDir) archive(file, sub string) error {
+	dir := filepath.Join(wd.path, sub)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	return os.Rename(file, filepath.Join(dir, filepath.Base(file)))
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rtCall executes an XML-RPC method on rTorrent over SCGI and returns the decoded result, it covers
+// what rtapi doesn't, e.g. setting the throttles or listing the files of a torrent.
+// params can be string, int, int64, uint64, bool, []byte (sent as base64) or []interface{},
+// results are decoded to string, int64, float64, bool, []byte, []interface{} or map[string]interface{}.
+func rtCall(method string, params ...interface{}) (_ interface{}, err error) {
+	defer observeSCGI(time.Now(), &err)
+
+	buf := new(bytes.Buffer)
+	buf.WriteString(xml.Header)
+	buf.WriteString("<methodCall><methodName>")
+	xml.EscapeText(buf, []byte(method))
+	buf.WriteString("</methodName><params>")
+	for _, param := range params {
+		buf.WriteString("<param>")
+		if err := encodeValue(buf, param); err != nil {
+			return nil, fmt.Errorf("%s: %w", method, err)
+		}
+		buf.WriteString("</param>")
+	}
+	buf.WriteString("</params></methodCall>")
+
+	// same as rtapi, a path that exists is a unix socket
+	network := "tcp"
+	if _, err := os.Stat(SCGIURL); err == nil {
+		network = "unix"
+	}
+
+	conn, err := net.Dial(network, SCGIURL)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	headers := fmt.Sprintf("CONTENT_LENGTH%c%d%cSCGI%c1%c", 0, buf.Len(), 0, 0, 0)
+	if _, err := fmt.Fprintf(conn, "%d:%s,", len(headers), headers); err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(buf.Bytes()); err != nil {
+		return nil, err
+	}
+
+	payload, err := io.ReadAll(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	// skip the SCGI headers
+	start := bytes.IndexByte(payload, '<')
+	if start == -1 {
+		return nil, fmt.Errorf("%s: xml response not found", method)
+	}
+
+	var resp struct {
+		Params []xmlrpcValue `xml:"params>param>value"`
+		Fault  *xmlrpcValue  `xml:"fault>value"`
+	}
+	if err := xml.Unmarshal(payload[start:], &resp); err != nil {
+		return nil, fmt.Errorf("%s: %w", method, err)
+	}
+
+	if resp.Fault != nil {
+		fault, _ := resp.Fault.decode().(map[string]interface{})
+		return nil, fmt.Errorf("%s: %v", method, fault["faultString"])
+	}
+
+	if len(resp.Params) == 0 {
+		return nil, nil
+	}
+	return resp.Params[0].decode(), nil
+}
+
+// encodeValue writes an XML-RPC value.
+func encodeValue(buf *bytes.Buffer, v interface{}) error {
+	buf.WriteString("<value>")
+	switch v := v.(type) {
+	case string:
+		buf.WriteString("<string>")
+		xml.EscapeText(buf, []byte(v))
+		buf.WriteString("</string>")
+	case int:
+		fmt.Fprintf(buf, "<i8>%d</i8>", v)
+	case int64:
+		fmt.Fprintf(buf, "<i8>%d</i8>", v)
+	case uint64:
+		fmt.Fprintf(buf, "<i8>%d</i8>", v)
+	case bool:
+		if v {
+			buf.WriteString("<boolean>1</boolean>")
+		} else {
+			buf.WriteString("<boolean>0</boolean>")
+		}
+	case []byte:
+		buf.WriteString("<base64>")
+		buf.WriteString(base64.StdEncoding.EncodeToString(v))
+		buf.WriteString("</base64>")
+	case []interface{}:
+		buf.WriteString("<array><data>")
+		for i := range v {
+			if err := encodeValue(buf, v[i]); err != nil {
+				return err
+			}
+		}
+		buf.WriteString("</data></array>")
+	default:
+		return fmt.Errorf("unsupported xmlrpc type: %T", v)
+	}
+	buf.WriteString("</value>")
+	return nil
+}
+
+// xmlrpcValue is a decoded XML-RPC value, a value without a type is a string.
+type xmlrpcValue struct {
+	String  *string  `xml:"string"`
+	I4      *int64   `xml:"i4"`
+	I8      *int64   `xml:"i8"`
+	Int     *int64   `xml:"int"`
+	Double  *float64 `xml:"double"`
+	Boolean *int     `xml:"boolean"`
+	Base64  *string  `xml:"base64"`
+	Array   *struct {
+		Values []xmlrpcValue `xml:"data>value"`
+	} `xml:"array"`
+	Struct *struct {
+		Members []struct {
+			Name  string      `xml:"name"`
+			Value xmlrpcValue `xml:"value"`
+		} `xml:"member"`
+	} `xml:"struct"`
+	Text string `xml:",chardata"`
+}
+
+// decode converts the value to its go type.
+func (v xmlrpcValue) decode() interface{} {
+	switch {
+	case v.String != nil:
+		return *v.String
+	case v.I8 != nil:
+		return *v.I8
+	case v.I4 != nil:
+		return *v.I4
+	case v.Int != nil:
+		return *v.Int
+	case v.Double != nil:
+		return *v.Double
+	case v.Boolean != nil:
+		return *v.Boolean == 1
+	case v.Base64 != nil:
+		b, _ := base64.StdEncoding.DecodeString(strings.TrimSpace(*v.Base64))
+		return b
+	case v.Array != nil:
+		values := make([]interface{}, len(v.Array.Values))
+		for i := range v.Array.Values {
+			values[i] = v.Array.Values[i].decode()
+		}
+		return values
+	case v.Struct != nil:
+		members := make(map[string]interface{}, len(v.Struct.Members))
+		for _, m := range v.Struct.Members {
+			members[m.Name] = m.Value.decode()
+		}
+		return members
+	}
+	return v.Text
+}
+
+// rtInt converts a decoded value to int64, returns 0 if it isn't a number.
+func rtInt(v interface{}) int64 {
+	switch v := v.(type) {
+	case int64:
+		return v
+	case float64:
+		return int64(v)
+	case bool:
+		if v {
+			return 1
+		}
+	case string:
+		n, _ := strconv.ParseInt(v, 10, 64)
+		return n
+	}
+	return 0
+}
+
+// rtString converts a decoded value to string.
+func rtString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// rtList converts a decoded value to a list, returns nil if it isn't one.
+func rtList(v interface{}) []interface{} {
+	list, _ := v.([]interface{})
+	return list
+}